@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"soul"
+	"soul/filestore"
+)
+
+// openConfig opens the config file at path, or at the default location when path is empty
+func openConfig(path string) (*filestore.Store, error) {
+	if path == "" {
+		return filestore.NewDefault()
+	}
+
+	return filestore.New(path)
+}
+
+// defaultDbPath gives the db path of the selected profile in the default config file, so that -db can be left out
+func defaultDbPath() string {
+	store, err := filestore.NewDefault()
+	if err != nil {
+		return ""
+	}
+
+	return soul.GetDBPath(soul.ActiveProfileStore(store))
+}
+
+func runConfig(args []string) error {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	path := flags.String("file", "", "path of the config file, defaults to the user's config directory")
+	profile := flags.String("profile", "", "profile to read or change, defaults to the selected one")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: soul-cli config [flags] get <key> | set <key> <value> | delete <key> | profiles | select <profile> | path")
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	store, err := openConfig(*path)
+	if err != nil {
+		return err
+	}
+
+	name := soul.ActiveProfile(store)
+	if *profile != "" {
+		name = *profile
+	}
+	profileStore := soul.ProfileStore(store, name)
+
+	action := flags.Args()
+	if len(action) == 0 {
+		flags.Usage()
+		return fmt.Errorf("an action is required")
+	}
+
+	switch {
+	case action[0] == "get" && len(action) == 2:
+		fmt.Println(profileStore.GetString(action[1]))
+	case action[0] == "set" && len(action) == 3:
+		profileStore.SetString(action[1], action[2])
+	case action[0] == "delete" && len(action) == 2:
+		profileStore.Delete(action[1])
+	case action[0] == "profiles" && len(action) == 1:
+		for _, existing := range soul.ListProfiles(store) {
+			marker := " "
+			if existing == soul.ActiveProfile(store) {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\t%s\n", marker, existing, soul.GetDBPath(soul.ProfileStore(store, existing)))
+		}
+	case action[0] == "select" && len(action) == 2:
+		err = soul.SelectProfile(store, action[1])
+		if err != nil {
+			return err
+		}
+	case action[0] == "path" && len(action) == 1:
+		fmt.Println(store.Path())
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown action %v", action)
+	}
+
+	return store.Err()
+}
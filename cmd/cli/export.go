@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"soul"
+	"soul/crypt"
+	"soul/disk"
+	"strings"
+)
+
+// signatureExtension is appended to the export path for its detached signature
+const signatureExtension = ".sig"
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dbPath := flags.String("db", defaultDbPath(), "path of the db file, defaults to the selected profile's")
+	folder := flags.String("folder", "", "name of the folder")
+	out := flags.String("out", "", "path to write the export to, the signature goes next to it")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireFlags(map[string]string{"db": *dbPath, "folder": *folder, "out": *out})
+	if err != nil {
+		return err
+	}
+
+	password, err := prompt("Password")
+	if err != nil {
+		return err
+	}
+
+	repo, err := disk.NewNoteRepository(*dbPath, *folder, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	if err != nil {
+		return err
+	}
+
+	service := soul.NewNoteService(repo)
+	data, signature, err := service.SignedExport(flags.Args()...)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(*out, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write export %w", err)
+	}
+
+	err = ioutil.WriteFile(*out+signatureExtension, signature, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write signature %w", err)
+	}
+
+	signer, err := service.SigningKey()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("export signed by %s\n", signer.PublicKey())
+
+	return nil
+}
+
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	in := flags.String("in", "", "path of the export to verify")
+	signaturePath := flags.String("sig", "", "path of the detached signature, defaults to the export path with .sig")
+	trusted := flags.String("trusted", "", "comma separated public keys the export may be signed by")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireFlags(map[string]string{"in": *in, "trusted": *trusted})
+	if err != nil {
+		return err
+	}
+
+	if len(*signaturePath) == 0 {
+		*signaturePath = *in + signatureExtension
+	}
+
+	data, err := ioutil.ReadFile(*in)
+	if err != nil {
+		return fmt.Errorf("failed to read export %w", err)
+	}
+
+	signature, err := ioutil.ReadFile(*signaturePath)
+	if err != nil {
+		return fmt.Errorf("failed to read signature %w", err)
+	}
+
+	signer, err := crypt.VerifyDetached(data, signature, strings.Split(*trusted, ","))
+	if err != nil {
+		return err
+	}
+
+	export, err := soul.ReadExport(data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("valid export of %d notes signed by %s at %s\n", len(export.Notes), signer, export.ExportedAt.Format("2006-01-02 15:04"))
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"soul/crypt"
+	"strings"
+)
+
+func runKeyFile(args []string) error {
+	flags := flag.NewFlagSet("keyfile", flag.ContinueOnError)
+	out := flags.String("out", "", "path of the key file to create")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if len(strings.TrimSpace(*out)) == 0 {
+		return fmt.Errorf("-out is required")
+	}
+
+	keyFile, err := crypt.NewKeyFile()
+	if err != nil {
+		return err
+	}
+
+	// never overwrite, an existing key file may be the only way into a folder
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create key file %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to write key file %w", err)
+	}
+
+	fmt.Printf("key file written to %s, keep a copy somewhere safe or the folders it protects are lost\n", *out)
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// command is a single subcommand of the cli
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"keyfile": {usage: "generate a random key file to unlock folders with", run: runKeyFile},
+	"shares":  {usage: "split a folder's key into recovery shares", run: runShares},
+	"recover": {usage: "set a new folder password from recovery shares", run: runRecover},
+	"export":  {usage: "export a folder's notes with a detached signature", run: runExport},
+	"verify":  {usage: "check an export's signature against trusted keys", run: runVerify},
+	"config":  {usage: "read and change the settings shared with other soul tools", run: runConfig},
+	"merge":   {usage: "merge a folder from another copy of the db file", run: runMerge},
+	"serve":   {usage: "run a sync server that only ever stores encrypted folders", run: runServe},
+	"sync":    {usage: "sync a folder with a sync server or a WebDAV folder", run: runSync},
+	"peer":    {usage: "sync a folder directly with another machine on the network", run: runPeer},
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: soul-cli <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(os.Args[2:])
+	if err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"soul/crypt"
+	"soul/disk"
+)
+
+func runMerge(args []string) error {
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	dbPath := flags.String("db", defaultDbPath(), "path of the db file to merge into, defaults to the selected profile's")
+	from := flags.String("from", "", "path of the db file to merge from, it is left as is")
+	folder := flags.String("folder", "", "name of the folder")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireFlags(map[string]string{"db": *dbPath, "from": *from, "folder": *folder})
+	if err != nil {
+		return err
+	}
+
+	password, err := prompt("Password")
+	if err != nil {
+		return err
+	}
+
+	report, err := disk.MergeFiles(*dbPath, *from, *folder, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	if err != nil {
+		return err
+	}
+
+	printMergeReport(report, "in both files")
+
+	return nil
+}
+
+// printMergeReport tells what a merge did, where tells where the notes were edited apart
+func printMergeReport(report *disk.MergeReport, where string) {
+	fmt.Printf("merged %d new and %d updated notes, copied %d other entries\n", len(report.Added), len(report.Updated), report.Entries)
+	if len(report.Merged) != 0 {
+		fmt.Printf("merged the edits made %s to %d notes\n", where, len(report.Merged))
+	}
+	for _, id := range report.Marked {
+		fmt.Printf("note %s has conflicting edits, they are left between conflict markers to resolve\n", id)
+	}
+	for id, copied := range report.Conflicts {
+		fmt.Printf("note %s was edited %s, the edit that lost is kept as note %s\n", id, where, copied)
+	}
+}
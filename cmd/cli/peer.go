@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"soul/crypt"
+	"soul/disk"
+	"soul/p2p"
+	"soul/secret"
+)
+
+func runPeer(args []string) error {
+	flags := flag.NewFlagSet("peer", flag.ContinueOnError)
+	dbPath := flags.String("db", defaultDbPath(), "path of the db file, defaults to the selected profile's")
+	folder := flags.String("folder", "", "name of the folder")
+	connect := flags.String("connect", "", "address of a listening peer to sync with, listens for peers when not given")
+	listen := flags.String("listen", p2p.DefaultAddr, "address to listen for peers on")
+	keyFilePath := flags.String("keyfile", "", "key file combined with the password, for folders that use one")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireFlags(map[string]string{"db": *dbPath, "folder": *folder})
+	if err != nil {
+		return err
+	}
+
+	password, err := prompt("Password")
+	if err != nil {
+		return err
+	}
+
+	var keyFile []byte
+	var repo *disk.NoteRepository
+	if len(*keyFilePath) != 0 {
+		keyFile, err = crypt.ReadKeyFile(*keyFilePath)
+		if err != nil {
+			return err
+		}
+
+		buffer := secret.FromString(password)
+		repo, err = disk.NewNoteRepositoryWithKeyFile(*dbPath, *folder, buffer, keyFile, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		buffer.Wipe()
+	} else {
+		repo, err = disk.NewNoteRepository(*dbPath, *folder, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	}
+	if err != nil {
+		return err
+	}
+
+	peer := p2p.NewPeer(repo, *folder, password)
+	if keyFile != nil {
+		peer, err = p2p.NewPeerWithKeyFile(repo, *folder, password, keyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(*connect) != 0 {
+		report, err := peer.Sync(*connect)
+		if err != nil {
+			return err
+		}
+
+		printMergeReport(report, "on both machines")
+		return nil
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen %w", err)
+	}
+	defer l.Close()
+
+	log.Printf("waiting for peers on %s, run soul-cli peer -connect with this machine's address on the other", l.Addr())
+	return peer.Serve(l, func(addr net.Addr, report *disk.MergeReport, err error) {
+		if err != nil {
+			log.Printf("failed to sync with %s: %v", addr, err)
+			return
+		}
+
+		log.Printf("synced with %s", addr)
+		printMergeReport(report, "on both machines")
+	})
+}
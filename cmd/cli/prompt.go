@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt asks for a secret on stdin, so that it does not end up in the shell history. It is not echoed when typed on a
+// terminal, and it is taken as typed with only the line ending dropped.
+func prompt(label string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		typed, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s %w", strings.ToLower(label), err)
+		}
+
+		return string(typed), nil
+	}
+
+	// piped in, by a script for instance
+	line, err := stdin.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", fmt.Errorf("failed to read %s %w", strings.ToLower(label), err)
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// requireFlags fails when any of the named flag values is empty
+func requireFlags(values map[string]string) error {
+	for name, value := range values {
+		if len(strings.TrimSpace(value)) == 0 {
+			return fmt.Errorf("-%s is required", name)
+		}
+	}
+
+	return nil
+}
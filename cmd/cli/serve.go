@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"soul/crypt"
+	"soul/disk"
+	"soul/remote"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// syncTokenEnvVar names the variable holding the token of the sync server, kept out of the flags so that it does not
+// show up in process listings
+const syncTokenEnvVar = "SOUL_SYNC_TOKEN"
+
+// webDAVPasswordEnvVar names the variable holding the password of the WebDAV server, for the same reason
+const webDAVPasswordEnvVar = "SOUL_WEBDAV_PASSWORD"
+
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:8420", "address to listen on, put it behind a TLS terminating proxy when exposed")
+	dbPath := flags.String("records", "", "path of the db file the records are kept in")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireFlags(map[string]string{"records": *dbPath})
+	if err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(*dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open records db %w", err)
+	}
+	defer db.Close()
+
+	store, err := remote.NewBoltStore(db)
+	if err != nil {
+		return err
+	}
+
+	token := os.Getenv(syncTokenEnvVar)
+	if len(token) == 0 {
+		log.Printf("%s is not set, anyone who can reach %s can overwrite records", syncTokenEnvVar, *addr)
+	}
+
+	log.Printf("serving records on %s", *addr)
+	return http.ListenAndServe(*addr, remote.NewServer(store, token))
+}
+
+func runSync(args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	dbPath := flags.String("db", defaultDbPath(), "path of the db file, defaults to the selected profile's")
+	folder := flags.String("folder", "", "name of the folder")
+	server := flags.String("server", "", "URL of the sync server")
+	davURL := flags.String("webdav", "", "URL of a WebDAV folder to sync through instead of a sync server")
+	davUser := flags.String("user", "", "user of the WebDAV server, its password is read from "+webDAVPasswordEnvVar)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireFlags(map[string]string{"db": *dbPath, "folder": *folder})
+	if err != nil {
+		return err
+	}
+
+	var store remote.Store
+	switch {
+	case len(*davURL) != 0:
+		store = remote.NewWebDAVStore(*davURL, *davUser, os.Getenv(webDAVPasswordEnvVar))
+	case len(*server) != 0:
+		store = remote.NewClient(*server, os.Getenv(syncTokenEnvVar))
+	default:
+		return fmt.Errorf("-server or -webdav is required")
+	}
+
+	password, err := prompt("Password")
+	if err != nil {
+		return err
+	}
+
+	repo, err := disk.NewNoteRepository(*dbPath, *folder, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	if err != nil {
+		return err
+	}
+
+	synced := remote.NewRepository(repo, store)
+	err = synced.Sync()
+	if err != nil {
+		return err
+	}
+
+	notes, err := repo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("synced %d notes\n", len(notes))
+
+	return nil
+}
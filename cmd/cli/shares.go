@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"soul/crypt"
+	"soul/disk"
+	"strings"
+)
+
+func runShares(args []string) error {
+	flags := flag.NewFlagSet("shares", flag.ContinueOnError)
+	dbPath := flags.String("db", defaultDbPath(), "path of the db file, defaults to the selected profile's")
+	folder := flags.String("folder", "", "name of the folder")
+	count := flags.Int("count", 5, "number of shares to create")
+	threshold := flags.Int("threshold", 3, "number of shares needed to recover")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireFlags(map[string]string{"db": *dbPath, "folder": *folder})
+	if err != nil {
+		return err
+	}
+
+	password, err := prompt("Password")
+	if err != nil {
+		return err
+	}
+
+	repo, err := disk.NewNoteRepository(*dbPath, *folder, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	if err != nil {
+		return err
+	}
+
+	recoveryKey, err := repo.RecoveryKey()
+	if err != nil {
+		return err
+	}
+
+	shares, err := crypt.SplitSecret(recoveryKey, *count, *threshold)
+	if err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		fmt.Println(share.Text())
+	}
+
+	return nil
+}
+
+func runRecover(args []string) error {
+	flags := flag.NewFlagSet("recover", flag.ContinueOnError)
+	dbPath := flags.String("db", defaultDbPath(), "path of the db file, defaults to the selected profile's")
+	folder := flags.String("folder", "", "name of the folder")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireFlags(map[string]string{"db": *dbPath, "folder": *folder})
+	if err != nil {
+		return err
+	}
+
+	var shares []crypt.Share
+	for {
+		line, err := prompt(fmt.Sprintf("Share %d (empty line when done)", len(shares)+1))
+		if err != nil {
+			return err
+		}
+
+		// shares are pasted more often than typed, whitespace around them is not part of them
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 {
+			break
+		}
+
+		share, err := crypt.ParseShare(line)
+		if err != nil {
+			return err
+		}
+
+		shares = append(shares, share)
+	}
+
+	recoveryKey, err := crypt.CombineShares(shares)
+	if err != nil {
+		return err
+	}
+
+	newPassword, err := prompt("New password")
+	if err != nil {
+		return err
+	}
+
+	_, err = disk.RecoverFolder(*dbPath, *folder, newPassword, recoveryKey, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("folder recovered, it now opens with the new password")
+
+	return nil
+}
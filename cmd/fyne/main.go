@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -9,20 +10,59 @@ import (
 	"soul"
 	"soul/crypt"
 	"soul/disk"
+	"soul/secret"
 	"strings"
+	"sync"
 	"syscall"
 
 	myfyne "soul/fyne"
 
 	"fyne.io/fyne/v2"
 	fyneapp "fyne.io/fyne/v2/app"
-	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
 )
 
 const DefaultBaseScopeV1 = "soul-db-draft-v1/"
 
-func showHomePage(window fyne.Window, service *soul.NoteService, loggedOutFunc func()) error {
-	notesUI := &myfyne.Home{Service: service, OnLoggedOut: loggedOutFunc}
+// activeHome is the open home page, if any, so that system signals can lock it
+type activeHome struct {
+	mu   sync.Mutex
+	home *myfyne.Home
+}
+
+func (a *activeHome) set(home *myfyne.Home) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.home = home
+}
+
+// lock locks the open home page the same way auto lock does
+func (a *activeHome) lock() {
+	a.mu.Lock()
+	home := a.home
+	a.home = nil
+	a.mu.Unlock()
+
+	if home != nil {
+		home.Lock()
+	}
+}
+
+// flush saves the pending edits of the open home page, if any
+func (a *activeHome) flush() {
+	a.mu.Lock()
+	home := a.home
+	a.mu.Unlock()
+
+	if home != nil {
+		home.Flush()
+	}
+}
+
+func showHomePage(window fyne.Window, service *soul.NoteService, store soul.ConfigStore, active *activeHome,
+	loggedOutFunc, lockedFunc func()) error {
+	notesUI := &myfyne.Home{Service: service, OnLoggedOut: loggedOutFunc, OnLocked: lockedFunc, Config: store}
 	canvas, err := notesUI.LoadDataAndBuildUI()
 	if err != nil {
 		return err
@@ -30,32 +70,83 @@ func showHomePage(window fyne.Window, service *soul.NoteService, loggedOutFunc f
 
 	window.SetContent(canvas)
 	notesUI.RegisterKeys(window)
-
-	var gracefulStop = make(chan os.Signal)
-	signal.Notify(gracefulStop, syscall.SIGTERM)
-	signal.Notify(gracefulStop, syscall.SIGINT)
-	signal.Notify(gracefulStop, syscall.SIGQUIT)
-	go func() {
-		<-gracefulStop
-		notesUI.Logout()
-		os.Exit(0)
-	}()
+	notesUI.RegisterMenu(window)
+	active.set(notesUI)
 
 	return nil
 }
 
-func showLoginPage(window fyne.Window, currentDbPath string, onSubmitFunc func(email, password, updatedDbPath string, stayLoggedIn bool) error) {
-	canvasObj := myfyne.NewLoginPage(currentDbPath, onSubmitFunc)
+func showLoginPage(window fyne.Window, profilePicker fyne.CanvasObject, policy *soul.Policy, currentDbPath string, currentPolicy soul.SessionPolicy,
+	onSubmitFunc func(email string, password, pin *secret.Buffer, keyFilePath, updatedDbPath string, stayLoggedIn bool, policy soul.SessionPolicy) error,
+	onRecoverFunc func(folderName, shares, newPassword, dbPath string) error) {
+	var canvasObj fyne.CanvasObject
+	canvasObj = myfyne.NewLoginPage(window, profilePicker, policy, currentDbPath, currentPolicy, onSubmitFunc, func() {
+		window.SetContent(myfyne.NewRecoveryPage(currentDbPath, onRecoverFunc, func() {
+			window.SetContent(canvasObj)
+		}))
+	})
 	window.SetContent(canvasObj)
 }
 
-func showCheckInPage(window fyne.Window, onSubmitFunc func(password string, loginInstead bool) error) {
-	canvasObj := myfyne.NewCheckInPage(window, onSubmitFunc)
+func showCheckInPage(window fyne.Window, profilePicker fyne.CanvasObject, pinEnabled bool, onSubmitFunc func(password *secret.Buffer, usePIN, loginInstead bool) error) {
+	canvasObj := myfyne.NewCheckInPage(window, profilePicker, pinEnabled, onSubmitFunc)
 	window.SetContent(canvasObj)
 }
 
-func setupDiskRepo(folderName, password, dbPath string) (soul.NoteRepository, error) {
-	repo, err := disk.NewNoteRepository(dbPath, folderName, strings.TrimSpace(password), crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+// unlockCredentials opens the stored credentials with the folder password, or with the PIN when usePIN is set
+func unlockCredentials(store soul.ConfigStore, password *secret.Buffer, usePIN bool) (*soul.Credentials, error) {
+	if usePIN {
+		return soul.UnlockWithPIN(store, password, crypt.NewPINCryptor, soul.DefaultPINPolicy)
+	}
+
+	cryptor, err := crypt.NewCryptorFromSecret(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cryptor %w", err)
+	}
+	defer cryptor.Wipe()
+
+	return soul.GetCredentials(store, cryptor)
+}
+
+func recoverDiskRepo(folderName, shares, newPassword, dbPath string) (*disk.NoteRepository, error) {
+	var parsed []crypt.Share
+	for _, line := range strings.Split(shares, "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		share, err := crypt.ParseShare(line)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, share)
+	}
+
+	recoveryKey, err := crypt.CombineShares(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := disk.RecoverFolder(dbPath, folderName, newPassword, recoveryKey, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func setupDiskRepo(folderName string, password *secret.Buffer, keyFilePath, dbPath string) (*disk.NoteRepository, error) {
+	if len(strings.TrimSpace(keyFilePath)) != 0 {
+		keyFile, err := crypt.ReadKeyFile(keyFilePath)
+		if err != nil {
+			return nil, err
+		}
+
+		return disk.NewNoteRepositoryWithKeyFile(dbPath, folderName, password, keyFile, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	}
+
+	repo, err := disk.NewNoteRepositoryFromSecret(dbPath, folderName, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
 	if err != nil {
 		return nil, err
 	}
@@ -69,94 +160,241 @@ func main() {
 	log.SetOutput(ioutil.Discard)
 	log.Println("Starting soul...")
 	app := fyneapp.NewWithID("org.standard.soul.app")
-	app.Settings().SetTheme(theme.DarkTheme())
-
-	confStore := myfyne.NewFyneConfigStore(app)
+	appStore := myfyne.NewFyneConfigStore(app)
+	// confStore holds the settings of the selected profile, it changes when another profile is selected
+	confStore := soul.ActiveProfileStore(appStore)
+	// invalid settings fall back to their defaults
+	settings, _ := soul.LoadSettings(confStore)
+	myfyne.ApplyTheme(app, settings)
 
 	window := app.NewWindow("Soul")
 	window.CenterOnScreen()
 
-	var onLoggedInFunc = func(logoutChan chan bool) func(folderName, password, updatedDbPath string, stayLoggedIn bool) error {
-		return func(folderName, password, updatedDbPath string, stayLoggedIn bool) error {
+	// a policy file that cannot be read blocks the app rather than being ignored
+	orgPolicy, err := soul.ActivePolicy()
+	if err == nil {
+		err = orgPolicy.Enforce(appStore)
+	}
+	if err != nil {
+		window.SetContent(widget.NewLabel(fmt.Sprintf("Soul cannot start because of your organisation's policy: %v", err)))
+		window.Resize(fyne.NewSize(settings.WindowWidth, settings.WindowHeight))
+		window.ShowAndRun()
+		return
+	}
+
+	active := new(activeHome)
+	logoutChan := make(chan bool)
+	var showCheckIn, showLogin, showSelectedProfile func()
+
+	// locking returns to the check-in page while credentials are stored, to the login page otherwise
+	var onLockedFunc = func() {
+		if soul.IsSignedIn(confStore) {
+			showCheckIn()
+			return
+		}
+
+		logoutChan <- true
+	}
+
+	var onLoggedInFunc = func(logoutChan chan bool) func(folderName string, password, pin *secret.Buffer, keyFilePath, updatedDbPath string, stayLoggedIn bool, policy soul.SessionPolicy) error {
+		return func(folderName string, password, pin *secret.Buffer, keyFilePath, updatedDbPath string, stayLoggedIn bool, policy soul.SessionPolicy) error {
+			defer password.Wipe()
+			defer pin.Wipe()
+			if stayLoggedIn {
+				err := orgPolicy.CheckKeepOpen()
+				if err != nil {
+					return err
+				}
+			}
 			soul.StoreDbPath(confStore, updatedDbPath)
 
-			repo, err := setupDiskRepo(folderName, password, updatedDbPath)
+			repo, err := setupDiskRepo(folderName, password, keyFilePath, updatedDbPath)
 			if err != nil {
 				return err
 			}
+			// the db file stays locked while open, a login that fails from here on closes it again
+			opened := false
+			defer func() {
+				if !opened {
+					repo.Close()
+				}
+			}()
 
 			if stayLoggedIn {
-				cryptor, err := crypt.NewCryptor(strings.TrimSpace(password))
+				cryptor, err := crypt.NewCryptorFromSecret(password)
 				if err != nil {
 					return fmt.Errorf("failed to create cryptor %w", err)
 				}
+				defer cryptor.Wipe()
 
-				err = soul.SetCredentials(confStore, cryptor, &soul.Credentials{
-					Identifier: folderName,
-					Password:   password,
-				})
+				credentials := &soul.Credentials{
+					Identifier:  folderName,
+					Password:    password,
+					KeyFilePath: keyFilePath,
+				}
+				soul.SetSessionPolicy(confStore, policy)
+				policy.Apply(credentials)
+				err = soul.SetCredentials(confStore, cryptor, credentials)
 				if err != nil {
 					return fmt.Errorf("failed to store credentials %w", err)
 				}
+
+				// a PIN left from an earlier login would unlock the old credentials
+				soul.DeletePIN(confStore)
+				if pin.Len() > 0 {
+					err = soul.SetPIN(confStore, pin, credentials, crypt.NewPINCryptor)
+					if err != nil {
+						return fmt.Errorf("failed to set PIN %w", err)
+					}
+				}
 			}
 
 			err = showHomePage(window, &soul.NoteService{
 				Repo: repo,
-			}, func() {
+			}, confStore, active, func() {
 				logoutChan <- true
-			})
+			}, onLockedFunc)
 			if err != nil {
 				return fmt.Errorf("failed to load home page ui %v", err)
 			}
 
+			opened = true
 			return nil
 		}
 	}
 
-	logoutChan := make(chan bool)
+	var onRecoverFunc = func(logoutChan chan bool) func(folderName, shares, newPassword, dbPath string) error {
+		return func(folderName, shares, newPassword, dbPath string) error {
+			soul.StoreDbPath(confStore, dbPath)
+
+			repo, err := recoverDiskRepo(folderName, shares, newPassword, dbPath)
+			if err != nil {
+				return err
+			}
+
+			err = showHomePage(window, &soul.NoteService{Repo: repo}, confStore, active, func() {
+				logoutChan <- true
+			}, onLockedFunc)
+			if err != nil {
+				repo.Close()
+				return fmt.Errorf("failed to load home page ui %v", err)
+			}
+
+			return nil
+		}
+	}
+
+	var selectProfile = func(name string) error {
+		err := soul.SelectProfile(appStore, name)
+		if err != nil {
+			return err
+		}
+
+		confStore = soul.ActiveProfileStore(appStore)
+		settings, _ := soul.LoadSettings(confStore)
+		myfyne.ApplyTheme(app, settings)
+		showSelectedProfile()
+
+		return nil
+	}
+
+	var newProfilePicker = func() fyne.CanvasObject {
+		return myfyne.NewProfilePicker(window, soul.ListProfiles(appStore), soul.ActiveProfile(appStore), selectProfile,
+			func(name, dbPath string) error {
+				err := soul.AddProfile(appStore, name, dbPath)
+				if err != nil {
+					return err
+				}
+
+				return selectProfile(strings.TrimSpace(name))
+			}, func(name string) error {
+				err := soul.RemoveProfile(appStore, name)
+				if err != nil {
+					return err
+				}
+
+				return selectProfile(soul.ActiveProfile(appStore))
+			})
+	}
+
+	showLogin = func() {
+		showLoginPage(window, newProfilePicker(), orgPolicy, soul.GetDBPath(confStore), soul.GetSessionPolicy(confStore), onLoggedInFunc(logoutChan), onRecoverFunc(logoutChan))
+	}
+
+	// the selected profile opens on the check-in page while it keeps credentials, on the login page otherwise
+	showSelectedProfile = func() {
+		if soul.IsSignedIn(confStore) {
+			showCheckIn()
+		} else {
+			showLogin()
+		}
+	}
+
 	go func() {
 		for {
 			<-logoutChan
-			showLoginPage(window, soul.GetDBPath(confStore), onLoggedInFunc(logoutChan))
+			showLogin()
 		}
 	}()
 
-	if soul.IsSignedIn(confStore) {
-		showCheckInPage(window, func(password string, loginInstead bool) error {
+	showCheckIn = func() {
+		showCheckInPage(window, newProfilePicker(), soul.HasPIN(confStore), func(password *secret.Buffer, usePIN, loginInstead bool) error {
 			if loginInstead {
-				showLoginPage(window, soul.GetDBPath(confStore), onLoggedInFunc(logoutChan))
+				showLogin()
 				return nil
 			}
+			defer password.Wipe()
 
-			cryptor, err := crypt.NewCryptor(strings.TrimSpace(password))
+			credentials, err := unlockCredentials(confStore, password, usePIN)
+			if errors.Is(err, soul.ErrPINWiped) {
+				showLogin()
+				return err
+			}
 			if err != nil {
-				return fmt.Errorf("failed to create cryptor %w", err)
+				return fmt.Errorf("failed to extract credentials %w. You may try logging in instead", err)
 			}
+			defer credentials.Wipe()
 
-			credentials, err := soul.GetCredentials(confStore, cryptor)
+			err = soul.CheckIn(confStore, credentials)
+			if errors.Is(err, soul.ErrSessionExpired) {
+				showLogin()
+				return err
+			}
 			if err != nil {
-				return fmt.Errorf("failed to extract credentials %w. You may try logging in instead", err)
+				return err
 			}
 
 			// login use these credentials now
-			repo, err := setupDiskRepo(credentials.Identifier, credentials.Password, soul.GetDBPath(confStore))
+			repo, err := setupDiskRepo(credentials.Identifier, credentials.Password, credentials.KeyFilePath, soul.GetDBPath(confStore))
 			if err != nil {
 				return err
 			}
 
-			err = showHomePage(window, &soul.NoteService{Repo: repo}, func() {
-				showLoginPage(window, soul.GetDBPath(confStore), onLoggedInFunc(logoutChan))
-			})
+			err = showHomePage(window, &soul.NoteService{Repo: repo}, confStore, active, func() {
+				showLogin()
+			}, onLockedFunc)
 			if err != nil {
+				repo.Close()
 				return fmt.Errorf("failed to load home page ui %v", err)
 			}
 
 			return nil
 		})
-	} else {
-		showLoginPage(window, soul.GetDBPath(confStore), onLoggedInFunc(logoutChan))
 	}
 
-	window.Resize(fyne.NewSize(1000, 600))
+	// system signals lock the open folder, saving pending edits, before quitting
+	gracefulStop := make(chan os.Signal, 1)
+	signal.Notify(gracefulStop, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	go func() {
+		<-gracefulStop
+		active.lock()
+		os.Exit(0)
+	}()
+
+	showSelectedProfile()
+
+	// closing the window quits, edits not saved yet go first
+	window.SetOnClosed(active.flush)
+	window.Resize(fyne.NewSize(settings.WindowWidth, settings.WindowHeight))
 	window.ShowAndRun()
 }
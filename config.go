@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
+	"soul/secret"
 	"strings"
+	"time"
 )
 
 // Encrypter encrypts the data
@@ -28,13 +31,219 @@ type ConfigStore interface {
 // Credentials represents a user credential
 type Credentials struct {
 	Identifier string
-	Password   string
+	Password   *secret.Buffer
+	// KeyFilePath is the key file combined with the password, if the folder uses one
+	KeyFilePath string
+	// IssuedAt, MaxAge and MaxCheckIns limit how long the stored credentials keep a folder open, see CheckIn
+	IssuedAt    time.Time
+	MaxAge      time.Duration
+	MaxCheckIns int
+}
+
+// legacyCredentials is how credentials were stored before passwords moved into secret buffers
+type legacyCredentials struct {
+	Identifier  string
+	Password    string
+	KeyFilePath string
+}
+
+// Wipe zeroes the password
+func (c *Credentials) Wipe() {
+	c.Password.Wipe()
 }
 
 const LocalCreditialsKeyName = "ENCRYPTED_DATA_MAIN"
 
 const DBPathKeyName = "DB_PATH"
 
+// DefaultAutoLock is the idle time after which an open folder locks unless configured otherwise
+const DefaultAutoLock = 5 * time.Minute
+
+// GetAutoLock gives the idle time after which an open folder locks, 0 when auto lock is off
+func GetAutoLock(store ConfigStore) time.Duration {
+	settings, _ := LoadSettings(store)
+
+	return settings.AutoLock
+}
+
+// SetAutoLock stores the idle time after which an open folder locks, rounded to minutes, 0 turns auto lock off
+func SetAutoLock(store ConfigStore, timeout time.Duration) error {
+	settings, _ := LoadSettings(store)
+	settings.AutoLock = timeout / time.Minute * time.Minute
+
+	return SaveSettings(store, settings)
+}
+
+const (
+	// ProfilesKeyName holds the names of the profiles added besides the default one
+	ProfilesKeyName = "PROFILES"
+	// ActiveProfileKeyName holds the name of the selected profile
+	ActiveProfileKeyName = "ACTIVE_PROFILE"
+	// DefaultProfile is the profile that always exists, it keeps its settings where they were before profiles
+	DefaultProfile = "Default"
+
+	profileKeyPrefix     = "PROFILE:"
+	maxProfileNameLength = 64
+)
+
+// profileKeyNames are the settings kept per profile, removing a profile deletes them
+var profileKeyNames = []string{
+	LocalCreditialsKeyName, DBPathKeyName, SettingsKeyName,
+	PINCredentialsKeyName, PINSaltKeyName, PINAttemptsKeyName, PINLockedUntilKeyName,
+	SessionMaxAgeKeyName, SessionMaxCheckInsKeyName, CheckInsKeyName,
+}
+
+// profileStore keeps the settings of one profile apart by prefixing their keys
+type profileStore struct {
+	store  ConfigStore
+	prefix string
+}
+
+func (ps *profileStore) SetString(key, val string) {
+	ps.store.SetString(ps.prefix+key, val)
+}
+
+func (ps *profileStore) GetString(key string) string {
+	return ps.store.GetString(ps.prefix + key)
+}
+
+func (ps *profileStore) Delete(key string) {
+	ps.store.Delete(ps.prefix + key)
+}
+
+// ProfileStore gives the store of the named profile's settings, the default profile uses store itself
+func ProfileStore(store ConfigStore, name string) ConfigStore {
+	if name == DefaultProfile {
+		return store
+	}
+
+	return &profileStore{store: store, prefix: profileKeyPrefix + name + ":"}
+}
+
+// ActiveProfileStore gives the store of the selected profile's settings
+func ActiveProfileStore(store ConfigStore) ConfigStore {
+	return ProfileStore(store, ActiveProfile(store))
+}
+
+// ListProfiles lists the profiles, the default profile first
+func ListProfiles(store ConfigStore) []string {
+	return append([]string{DefaultProfile}, addedProfiles(store)...)
+}
+
+// AddProfile adds a profile with its own db path and credentials, dbPath may be empty
+func AddProfile(store ConfigStore, name, dbPath string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("profile name cannot be empty")
+	}
+
+	if len(name) > maxProfileNameLength {
+		return fmt.Errorf("profile name cannot be longer than %d characters", maxProfileNameLength)
+	}
+
+	for _, existing := range ListProfiles(store) {
+		if strings.EqualFold(existing, name) {
+			return fmt.Errorf("profile %s already exists", existing)
+		}
+	}
+
+	err := setAddedProfiles(store, append(addedProfiles(store), name))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(dbPath) != "" {
+		StoreDbPath(ProfileStore(store, name), dbPath)
+	}
+
+	return nil
+}
+
+// RemoveProfile removes a profile along with its settings and stored credentials, the default profile cannot be
+// removed. Removing the selected profile selects the default one.
+func RemoveProfile(store ConfigStore, name string) error {
+	if name == DefaultProfile {
+		return fmt.Errorf("the default profile cannot be removed")
+	}
+
+	var remaining []string
+	for _, existing := range addedProfiles(store) {
+		if existing != name {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	if len(remaining) == len(addedProfiles(store)) {
+		return fmt.Errorf("profile %s does not exist", name)
+	}
+
+	err := setAddedProfiles(store, remaining)
+	if err != nil {
+		return err
+	}
+
+	ps := ProfileStore(store, name)
+	DeleteCredentials(ps)
+	for _, key := range profileKeyNames {
+		ps.Delete(key)
+	}
+
+	if ActiveProfile(store) == name {
+		store.Delete(ActiveProfileKeyName)
+	}
+
+	return nil
+}
+
+// SelectProfile makes the named profile the one the app opens with
+func SelectProfile(store ConfigStore, name string) error {
+	for _, existing := range ListProfiles(store) {
+		if existing == name {
+			store.SetString(ActiveProfileKeyName, name)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("profile %s does not exist", name)
+}
+
+// ActiveProfile gives the name of the selected profile, the default one unless another was selected
+func ActiveProfile(store ConfigStore) string {
+	name := store.GetString(ActiveProfileKeyName)
+	for _, existing := range addedProfiles(store) {
+		if existing == name {
+			return name
+		}
+	}
+
+	return DefaultProfile
+}
+
+func addedProfiles(store ConfigStore) []string {
+	var names []string
+	serialized := store.GetString(ProfilesKeyName)
+	if strings.TrimSpace(serialized) == "" {
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(serialized), &names); err != nil {
+		return nil
+	}
+
+	return names
+}
+
+func setAddedProfiles(store ConfigStore, names []string) error {
+	serialized, err := json.Marshal(names)
+	if err != nil {
+		return fmt.Errorf("failed to encode profiles %w", err)
+	}
+
+	store.SetString(ProfilesKeyName, string(serialized))
+
+	return nil
+}
+
 func StoreDbPath(store ConfigStore, path string) {
 	store.SetString(DBPathKeyName, path)
 }
@@ -50,7 +259,11 @@ func IsSignedIn(store ConfigStore) bool {
 }
 
 func GetCredentials(store ConfigStore, decrypter Decrypter) (*Credentials, error) {
-	serializedData := store.GetString(LocalCreditialsKeyName)
+	return getCredentials(store, LocalCreditialsKeyName, decrypter)
+}
+
+func getCredentials(store ConfigStore, keyName string, decrypter Decrypter) (*Credentials, error) {
+	serializedData := store.GetString(keyName)
 	if strings.TrimSpace(serializedData) == "" {
 		return nil, fmt.Errorf("credentials not found")
 	}
@@ -64,12 +277,22 @@ func GetCredentials(store ConfigStore, decrypter Decrypter) (*Credentials, error
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt %w", err)
 	}
+	defer secret.Zero(decrypted)
 
 	credentials := new(Credentials)
 	decoder := gob.NewDecoder(bytes.NewReader(decrypted))
 	err = decoder.Decode(credentials)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode credentials %w", err)
+		legacy := new(legacyCredentials)
+		if legacyErr := gob.NewDecoder(bytes.NewReader(decrypted)).Decode(legacy); legacyErr != nil {
+			return nil, fmt.Errorf("failed to decode credentials %w", err)
+		}
+
+		credentials = &Credentials{
+			Identifier:  legacy.Identifier,
+			Password:    secret.FromString(legacy.Password),
+			KeyFilePath: legacy.KeyFilePath,
+		}
 	}
 
 	if credentials == nil {
@@ -80,9 +303,24 @@ func GetCredentials(store ConfigStore, decrypter Decrypter) (*Credentials, error
 }
 
 func SetCredentials(store ConfigStore, encrypter Encrypter, credentials *Credentials) error {
+	return setCredentials(store, LocalCreditialsKeyName, encrypter, credentials)
+}
+
+func setCredentials(store ConfigStore, keyName string, encrypter Encrypter, credentials *Credentials) error {
+	policy, err := ActivePolicy()
+	if err != nil {
+		return err
+	}
+
+	err = policy.CheckKeepOpen()
+	if err != nil {
+		return err
+	}
+
 	var encoded bytes.Buffer
 	encoder := gob.NewEncoder(&encoded)
-	err := encoder.Encode(*credentials)
+	err = encoder.Encode(*credentials)
+	defer secret.Zero(encoded.Bytes())
 	if err != nil {
 		return fmt.Errorf("failed to encode %w", err)
 	}
@@ -92,11 +330,16 @@ func SetCredentials(store ConfigStore, encrypter Encrypter, credentials *Credent
 		return fmt.Errorf("failed to encrypt %w", err)
 	}
 
-	store.SetString(LocalCreditialsKeyName, base64.StdEncoding.EncodeToString(encrypted))
+	store.SetString(keyName, base64.StdEncoding.EncodeToString(encrypted))
+	if keyName == LocalCreditialsKeyName {
+		store.Delete(CheckInsKeyName)
+	}
 
 	return nil
 }
 
 func DeleteCredentials(store ConfigStore) {
 	store.Delete(LocalCreditialsKeyName)
+	store.Delete(CheckInsKeyName)
+	DeletePIN(store)
 }
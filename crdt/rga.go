@@ -0,0 +1,347 @@
+// Package crdt holds a replicated growable array, a sequence CRDT that lets copies of a text be edited apart and
+// merged without conflicts. Deleted characters are kept as tombstones so that edits made concurrently still find
+// their place.
+package crdt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ID identifies a character by the replica that inserted it and that replica's Lamport clock at the time
+type ID struct {
+	Replica string
+	Counter uint64
+}
+
+// root is the origin of characters inserted at the start of the text
+var root = ID{}
+
+// after tells whether id wins over other among characters inserted at the same place, the later insert goes first
+func (id ID) after(other ID) bool {
+	if id.Counter != other.Counter {
+		return id.Counter > other.Counter
+	}
+
+	return id.Replica > other.Replica
+}
+
+type element struct {
+	ID ID
+	// Origin is the character this one was inserted after
+	Origin  ID
+	Value   rune
+	Deleted bool
+}
+
+// newReplica gives a random replica id. Each document loaded is a replica of its own, so that two copies of a note
+// opened by the same process never make edits with the same ids.
+func newReplica() string {
+	random := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		panic(fmt.Sprintf("failed to generate replica id %v", err))
+	}
+
+	return hex.EncodeToString(random)
+}
+
+// Doc is a text as a sequence CRDT, it is safe for concurrent use
+type Doc struct {
+	mu       sync.Mutex
+	replica  string
+	clock    uint64
+	elements []element
+}
+
+// New creates an empty document
+func New() *Doc {
+	return &Doc{replica: newReplica()}
+}
+
+// FromText creates a document holding text
+func FromText(text string) *Doc {
+	doc := New()
+	doc.SetText(text)
+
+	return doc
+}
+
+// Text gives the visible text
+func (d *Doc) Text() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return string(d.visible())
+}
+
+// Insert inserts text before the character at pos of the visible text
+func (d *Doc) Insert(pos int, text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.insert(pos, []rune(text))
+}
+
+// Delete deletes count characters from pos of the visible text
+func (d *Doc) Delete(pos, count int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.delete(pos, count)
+}
+
+// SetText turns the document into text with the fewest inserts and deletes around the part that changed, which is
+// how edits made in a text entry come in
+func (d *Doc) SetText(text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, next := d.visible(), []rune(text)
+	prefix := 0
+	for prefix < len(current) && prefix < len(next) && current[prefix] == next[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(current)-prefix && suffix < len(next)-prefix &&
+		current[len(current)-1-suffix] == next[len(next)-1-suffix] {
+		suffix++
+	}
+
+	d.delete(prefix, len(current)-prefix-suffix)
+	d.insert(prefix, next[prefix:len(next)-suffix])
+}
+
+// Merge merges the edits of other into the document, merging is commutative, associative and idempotent so that
+// copies merged in any order end up with the same text
+func (d *Doc) Merge(other *Doc) {
+	if d == other {
+		return
+	}
+
+	other.mu.Lock()
+	elements := append([]element(nil), other.elements...)
+	other.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	positions := make(map[ID]int, len(d.elements))
+	for i, e := range d.elements {
+		positions[e.ID] = i
+	}
+
+	// elements come after their origin, so merging them in order always finds the origin in place
+	last, lastPos := root, -1
+	for _, e := range elements {
+		if i, ok := positions[e.ID]; ok {
+			d.elements[i].Deleted = d.elements[i].Deleted || e.Deleted
+			last, lastPos = e.ID, i
+			continue
+		}
+
+		originPos := -1
+		switch {
+		case e.Origin == last:
+			originPos = lastPos
+		case e.Origin != root:
+			originPos = d.find(e.Origin)
+		}
+
+		pos := d.integrate(e, originPos)
+		if e.ID.Counter > d.clock {
+			d.clock = e.ID.Counter
+		}
+
+		// the elements after the insert moved along by one
+		positions[e.ID] = pos
+		for j := pos + 1; j < len(d.elements); j++ {
+			positions[d.elements[j].ID] = j
+		}
+		last, lastPos = e.ID, pos
+	}
+}
+
+// Clone gives an independent copy of the document
+func (d *Doc) Clone() *Doc {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return &Doc{replica: d.replica, clock: d.clock, elements: append([]element(nil), d.elements...)}
+}
+
+// encodedDoc is the stored form of a document, replicas are kept once and referred to by their position
+type encodedDoc struct {
+	Replicas []string
+	Elements []encodedElement
+}
+
+type encodedElement struct {
+	Replica       int
+	Counter       uint64
+	OriginReplica int
+	OriginCounter uint64
+	Value         rune
+	Deleted       bool
+}
+
+// MarshalBinary encodes the document with its tombstones, the replica it is edited as is left out
+func (d *Doc) MarshalBinary() ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	replicas := map[string]int{"": 0}
+	encoded := encodedDoc{Replicas: []string{""}}
+	replica := func(name string) int {
+		i, ok := replicas[name]
+		if !ok {
+			i = len(encoded.Replicas)
+			replicas[name] = i
+			encoded.Replicas = append(encoded.Replicas, name)
+		}
+
+		return i
+	}
+
+	for _, e := range d.elements {
+		encoded.Elements = append(encoded.Elements, encodedElement{
+			Replica:       replica(e.ID.Replica),
+			Counter:       e.ID.Counter,
+			OriginReplica: replica(e.Origin.Replica),
+			OriginCounter: e.Origin.Counter,
+			Value:         e.Value,
+			Deleted:       e.Deleted,
+		})
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a document given by MarshalBinary, it is edited as a new replica from then on
+func Unmarshal(data []byte) (*Doc, error) {
+	encoded := new(encodedDoc)
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode document %w", err)
+	}
+
+	doc := New()
+	seen := make(map[ID]bool, len(encoded.Elements))
+	seen[root] = true
+	for _, e := range encoded.Elements {
+		if e.Replica >= len(encoded.Replicas) || e.OriginReplica >= len(encoded.Replicas) || e.Replica < 0 || e.OriginReplica < 0 {
+			return nil, fmt.Errorf("corrupted document, unknown replica")
+		}
+
+		decoded := element{
+			ID:      ID{Replica: encoded.Replicas[e.Replica], Counter: e.Counter},
+			Origin:  ID{Replica: encoded.Replicas[e.OriginReplica], Counter: e.OriginCounter},
+			Value:   e.Value,
+			Deleted: e.Deleted,
+		}
+		if !seen[decoded.Origin] || seen[decoded.ID] {
+			return nil, fmt.Errorf("corrupted document, characters out of order")
+		}
+		seen[decoded.ID] = true
+
+		doc.elements = append(doc.elements, decoded)
+		if decoded.ID.Counter > doc.clock {
+			doc.clock = decoded.ID.Counter
+		}
+	}
+
+	return doc, nil
+}
+
+// visible gives the characters that are not deleted, the caller holds d.mu
+func (d *Doc) visible() []rune {
+	var text []rune
+	for _, e := range d.elements {
+		if !e.Deleted {
+			text = append(text, e.Value)
+		}
+	}
+
+	return text
+}
+
+// index gives the position among all elements of the visible character at pos, len(d.elements) past the end. The
+// caller holds d.mu.
+func (d *Doc) index(pos int) int {
+	for i, e := range d.elements {
+		if e.Deleted {
+			continue
+		}
+		if pos == 0 {
+			return i
+		}
+		pos--
+	}
+
+	return len(d.elements)
+}
+
+func (d *Doc) insert(pos int, text []rune) {
+	if len(text) == 0 {
+		return
+	}
+
+	origin, originPos := root, -1
+	if at := d.index(pos); at > 0 {
+		originPos = at - 1
+		origin = d.elements[originPos].ID
+	}
+
+	for _, value := range text {
+		d.clock++
+		e := element{ID: ID{Replica: d.replica, Counter: d.clock}, Origin: origin, Value: value}
+		originPos = d.integrate(e, originPos)
+		origin = e.ID
+	}
+}
+
+func (d *Doc) delete(pos, count int) {
+	for i := d.index(pos); i < len(d.elements) && count > 0; i++ {
+		if !d.elements[i].Deleted {
+			d.elements[i].Deleted = true
+			count--
+		}
+	}
+}
+
+// integrate places a new element after its origin at originPos, -1 for the start, skipping over the characters
+// inserted there later, which come first. It gives the position the element ended up at.
+func (d *Doc) integrate(e element, originPos int) int {
+	pos := originPos + 1
+	for pos < len(d.elements) && d.elements[pos].ID.after(e.ID) {
+		pos++
+	}
+
+	d.elements = append(d.elements, element{})
+	copy(d.elements[pos+1:], d.elements[pos:])
+	d.elements[pos] = e
+
+	return pos
+}
+
+// find gives the position of the element with the id, -1 when there is none
+func (d *Doc) find(id ID) int {
+	for i, e := range d.elements {
+		if e.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
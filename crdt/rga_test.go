@@ -0,0 +1,104 @@
+package crdt
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// replicaDoc gives a copy of doc edited as another replica, as a copy synced to another device would be
+func replicaDoc(doc *Doc, replica string) *Doc {
+	copied := doc.Clone()
+	copied.replica = replica
+
+	return copied
+}
+
+func TestConcurrentEdits(t *testing.T) {
+	base := FromText("the quick fox\n")
+	laptop, desktop := replicaDoc(base, "laptop"), replicaDoc(base, "desktop")
+
+	laptop.SetText("the quick brown fox\n")
+	// edits come in from the entry one at a time
+	desktop.SetText("the very quick fox\n")
+	desktop.SetText("the very quick fox jumps\n")
+	desktop.Delete(0, 4)
+
+	merged := laptop.Clone()
+	merged.Merge(desktop)
+	assert.Equal(t, "very quick brown fox jumps\n", merged.Text())
+
+	// the order of merging does not matter and merging again changes nothing
+	other := desktop.Clone()
+	other.Merge(laptop)
+	other.Merge(laptop)
+	assert.Equal(t, merged.Text(), other.Text())
+
+	// inserts at the same place keep each side's text together
+	laptop, desktop = replicaDoc(base, "laptop"), replicaDoc(base, "desktop")
+	laptop.Insert(0, "laptop ")
+	desktop.Insert(0, "desktop ")
+	laptop.Merge(desktop)
+	desktop.Merge(laptop)
+	assert.Equal(t, laptop.Text(), desktop.Text())
+	assert.Contains(t, []string{"laptop desktop the quick fox\n", "desktop laptop the quick fox\n"}, laptop.Text())
+}
+
+func TestRandomEditsConverge(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	alphabet := []rune("ab \nçé")
+
+	for round := 0; round < 50; round++ {
+		base := FromText("start")
+		docs := []*Doc{replicaDoc(base, "a"), replicaDoc(base, "b"), replicaDoc(base, "c")}
+
+		for i := 0; i < 30; i++ {
+			doc := docs[random.Intn(len(docs))]
+			length := len([]rune(doc.Text()))
+			switch random.Intn(3) {
+			case 0:
+				doc.Insert(random.Intn(length+1), string(alphabet[random.Intn(len(alphabet))]))
+			case 1:
+				doc.Delete(random.Intn(length+1), random.Intn(3))
+			default:
+				// occasionally a partial sync
+				doc.Merge(docs[random.Intn(len(docs))])
+			}
+		}
+
+		forward, backward := docs[0].Clone(), docs[2].Clone()
+		forward.Merge(docs[1])
+		forward.Merge(docs[2])
+		backward.Merge(docs[1])
+		backward.Merge(docs[0])
+		assert.Equal(t, forward.Text(), backward.Text())
+	}
+}
+
+func TestSetText(t *testing.T) {
+	doc := New()
+	for _, text := range []string{"hello", "hello world", "help world", "", "ünïcode ✓", "ünïcode"} {
+		doc.SetText(text)
+		assert.Equal(t, text, doc.Text())
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	doc := replicaDoc(FromText("some text"), "other")
+	doc.SetText("some other text")
+
+	data, err := doc.MarshalBinary()
+	assert.Nil(t, err)
+	decoded, err := Unmarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, doc.Text(), decoded.Text())
+	assert.NotEqual(t, doc.replica, decoded.replica)
+
+	// edits made after decoding come after every character already there
+	decoded.Insert(0, "x")
+	assert.Equal(t, "xsome other text", decoded.Text())
+
+	_, err = Unmarshal([]byte("not a document"))
+	assert.NotNil(t, err)
+}
@@ -6,15 +6,25 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"soul"
+	"soul/secret"
+	"sync"
 )
 
 type Crypter struct {
 	Key []byte
+	// buffer holds Key when the crypter was created with NewCryptor or NewCryptorFromSecret
+	buffer *secret.Buffer
+	// mu keeps Wipe from zeroing the key while it is in use
+	mu sync.RWMutex
 }
 
+// ErrWiped is returned by a crypter whose key was wiped
+var ErrWiped = errors.New("key was wiped")
+
 // filler is used to append keys in case if they are less than 32 bytes
 // WARNING: Do not modify this, else the entire encryption decryption might fail if its old
 const filler = byte('u')
@@ -23,6 +33,13 @@ var _ soul.Encrypter = &Crypter{}
 var _ soul.Decrypter = &Crypter{}
 
 func (crypter *Crypter) Encrypt(input []byte) ([]byte, error) {
+	crypter.mu.RLock()
+	defer crypter.mu.RUnlock()
+
+	if crypter.Key == nil {
+		return nil, ErrWiped
+	}
+
 	// generate a new aes cipher using our 32 byte long key
 	c, err := aes.NewCipher(crypter.Key)
 	// if there are any errors, handle them
@@ -58,6 +75,13 @@ func (crypter *Crypter) Encrypt(input []byte) ([]byte, error) {
 }
 
 func (crypter *Crypter) Decrypt(encrypted []byte) ([]byte, error) {
+	crypter.mu.RLock()
+	defer crypter.mu.RUnlock()
+
+	if crypter.Key == nil {
+		return nil, ErrWiped
+	}
+
 	// generate a new aes cipher using our 32 byte long key
 	c, err := aes.NewCipher(crypter.Key)
 	// if there are any errors, handle them
@@ -122,16 +146,41 @@ func CalculateHash(val []byte) ([]byte, error) {
 }
 
 func NewCryptor(keyStr string) (*Crypter, error) {
-	key := []byte(keyStr)
-	if len(key) > 32 {
-		return nil, fmt.Errorf("key cannot be more than 32 bytes, got %d length", len(key))
+	key := secret.FromString(keyStr)
+	defer key.Wipe()
+
+	return NewCryptorFromSecret(key)
+}
+
+// NewCryptorFromSecret creates a crypter whose key is kept in locked memory until Wipe is called, key itself is left
+// to the caller to wipe
+func NewCryptorFromSecret(key *secret.Buffer) (*Crypter, error) {
+	if key.Len() > 32 {
+		return nil, fmt.Errorf("key cannot be more than 32 bytes, got %d length", key.Len())
+	}
+
+	buffer := secret.New(32)
+	padded := buffer.Bytes()
+	copy(padded, key.Bytes())
+	for i := key.Len(); i < 32; i++ {
+		padded[i] = filler
 	}
 
-	for i := len(key); i < 32; i++ {
-		key = append(key, filler)
+	return &Crypter{Key: padded, buffer: buffer}, nil
+}
+
+// Wipe zeroes the key once no encryption is using it, the crypter fails with ErrWiped afterwards
+func (crypter *Crypter) Wipe() {
+	crypter.mu.Lock()
+	defer crypter.mu.Unlock()
+
+	if crypter.buffer != nil {
+		crypter.buffer.Wipe()
+	} else {
+		secret.Zero(crypter.Key)
 	}
 
-	return &Crypter{Key: key}, nil
+	crypter.Key = nil
 }
 
 func NewSoulEncrypter(keyStr string) (soul.Encrypter, error) {
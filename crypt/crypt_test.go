@@ -2,7 +2,10 @@ package crypt_test
 
 import (
 	"encoding/hex"
+	"errors"
 	"soul/crypt"
+	"soul/secret"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -46,3 +49,177 @@ func TestDecrypt(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, input, original)
 }
+
+func TestCombineWithKeyFile(t *testing.T) {
+	t.Parallel()
+
+	keyFile, err := crypt.NewKeyFile()
+	assert.Nil(t, err)
+	assert.Len(t, keyFile, crypt.KeyFileSize)
+
+	combined, err := crypt.CombineWithKeyFile(key, keyFile)
+	assert.Nil(t, err)
+	assert.NotEqual(t, key, combined)
+
+	again, err := crypt.CombineWithKeyFile(key, keyFile)
+	assert.Nil(t, err)
+	assert.Equal(t, combined, again)
+
+	otherKeyFile, err := crypt.NewKeyFile()
+	assert.Nil(t, err)
+	other, err := crypt.CombineWithKeyFile(key, otherKeyFile)
+	assert.Nil(t, err)
+	assert.NotEqual(t, combined, other)
+
+	_, err = crypt.CombineWithKeyFile(key, keyFile[:10])
+	assert.NotNil(t, err)
+}
+
+func TestSplitAndCombineShares(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("folder key material that must survive")
+	shares, err := crypt.SplitSecret(secret, 5, 3)
+	assert.Nil(t, err)
+	assert.Len(t, shares, 5)
+
+	combined, err := crypt.CombineShares([]crypt.Share{shares[4], shares[0], shares[2]})
+	assert.Nil(t, err)
+	assert.Equal(t, secret, combined)
+
+	combined, err = crypt.CombineShares(shares)
+	assert.Nil(t, err)
+	assert.Equal(t, secret, combined)
+
+	_, err = crypt.CombineShares([]crypt.Share{shares[1], shares[3], shares[1]})
+	assert.NotNil(t, err)
+
+	_, err = crypt.SplitSecret(secret, 2, 3)
+	assert.NotNil(t, err)
+}
+
+func TestShareEncoding(t *testing.T) {
+	t.Parallel()
+
+	shares, err := crypt.SplitSecret([]byte("secret"), 3, 2)
+	assert.Nil(t, err)
+
+	parsed, err := crypt.ParseShare(shares[0].String())
+	assert.Nil(t, err)
+	assert.Equal(t, shares[0], parsed)
+
+	parsed, err = crypt.ParseShare(strings.ToLower(shares[1].Text()))
+	assert.Nil(t, err)
+	assert.Equal(t, shares[1], parsed)
+
+	typo := []byte(shares[2].String())
+	if typo[10] == 'A' {
+		typo[10] = 'B'
+	} else {
+		typo[10] = 'A'
+	}
+	_, err = crypt.ParseShare(string(typo))
+	assert.NotNil(t, err)
+}
+
+func TestSealAndOpen(t *testing.T) {
+	t.Parallel()
+
+	alice, err := crypt.NewIdentity()
+	assert.Nil(t, err)
+	bob, err := crypt.NewIdentity()
+	assert.Nil(t, err)
+	eve, err := crypt.NewIdentity()
+	assert.Nil(t, err)
+
+	sealed, err := crypt.Seal([]byte("shared"), []string{alice.PublicKey(), bob.PublicKey()})
+	assert.Nil(t, err)
+
+	for _, recipient := range []*crypt.Identity{alice, bob} {
+		opened, err := recipient.Open(sealed)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("shared"), opened)
+	}
+
+	_, err = eve.Open(sealed)
+	assert.NotNil(t, err)
+
+	restored, err := crypt.IdentityFromPrivateKey(bob.PrivateKey())
+	assert.Nil(t, err)
+	assert.Equal(t, bob.PublicKey(), restored.PublicKey())
+
+	_, err = crypt.Seal([]byte("shared"), []string{alice.PublicKey()[:20]})
+	assert.NotNil(t, err)
+}
+
+func TestSignDetached(t *testing.T) {
+	t.Parallel()
+
+	key, err := crypt.NewSigningKey()
+	assert.Nil(t, err)
+	other, err := crypt.NewSigningKey()
+	assert.Nil(t, err)
+
+	data := []byte("exported notes")
+	signature, err := key.SignDetached(data)
+	assert.Nil(t, err)
+
+	signer, err := crypt.VerifyDetached(data, signature, []string{other.PublicKey(), key.PublicKey()})
+	assert.Nil(t, err)
+	assert.Equal(t, key.PublicKey(), signer)
+
+	_, err = crypt.VerifyDetached(data, signature, []string{other.PublicKey()})
+	assert.NotNil(t, err)
+
+	_, err = crypt.VerifyDetached([]byte("altered notes"), signature, []string{key.PublicKey()})
+	assert.NotNil(t, err)
+
+	restored, err := crypt.SigningKeyFromSeed(key.Seed())
+	assert.Nil(t, err)
+	assert.Nil(t, crypt.VerifySignature(key.PublicKey(), data, restored.Sign(data)))
+}
+
+func TestCryptorFromSecret(t *testing.T) {
+	t.Parallel()
+
+	key := secret.FromString("dummy key")
+	fromSecret, err := crypt.NewCryptorFromSecret(key)
+	assert.Nil(t, err)
+	fromString, err := crypt.NewCryptor("dummy key")
+	assert.Nil(t, err)
+
+	encrypted, err := fromSecret.Encrypt([]byte("data"))
+	assert.Nil(t, err)
+	decrypted, err := fromString.Decrypt(encrypted)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+
+	fromSecret.Wipe()
+	assert.Nil(t, fromSecret.Key)
+	_, err = fromSecret.Encrypt([]byte("data"))
+	assert.NotNil(t, err)
+
+	// a crypter wiped while in use fails cleanly rather than encrypting with a zeroed key
+	inUse, err := crypt.NewCryptorFromSecret(key)
+	assert.Nil(t, err)
+	errs := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			var err error
+			for err == nil {
+				_, err = inUse.Encrypt([]byte("data"))
+			}
+			errs <- err
+		}()
+	}
+	inUse.Wipe()
+	for i := 0; i < 4; i++ {
+		assert.True(t, errors.Is(<-errs, crypt.ErrWiped))
+	}
+
+	combined, err := crypt.CombineSecretWithKeyFile(key, make([]byte, crypt.KeyFileSize))
+	assert.Nil(t, err)
+	expected, err := crypt.CombineWithKeyFile("dummy key", make([]byte, crypt.KeyFileSize))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(combined.Bytes()))
+}
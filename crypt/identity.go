@@ -0,0 +1,251 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"soul"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Identity is an X25519 key pair, data can be sealed to its public key by anyone and opened only with its private key
+type Identity struct {
+	private [32]byte
+	public  [32]byte
+}
+
+var _ soul.Identity = &Identity{}
+
+const (
+	recipientPrefix = "SOULX1-"
+	sealVersion     = 1
+	// sealInfo separates the keys derived for sealed data from any other use of the same key pair
+	sealInfo = "soul sealed data v1"
+)
+
+// sealed is the format of data sealed to one or more recipients. The file key is wrapped once per recipient, the
+// stanzas carry no recipient ids, so the recipients can only be told apart by their private keys.
+type sealed struct {
+	Version   int
+	Ephemeral []byte
+	Stanzas   [][]byte
+	Body      []byte
+}
+
+// NewIdentity generates a new random identity
+func NewIdentity() (*Identity, error) {
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, private); err != nil {
+		return nil, fmt.Errorf("failed to generate private key %w", err)
+	}
+
+	return IdentityFromPrivateKey(private)
+}
+
+// IdentityFromPrivateKey restores an identity from the bytes returned by PrivateKey
+func IdentityFromPrivateKey(private []byte) (*Identity, error) {
+	if len(private) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("private key must be %d bytes, got %d", curve25519.ScalarSize, len(private))
+	}
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive public key %w", err)
+	}
+
+	identity := new(Identity)
+	copy(identity.private[:], private)
+	copy(identity.public[:], public)
+
+	return identity, nil
+}
+
+// PrivateKey gives the private key, to be stored encrypted
+func (id *Identity) PrivateKey() []byte {
+	return append([]byte(nil), id.private[:]...)
+}
+
+// PublicKey gives the public key encoded as a recipient string that others can seal data to
+func (id *Identity) PublicKey() string {
+	return encodeChecked(recipientPrefix, id.public[:])
+}
+
+// Seal encrypts plaintext so that any of the recipients, given as public key strings, can open it
+func (id *Identity) Seal(plaintext []byte, recipients []string) ([]byte, error) {
+	return Seal(plaintext, recipients)
+}
+
+// Seal encrypts plaintext so that any of the recipients, given as public key strings, can open it
+func Seal(plaintext []byte, recipients []string) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is needed")
+	}
+
+	ephemeral, err := NewIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, fileKey); err != nil {
+		return nil, fmt.Errorf("failed to generate file key %w", err)
+	}
+
+	message := sealed{Version: sealVersion, Ephemeral: ephemeral.public[:]}
+	for _, recipient := range recipients {
+		public, err := ParsePublicKey(recipient)
+		if err != nil {
+			return nil, err
+		}
+
+		wrapper, err := ephemeral.wrapper(public)
+		if err != nil {
+			return nil, err
+		}
+
+		stanza, err := wrapper.Encrypt(fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap file key %w", err)
+		}
+
+		message.Stanzas = append(message.Stanzas, stanza)
+	}
+
+	message.Body, err = (&Crypter{Key: fileKey}).Encrypt(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt body %w", err)
+	}
+
+	var encoded bytes.Buffer
+	err = gob.NewEncoder(&encoded).Encode(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sealed data %w", err)
+	}
+
+	return encoded.Bytes(), nil
+}
+
+// Open decrypts data sealed to this identity's public key
+func (id *Identity) Open(data []byte) ([]byte, error) {
+	message := new(sealed)
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sealed data %w", err)
+	}
+
+	if message.Version != sealVersion {
+		return nil, fmt.Errorf("unsupported sealed data version %d", message.Version)
+	}
+
+	if len(message.Ephemeral) != curve25519.PointSize {
+		return nil, fmt.Errorf("corrupted sealed data")
+	}
+
+	var ephemeral [32]byte
+	copy(ephemeral[:], message.Ephemeral)
+
+	shared, err := curve25519.X25519(id.private[:], ephemeral[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on key %w", err)
+	}
+
+	wrapper, err := newWrapper(shared, ephemeral, id.public)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stanza := range message.Stanzas {
+		fileKey, err := wrapper.Decrypt(stanza)
+		if err != nil {
+			continue
+		}
+
+		plaintext, err := (&Crypter{Key: fileKey}).Decrypt(message.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt body %w", err)
+		}
+
+		return plaintext, nil
+	}
+
+	return nil, fmt.Errorf("data was not sealed to this identity")
+}
+
+// wrapper gives the crypter that wraps a file key from this, ephemeral, identity to the recipient
+func (id *Identity) wrapper(recipient [32]byte) (*Crypter, error) {
+	shared, err := curve25519.X25519(id.private[:], recipient[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on key %w", err)
+	}
+
+	return newWrapper(shared, id.public, recipient)
+}
+
+func newWrapper(shared []byte, ephemeral, recipient [32]byte) (*Crypter, error) {
+	salt := append(append([]byte(nil), ephemeral[:]...), recipient[:]...)
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(sealInfo)), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive wrapping key %w", err)
+	}
+
+	return &Crypter{Key: key}, nil
+}
+
+// ParsePublicKey reads a recipient string written by PublicKey
+func ParsePublicKey(recipient string) ([32]byte, error) {
+	var public [32]byte
+	decoded, err := decodeChecked(recipientPrefix, recipient)
+	if err != nil {
+		return public, fmt.Errorf("invalid public key %w", err)
+	}
+
+	if len(decoded) != len(public) {
+		return public, fmt.Errorf("invalid public key length %d", len(decoded))
+	}
+
+	copy(public[:], decoded)
+
+	return public, nil
+}
+
+// encodeChecked encodes data with a prefix and a short checksum, using the same alphabet as recovery shares
+func encodeChecked(prefix string, data []byte) string {
+	checksum, _ := CalculateHash(append([]byte(prefix), data...))
+
+	return prefix + shareEncoding.EncodeToString(append(append([]byte(nil), data...), checksum[:shareChecksumSize]...))
+}
+
+func decodeChecked(prefix, encoded string) ([]byte, error) {
+	encoded = strings.ToUpper(strings.Join(strings.Fields(encoded), ""))
+	if !strings.HasPrefix(encoded, prefix) {
+		return nil, fmt.Errorf("expected prefix %s", prefix)
+	}
+
+	decoded, err := shareEncoding.DecodeString(strings.TrimPrefix(encoded, prefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %w", err)
+	}
+
+	if len(decoded) <= shareChecksumSize {
+		return nil, fmt.Errorf("too short")
+	}
+
+	data, checksum := decoded[:len(decoded)-shareChecksumSize], decoded[len(decoded)-shareChecksumSize:]
+	expected, err := CalculateHash(append([]byte(prefix), data...))
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(expected[:shareChecksumSize], checksum) {
+		return nil, fmt.Errorf("checksum does not match, check it for typos")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,81 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"soul/secret"
+)
+
+// KeyFileSize is the number of random bytes in a generated key file
+const KeyFileSize = 64
+
+// minKeyFileSize is the smallest key file accepted, anything shorter adds too little to the password
+const minKeyFileSize = 32
+
+// NewKeyFile generates the contents of a new random key file
+func NewKeyFile() ([]byte, error) {
+	keyFile := make([]byte, KeyFileSize)
+	if _, err := io.ReadFull(rand.Reader, keyFile); err != nil {
+		return nil, fmt.Errorf("failed to generate key file %w", err)
+	}
+
+	return keyFile, nil
+}
+
+// ReadKeyFile reads a key file from path, any file of at least 32 bytes can be used as a key file
+func ReadKeyFile(path string) ([]byte, error) {
+	keyFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %w", err)
+	}
+
+	if len(keyFile) < minKeyFileSize {
+		return nil, fmt.Errorf("key file must be at least %d bytes, got %d", minKeyFileSize, len(keyFile))
+	}
+
+	return keyFile, nil
+}
+
+// CombineWithKeyFile mixes the key file contents into the password. The result is used wherever the password would
+// be, so a folder created with a key file cannot be opened with the password alone.
+func CombineWithKeyFile(password string, keyFile []byte) (string, error) {
+	buffer := secret.FromString(password)
+	defer buffer.Wipe()
+
+	combined, err := CombineSecretWithKeyFile(buffer, keyFile)
+	if err != nil {
+		return "", err
+	}
+	defer combined.Wipe()
+
+	return string(combined.Bytes()), nil
+}
+
+// CombineSecretWithKeyFile is CombineWithKeyFile for a password held in a secret buffer, the combined password is
+// returned in a new buffer for the caller to wipe
+func CombineSecretWithKeyFile(password *secret.Buffer, keyFile []byte) (*secret.Buffer, error) {
+	if len(keyFile) < minKeyFileSize {
+		return nil, fmt.Errorf("key file must be at least %d bytes, got %d", minKeyFileSize, len(keyFile))
+	}
+
+	keyFileHash, err := CalculateHash(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	mixed := append(keyFileHash, password.Bytes()...)
+	combined, err := CalculateHash(mixed)
+	secret.Zero(mixed)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := secret.New(hex.EncodedLen(len(combined)))
+	hex.Encode(encoded.Bytes(), combined)
+	secret.Zero(combined)
+
+	return encoded, nil
+}
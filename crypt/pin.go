@@ -0,0 +1,32 @@
+package crypt
+
+import (
+	"fmt"
+	"soul"
+	"soul/secret"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters for PIN keys, costly enough that guessing a short PIN offline takes real effort
+const (
+	pinTime    = 3
+	pinMemory  = 64 * 1024
+	pinThreads = 4
+	pinKeySize = 32
+)
+
+var _ soul.PINCrypterFunc = NewPINCryptor
+
+// NewPINCryptor derives a crypter from a PIN and salt with argon2id
+func NewPINCryptor(pin *secret.Buffer, salt []byte) (soul.Crypter, error) {
+	if len(salt) == 0 {
+		return nil, fmt.Errorf("salt cannot be empty")
+	}
+
+	derived := argon2.IDKey(pin.Bytes(), salt, pinTime, pinMemory, pinThreads, pinKeySize)
+	key := secret.FromBytes(derived)
+	defer key.Wipe()
+
+	return NewCryptorFromSecret(key)
+}
@@ -0,0 +1,223 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Share is one of the shares a secret is split into, any Threshold shares of the same split rebuild the secret
+type Share struct {
+	Threshold byte
+	Index     byte
+	Data      []byte
+}
+
+const (
+	sharePrefix  = "SOUL1-"
+	shareVersion = 1
+	// shareChecksumSize is the number of hash bytes appended to catch typos in a share
+	shareChecksumSize = 4
+	// shareGroupSize is the number of characters grouped together in printable shares
+	shareGroupSize = 5
+)
+
+// shareEncoding only uses upper case letters and digits, so that shares fit the alphanumeric mode of QR codes
+var shareEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// exp and log tables of GF(2^8) with the AES polynomial, generated by 3
+var gfExp, gfLog = gfTables()
+
+func gfTables() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		log[x] = byte(i)
+		// multiply by the generator 3, which is x*2 xor x
+		doubled := x << 1
+		if x&0x80 != 0 {
+			doubled ^= 0x1b
+		}
+		x ^= doubled
+	}
+
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// SplitSecret splits the secret into count shares using Shamir secret sharing, any threshold of which rebuild it while
+// fewer reveal nothing about it
+func SplitSecret(secret []byte, count, threshold int) ([]Share, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret cannot be empty")
+	}
+
+	if threshold < 2 || threshold > count {
+		return nil, fmt.Errorf("threshold must be between 2 and the number of shares, got %d of %d", threshold, count)
+	}
+
+	if count > 255 {
+		return nil, fmt.Errorf("cannot split into more than 255 shares, got %d", count)
+	}
+
+	shares := make([]Share, count)
+	for i := range shares {
+		shares[i] = Share{Threshold: byte(threshold), Index: byte(i + 1), Data: make([]byte, len(secret))}
+	}
+
+	// every byte of the secret is the constant term of its own random polynomial of degree threshold-1
+	coefficients := make([]byte, threshold)
+	for b, secretByte := range secret {
+		coefficients[0] = secretByte
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate coefficients %w", err)
+		}
+
+		for i := range shares {
+			x := shares[i].Index
+			var y byte
+			for c := len(coefficients) - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coefficients[c]
+			}
+
+			shares[i].Data[b] = y
+		}
+	}
+
+	for i := range coefficients {
+		coefficients[i] = 0
+	}
+
+	return shares, nil
+}
+
+// CombineShares rebuilds the secret from at least threshold distinct shares of the same split
+func CombineShares(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no shares given")
+	}
+
+	threshold := int(shares[0].Threshold)
+	size := len(shares[0].Data)
+	seen := make(map[byte]bool)
+	var used []Share
+	for _, share := range shares {
+		if int(share.Threshold) != threshold || len(share.Data) != size {
+			return nil, fmt.Errorf("shares belong to different splits")
+		}
+
+		if share.Index == 0 {
+			return nil, fmt.Errorf("invalid share index 0")
+		}
+
+		if seen[share.Index] {
+			continue
+		}
+
+		seen[share.Index] = true
+		used = append(used, share)
+	}
+
+	if len(used) < threshold {
+		return nil, fmt.Errorf("need %d distinct shares, got %d", threshold, len(used))
+	}
+
+	used = used[:threshold]
+
+	// lagrange interpolation at x = 0
+	secret := make([]byte, size)
+	for i, share := range used {
+		basis := byte(1)
+		for j, other := range used {
+			if i == j {
+				continue
+			}
+
+			basis = gfMul(basis, gfDiv(other.Index, other.Index^share.Index))
+		}
+
+		for b := range secret {
+			secret[b] ^= gfMul(share.Data[b], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+// String encodes the share as a single upper case string, suitable for QR codes
+func (s Share) String() string {
+	payload := append([]byte{shareVersion, s.Threshold, s.Index}, s.Data...)
+	checksum, _ := CalculateHash(payload)
+
+	return sharePrefix + shareEncoding.EncodeToString(append(payload, checksum[:shareChecksumSize]...))
+}
+
+// Text encodes the share in short groups that are easy to print and type back
+func (s Share) Text() string {
+	encoded := s.String()
+	var groups []string
+	for len(encoded) > shareGroupSize {
+		groups = append(groups, encoded[:shareGroupSize])
+		encoded = encoded[shareGroupSize:]
+	}
+
+	return strings.Join(append(groups, encoded), " ")
+}
+
+// ParseShare reads a share written by String or Text, ignoring case and white space
+func ParseShare(encoded string) (Share, error) {
+	encoded = strings.ToUpper(strings.Join(strings.Fields(encoded), ""))
+	if !strings.HasPrefix(encoded, sharePrefix) {
+		return Share{}, fmt.Errorf("not a soul recovery share")
+	}
+
+	decoded, err := shareEncoding.DecodeString(strings.TrimPrefix(encoded, sharePrefix))
+	if err != nil {
+		return Share{}, fmt.Errorf("failed to decode share %w", err)
+	}
+
+	if len(decoded) < 3+shareChecksumSize+1 {
+		return Share{}, fmt.Errorf("share is too short")
+	}
+
+	payload, checksum := decoded[:len(decoded)-shareChecksumSize], decoded[len(decoded)-shareChecksumSize:]
+	expected, err := CalculateHash(payload)
+	if err != nil {
+		return Share{}, err
+	}
+
+	if !bytes.Equal(expected[:shareChecksumSize], checksum) {
+		return Share{}, fmt.Errorf("share checksum does not match, check it for typos")
+	}
+
+	if payload[0] != shareVersion {
+		return Share{}, fmt.Errorf("unsupported share version %d", payload[0])
+	}
+
+	return Share{Threshold: payload[1], Index: payload[2], Data: payload[3:]}, nil
+}
@@ -0,0 +1,129 @@
+package crypt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"soul"
+)
+
+// SignatureType is the PEM block type of a detached signature
+const SignatureType = "SOUL SIGNATURE"
+
+const (
+	signerPrefix = "SOULS1-"
+	// signerHeader names the PEM header that carries the signer's public key
+	signerHeader = "Signer"
+)
+
+// SigningKey is an Ed25519 key pair that signs exports so that they can be checked for tampering
+type SigningKey struct {
+	private ed25519.PrivateKey
+}
+
+var _ soul.Signer = &SigningKey{}
+
+// NewSigningKey generates a new random signing key
+func NewSigningKey() (*SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key %w", err)
+	}
+
+	return &SigningKey{private: private}, nil
+}
+
+// SigningKeyFromSeed restores a signing key from the bytes returned by Seed
+func SigningKeyFromSeed(seed []byte) (*SigningKey, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("seed must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+
+	return &SigningKey{private: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// Seed gives the seed of the private key, to be stored encrypted
+func (k *SigningKey) Seed() []byte {
+	return k.private.Seed()
+}
+
+// PublicKey gives the public key encoded as a string that others add to their trusted keys
+func (k *SigningKey) PublicKey() string {
+	return encodeChecked(signerPrefix, k.private.Public().(ed25519.PublicKey))
+}
+
+// Sign signs data with the private key
+func (k *SigningKey) Sign(data []byte) []byte {
+	return ed25519.Sign(k.private, data)
+}
+
+// SignDetached signs data and armors the signature along with the signer's public key
+func (k *SigningKey) SignDetached(data []byte) ([]byte, error) {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    SignatureType,
+		Headers: map[string]string{signerHeader: k.PublicKey()},
+		Bytes:   k.Sign(data),
+	}), nil
+}
+
+// ParseSigningPublicKey reads a public key written by SigningKey.PublicKey
+func ParseSigningPublicKey(publicKey string) (ed25519.PublicKey, error) {
+	decoded, err := decodeChecked(signerPrefix, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %w", err)
+	}
+
+	if len(decoded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid signing key length %d", len(decoded))
+	}
+
+	return ed25519.PublicKey(decoded), nil
+}
+
+// VerifySignature checks that signature was made over data by the private key of publicKey
+func VerifySignature(publicKey string, data, signature []byte) error {
+	public, err := ParseSigningPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(public, data, signature) {
+		return fmt.Errorf("signature does not match")
+	}
+
+	return nil
+}
+
+// VerifyDetached checks a signature written by SignDetached against data and returns the public key that made it,
+// which has to be one of the trusted keys
+func VerifyDetached(data, signature []byte, trusted []string) (string, error) {
+	block, _ := pem.Decode(signature)
+	if block == nil || block.Type != SignatureType {
+		return "", fmt.Errorf("not a soul signature")
+	}
+
+	signer, err := ParseSigningPublicKey(block.Headers[signerHeader])
+	if err != nil {
+		return "", err
+	}
+
+	for _, trustedKey := range trusted {
+		public, err := ParseSigningPublicKey(trustedKey)
+		if err != nil {
+			return "", err
+		}
+
+		if !public.Equal(signer) {
+			continue
+		}
+
+		if !ed25519.Verify(public, data, block.Bytes) {
+			return "", fmt.Errorf("signature does not match, the export was altered")
+		}
+
+		return trustedKey, nil
+	}
+
+	return "", fmt.Errorf("signed by %s, which is not a trusted key", block.Headers[signerHeader])
+}
@@ -2,12 +2,20 @@ package disk
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"soul"
+	"soul/crdt"
 	"soul/crypt"
+	"soul/secret"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/google/uuid"
@@ -16,20 +24,64 @@ import (
 const DefaultBucketName = "temp"
 
 type NoteRepository struct {
-	encrypter  soul.Encrypter
-	decrypter  soul.Decrypter
+	encrypter soul.Encrypter
+	decrypter soul.Decrypter
+	// folderHash is the bucket key holding this folder's notes, the folder name hash unless a locator points elsewhere
 	folderHash string
-	db         *bolt.DB
+	layout     layout
+	// regionCap is the size of the region at the end of the value that a hidden folder may use
+	regionCap int
+	// protectedCap is the size of a hidden folder at the end of an outer folder that writes must not touch
+	protectedCap int
+	folder       string
+	// folderKey is the key derived from the password the folder was opened with
+	folderKey *secret.Buffer
+	// key is the key the folder is encrypted with, the folder key unless a locator hands out another one
+	key           *secret.Buffer
+	encrypterFunc func(string) (soul.Encrypter, error)
+	decrypterFunc func(string) (soul.Decrypter, error)
+	db            *bolt.DB
+	watch         *folderWatch
 	// simErr holds any error encountered during background simulation
 	simErr error
+	// simulator writes decoy folders to db, nil unless load simulation is on
+	simulator *LoadSimulator
+	// wiped is set once the keys were wiped, it is read atomically as the keys may be in use elsewhere
+	wiped int32
 }
 
 type Note struct {
 	Version int
 	ID      string
 	Text    string
+	// UpdatedAt is when the text last changed, zero for notes last written by older versions
+	UpdatedAt time.Time
+	// Revisions holds the hashes of the texts the note went through, oldest first, so that merging can tell an edit
+	// made on top of another copy from a conflicting one
+	Revisions []string
+	// History holds the texts of the latest revisions by their hash, the ancestor two diverged copies are merged from
+	History map[string]string
+	// CRDT is the encoded sequence CRDT of a conflict-free note, empty for plain text notes
+	CRDT []byte
 }
 
+// maxRevisions bounds how much of a note's history is kept
+const maxRevisions = 64
+
+// maxHistory bounds how many of the latest revisions keep their text
+const maxHistory = 32
+
+// folderLocator sends a password to a folder stored somewhere other than its folder name hash. It is kept in the
+// bucket encrypted with that password's folder key, so without the password it is just another opaque entry.
+type folderLocator struct {
+	Location string
+	Key      string
+	Padding  []byte
+}
+
+// maxLocatorPadding bounds the random padding added to locators so that their size does not give them away
+const maxLocatorPadding = 2048
+
 func (nr *NoteRepository) Update(note *soul.Note) error {
 	return nr.upsertNote(note)
 }
@@ -43,36 +95,59 @@ func (nr *NoteRepository) Create(note *soul.Note) error {
 }
 
 func (nr *NoteRepository) GetAll() ([]soul.Note, error) {
-	encrypted, err := nr.getRawFolder(nr.folderHash)
+	notes, raw, err := nr.getAll()
 	if err != nil {
 		return nil, err
 	}
 
-	if len(encrypted) == 0 {
-		return make([]soul.Note, 0), nil
-	}
+	nr.saw(raw)
+
+	return notes, nil
+}
 
-	decrypted, err := nr.decrypter.Decrypt(encrypted)
+// getAll reads the notes along with the folder value they were read from
+func (nr *NoteRepository) getAll() ([]soul.Note, []byte, error) {
+	var notes []soul.Note
+	var encrypted []byte
+	err := nr.viewFolder(func(raw []byte) error {
+		var err error
+		notes, err = nr.soulNotes(raw)
+		encrypted = raw
+
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt %w", err)
+		return nil, nil, err
+	}
+
+	return notes, encrypted, nil
+}
+
+// soulNotes reads the notes of the folder value encrypted
+func (nr *NoteRepository) soulNotes(encrypted []byte) ([]soul.Note, error) {
+	if len(encrypted) == 0 {
+		return make([]soul.Note, 0), nil
 	}
 
-	// now deserialize
 	// TODO: Dealloc diskformat
-	diskFormat := new([]Note)
-	decoder := gob.NewDecoder(bytes.NewReader(decrypted))
-	err = decoder.Decode(diskFormat)
+	diskFormat, _, err := nr.readFolder(encrypted)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode notes %w", err)
+		return nil, err
 	}
 
 	// convert from disk to soul
 	var notes []soul.Note
-	for _, note := range *diskFormat {
+	for _, note := range diskFormat {
+		doc, err := decodeDoc(note)
+		if err != nil {
+			return nil, err
+		}
+
 		notes = append(notes, soul.Note{
 			ID:      note.ID,
 			Version: soul.Version(note.Version),
 			Text:    soul.NewBindingFromString(note.Text),
+			Doc:     doc,
 		})
 	}
 
@@ -80,7 +155,7 @@ func (nr *NoteRepository) GetAll() ([]soul.Note, error) {
 }
 
 func (nr *NoteRepository) UpdateAll(notes []soul.Note) error {
-	err := nr.db.Update(func(tx *bolt.Tx) error {
+	err := nr.update(func(tx *bolt.Tx) error {
 		return nr.saveAllTx(tx, notes)
 	})
 
@@ -91,60 +166,335 @@ func (nr *NoteRepository) UpdateAll(notes []soul.Note) error {
 	return nil
 }
 
+// wiper is implemented by encrypters and decrypters that can forget their key
+type wiper interface {
+	Wipe()
+}
+
+// ErrWiped is returned by a repository whose keys were wiped
+var ErrWiped = errors.New("repository was wiped, log in again")
+
+// Wipe wipes the keys of this repository once the transactions under way are done, every call afterwards fails with
+// ErrWiped
+func (nr *NoteRepository) Wipe() {
+	// the simulator waits for the db lock to finish its write, so it is stopped before taking it
+	if nr.simulator != nil {
+		nr.simulator.Stop()
+	}
+
+	nr.watch.dbMu.Lock()
+	defer nr.watch.dbMu.Unlock()
+
+	atomic.StoreInt32(&nr.wiped, 1)
+	wipeKey(nr.key, nr.encrypter, nr.decrypter)
+	nr.folderKey.Wipe()
+}
+
+// wipeKey wipes a key along with the crypters made from it
+func wipeKey(key *secret.Buffer, crypters ...interface{}) {
+	key.Wipe()
+	for _, crypter := range crypters {
+		if w, ok := crypter.(wiper); ok {
+			w.Wipe()
+		}
+	}
+}
+
+// Close wipes the keys and closes the db, which releases the lock on its file so that it can be opened again
+func (nr *NoteRepository) Close() error {
+	nr.Wipe()
+
+	nr.watch.dbMu.Lock()
+	defer nr.watch.dbMu.Unlock()
+
+	err := nr.db.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close db %w", err)
+	}
+
+	return nil
+}
+
+// isWiped tells whether Wipe was called
+func (nr *NoteRepository) isWiped() bool {
+	return atomic.LoadInt32(&nr.wiped) != 0
+}
+
+// wipedOr gives ErrWiped in place of err when the keys were wiped while in use
+func (nr *NoteRepository) wipedOr(err error) error {
+	if nr.isWiped() {
+		return ErrWiped
+	}
+
+	return err
+}
+
 func (nr *NoteRepository) saveAllTx(tx *bolt.Tx, notes []soul.Note) error {
-	// TODO: Dealloc disk format after use
+	diskFormat, err := toDiskNotes(notes)
+	if err != nil {
+		return err
+	}
+
+	b := tx.Bucket([]byte(DefaultBucketName))
+	stored, meta, err := nr.readFolder(b.Get([]byte(nr.folderHash)))
+	if err != nil {
+		return err
+	}
+
+	diskFormat, err = trackRevisions(stored, diskFormat, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nr.writeFolderTx(tx, diskFormat, meta)
+}
+
+// trackRevisions carries the history of the stored notes over to the notes about to be written, notes whose text
+// changed get a new version and revision
+func trackRevisions(stored, notes []Note, now time.Time) ([]Note, error) {
+	previous := make(map[string]Note, len(stored))
+	for _, note := range stored {
+		previous[note.ID] = note
+	}
+
+	for i := range notes {
+		note := &notes[i]
+		prev, ok := previous[note.ID]
+		if ok && prev.Text == note.Text {
+			note.Version, note.UpdatedAt, note.Revisions, note.History = prev.Version, prev.UpdatedAt, prev.Revisions, prev.History
+			continue
+		}
+
+		revisions, err := noteRevisions(prev)
+		if err != nil {
+			return nil, err
+		}
+
+		revision, err := crypt.CalculateStringHash(note.Text)
+		if err != nil {
+			return nil, err
+		}
+
+		if prev.Version > note.Version {
+			note.Version = prev.Version
+		}
+		note.Version++
+		note.UpdatedAt = now
+		note.Revisions = appendRevision(revisions, revision)
+		texts := map[string]string{revision: note.Text}
+		if ok && len(revisions) != 0 {
+			texts[revisions[len(revisions)-1]] = prev.Text
+		}
+		note.History = keepHistory(note.Revisions, prev.History, texts)
+	}
+
+	return notes, nil
+}
+
+// keepHistory gathers the texts of the latest of revisions from the histories given
+func keepHistory(revisions []string, histories ...map[string]string) map[string]string {
+	kept := make(map[string]string)
+	for i := len(revisions) - 1; i >= 0 && len(kept) < maxHistory; i-- {
+		for _, history := range histories {
+			if text, ok := history[revisions[i]]; ok {
+				kept[revisions[i]] = text
+				break
+			}
+		}
+	}
+
+	return kept
+}
+
+// noteRevisions gives the history of a note, notes written before it was kept start from their current text
+func noteRevisions(note Note) ([]string, error) {
+	if len(note.Revisions) != 0 || len(note.ID) == 0 {
+		return note.Revisions, nil
+	}
+
+	revision, err := crypt.CalculateStringHash(note.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{revision}, nil
+}
+
+// appendRevision adds a revision to a copy of the history, dropping the oldest ones past maxRevisions
+func appendRevision(revisions []string, revision string) []string {
+	appended := append(append([]string(nil), revisions...), revision)
+	if len(appended) > maxRevisions {
+		appended = appended[len(appended)-maxRevisions:]
+	}
+
+	return appended
+}
+
+// readFolder opens and decodes a raw folder value, an empty value is an empty folder
+func (nr *NoteRepository) readFolder(raw []byte) ([]Note, *folderMeta, error) {
+	if len(raw) == 0 {
+		return nil, new(folderMeta), nil
+	}
+
+	decrypted, err := nr.open(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return decodeFolder(decrypted)
+}
+
+func (nr *NoteRepository) writeFolderTx(tx *bolt.Tx, notes []Note, meta *folderMeta) error {
+	encoded, err := encodeFolder(notes, meta)
+	if err != nil {
+		return err
+	}
+
+	b := tx.Bucket([]byte(DefaultBucketName))
+	encrypted, err := nr.seal(b.Get([]byte(nr.folderHash)), encoded)
+	if err != nil {
+		return err
+	}
+
+	err = b.Put([]byte(nr.folderHash), encrypted)
+
+	if err != nil {
+		return fmt.Errorf("failed to update folder %w", err)
+	}
+
+	return nil
+}
+
+func toDiskNotes(notes []soul.Note) ([]Note, error) {
 	var diskFormat []Note
 	for _, note := range notes {
 		txt, err := note.Text.Get()
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		var state []byte
+		if note.Doc != nil {
+			// edits not seen by the document yet are caught up first
+			note.Doc.SetText(txt)
+			state, err = note.Doc.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		diskFormat = append(diskFormat, Note{
 			ID:      note.ID,
 			Version: int(note.Version),
 			Text:    txt,
+			CRDT:    state,
 		})
 	}
+
+	return diskFormat, nil
+}
+
+// decodeDoc gives the document of a conflict-free note, nil for a plain text one
+func decodeDoc(note Note) (*crdt.Doc, error) {
+	if len(note.CRDT) == 0 {
+		return nil, nil
+	}
+
+	doc, err := crdt.Unmarshal(note.CRDT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode note %s %w", note.ID, err)
+	}
+
+	return doc, nil
+}
+
+// encodeFolder encodes the notes followed by the folder meta, older versions only read the notes and ignore the rest
+func encodeFolder(notes []Note, meta *folderMeta) ([]byte, error) {
 	var encoded bytes.Buffer
 	encoder := gob.NewEncoder(&encoded)
-	err := encoder.Encode(diskFormat)
+	err := encoder.Encode(notes)
 	if err != nil {
-		return fmt.Errorf("failed to encode %w", err)
+		return nil, fmt.Errorf("failed to encode %w", err)
 	}
 
-	encrypted, err := nr.encrypter.Encrypt(encoded.Bytes())
+	err = encoder.Encode(meta)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt %w", err)
+		return nil, fmt.Errorf("failed to encode folder meta %w", err)
 	}
 
-	b := tx.Bucket([]byte(DefaultBucketName))
-	err = b.Put([]byte(nr.folderHash), encrypted)
+	return encoded.Bytes(), nil
+}
 
+func decodeFolder(decrypted []byte) ([]Note, *folderMeta, error) {
+	// now deserialize
+	diskFormat := new([]Note)
+	decoder := gob.NewDecoder(bytes.NewReader(decrypted))
+	err := decoder.Decode(diskFormat)
 	if err != nil {
-		return fmt.Errorf("failed to update folder %w", err)
+		return nil, nil, fmt.Errorf("failed to decode notes %w", err)
 	}
 
-	return nil
+	meta := new(folderMeta)
+	err = decoder.Decode(meta)
+	if err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("failed to decode folder meta %w", err)
+	}
+
+	return *diskFormat, meta, nil
 }
 
 func (nr *NoteRepository) getRawFolder(folder string) ([]byte, error) {
+	nr.watch.dbMu.RLock()
+	defer nr.watch.dbMu.RUnlock()
+
+	raw, err := getRaw(nr.db, folder)
+	if err != nil {
+		// a closed repository reads like a wiped one
+		return nil, nr.wipedOr(err)
+	}
+
+	return raw, nil
+}
+
+// viewFolder hands the folder value to fn under the db lock, so that the key it is read with does not change meanwhile
+func (nr *NoteRepository) viewFolder(fn func(raw []byte) error) error {
+	nr.watch.dbMu.RLock()
+	defer nr.watch.dbMu.RUnlock()
+
+	raw, err := getRaw(nr.db, nr.folderHash)
+	if err != nil {
+		return nr.wipedOr(err)
+	}
+
+	return fn(raw)
+}
+
+func getRaw(db *bolt.DB, key string) ([]byte, error) {
 	var result []byte
-	nr.db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(DefaultBucketName))
-		fetched := b.Get([]byte(folder))
+		if b == nil {
+			// a db only read from may never have been written to
+			return nil
+		}
+
+		fetched := b.Get([]byte(key))
 		result = make([]byte, len(fetched))
 		copy(result, fetched)
 
 		return nil
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read db %w", err)
+	}
 
 	return result, nil
 }
 
 func (nr *NoteRepository) upsertNote(note *soul.Note) error {
-	err := nr.db.Update(func(tx *bolt.Tx) error {
-		existing, err := nr.GetAll()
+	err := nr.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		existing, err := nr.soulNotes(b.Get([]byte(nr.folderHash)))
 		if err != nil {
 			return err
 		}
@@ -183,53 +533,203 @@ func (nr *NoteRepository) upsertNote(note *soul.Note) error {
 func NewNoteRepository(dbPath, folder string, password string, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error)) (*NoteRepository, error) {
 	// Open the my.db data file in your current directory.
 	// It will be created if it doesn't exist.
-	db, err := bolt.Open(dbPath, 0600, nil)
+	return openNoteRepository(dbPath, folder, []byte(password), []byte(password), encrypterFunc, decrypterFunc, false, nil)
+}
+
+// NewNoteRepositoryFromSecret opens the folder with a password held in a secret buffer, the buffer is left to the caller
+// to wipe
+func NewNoteRepositoryFromSecret(dbPath, folder string, password *secret.Buffer, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error)) (*NoteRepository, error) {
+	return openNoteRepository(dbPath, folder, password.Bytes(), password.Bytes(), encrypterFunc, decrypterFunc, false, nil)
+}
+
+// NewNoteRepositoryWithKeyFile opens the folder with the password mixed with the key file, the password alone is what the
+// policy checks. The buffer is left to the caller to wipe.
+func NewNoteRepositoryWithKeyFile(dbPath, folder string, password *secret.Buffer, keyFile []byte, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error)) (*NoteRepository, error) {
+	combined, err := crypt.CombineSecretWithKeyFile(password, keyFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to init db %w", err)
+		return nil, err
 	}
+	defer combined.Wipe()
 
-	return newNoteRepository(db, folder, password, encrypterFunc, decrypterFunc, false, nil)
+	return openNoteRepository(dbPath, folder, combined.Bytes(), password.Bytes(), encrypterFunc, decrypterFunc, false, nil)
 }
 
 func NewNoteRepositoryWithDb(db *bolt.DB, folder string, password string, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error)) (*NoteRepository, error) {
-	return newNoteRepository(db, folder, password, encrypterFunc, decrypterFunc, false, nil)
+	return newNoteRepository(db, folder, []byte(password), []byte(password), encrypterFunc, decrypterFunc, false, nil)
 }
 
 func NewNoteRepositoryWithLoadSim(dbPath, folder string, password string, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error), enableLoadSim bool, loadSimExceptions []string) (*NoteRepository, error) {
 	// Open the my.db data file in your current directory.
 	// It will be created if it doesn't exist.
+	return openNoteRepository(dbPath, folder, []byte(password), []byte(password), encrypterFunc, decrypterFunc, enableLoadSim, loadSimExceptions)
+}
+
+func NewNoteRepositoryWithDbAndLoadSim(db *bolt.DB, folder string, password string, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error), enableLoadSim bool, loadSimExceptions []string) (*NoteRepository, error) {
+	return newNoteRepository(db, folder, []byte(password), []byte(password), encrypterFunc, decrypterFunc, enableLoadSim, loadSimExceptions)
+}
+
+// openNoteRepository opens the db file for the folder, the file stays locked until Close so it is closed again when the
+// folder cannot be opened
+func openNoteRepository(dbPath, folder string, password, typed []byte, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error), enableLoadSim bool, loadSimExceptions []string) (*NoteRepository, error) {
 	db, err := bolt.Open(dbPath, 0600, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init db %w", err)
 	}
 
-	return newNoteRepository(db, folder, password, encrypterFunc, decrypterFunc, enableLoadSim, loadSimExceptions)
+	repo, err := newNoteRepository(db, folder, password, typed, encrypterFunc, decrypterFunc, enableLoadSim, loadSimExceptions)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return repo, nil
 }
 
-func NewNoteRepositoryWithDbAndLoadSim(db *bolt.DB, folder string, password string, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error), enableLoadSim bool, loadSimExceptions []string) (*NoteRepository, error) {
-	return newNoteRepository(db, folder, password, encrypterFunc, decrypterFunc, enableLoadSim, loadSimExceptions)
+// newNoteRepository opens the folder that password opens, typed is the password as the user typed it which the policy
+// holds a new folder to, it only differs from password when a key file is mixed in
+func newNoteRepository(db *bolt.DB, folder string, password, typed []byte, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error), enableLoadSim bool, loadSimExceptions []string) (*NoteRepository, error) {
+	err := createBucket(db)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := soul.ActivePolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	repo, raw, err := openFolder(db, folder, password, encrypterFunc, decrypterFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty folder is being created, its password is a new one
+	if len(raw) == 0 {
+		err = policy.CheckPassword(typed)
+		if err != nil {
+			repo.Wipe()
+			return nil, err
+		}
+	}
+
+	if enableLoadSim || policy.RequireDecoyTraffic {
+		err = repo.startLoadSimulation(append(loadSimExceptions, folder))
+		if err != nil {
+			repo.Wipe()
+			return nil, err
+		}
+	}
+
+	return repo, nil
+}
+
+// openFolder opens the folder that password opens in db along with its current value, db is only read
+func openFolder(db *bolt.DB, folder string, password []byte, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error)) (*NoteRepository, []byte, error) {
+	folderKey, err := deriveFolderKeyFromBytes(folder, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	folderHash, key, err := resolveFolder(db, folder, folderKey, decrypterFunc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encrypter, err := encrypterFunc(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create encrypter %w", err)
+	}
+
+	decrypter, err := decrypterFunc(key)
+	if err != nil {
+		wipeKey(nil, encrypter)
+		return nil, nil, fmt.Errorf("failed to create decrypter %w", err)
+	}
+
+	raw, err := getRaw(db, folderHash)
+	if err != nil {
+		wipeKey(nil, encrypter, decrypter)
+		return nil, nil, err
+	}
+
+	folderLayout, regionCap := detectLayout(decrypter, raw)
+
+	return &NoteRepository{
+		encrypter:     encrypter,
+		decrypter:     decrypter,
+		db:            db,
+		watch:         newFolderWatch(db),
+		folderHash:    folderHash,
+		layout:        folderLayout,
+		regionCap:     regionCap,
+		folder:        folder,
+		folderKey:     secret.FromString(folderKey),
+		key:           secret.FromString(key),
+		encrypterFunc: encrypterFunc,
+		decrypterFunc: decrypterFunc,
+	}, raw, nil
+}
+
+// startLoadSimulation writes decoy entries to the db in the background until the repository is wiped, it only ever
+// changes entries it wrote itself
+func (nr *NoteRepository) startLoadSimulation(exceptions []string) error {
+	simulator, err := NewLoadSimulator(nr.db, exceptions, func(key string) (soul.Encrypter, error) {
+		crypter, err := crypt.NewCryptor(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return crypter, nil
+	}, func(err error) {
+		nr.simErr = err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// the db is swapped when its file is replaced and goes away with the repository, writes follow it
+	simulator.update = nr.updateDb
+	simulator.Start()
+	nr.simulator = simulator
+
+	return nil
+}
+
+// checkPassword holds a password that is about to open the folder against the active policy
+func checkPassword(password []byte) error {
+	policy, err := soul.ActivePolicy()
+	if err != nil {
+		return err
+	}
+
+	return policy.CheckPassword(password)
 }
 
-func newNoteRepository(db *bolt.DB, folder string, password string, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error), enableLoadSim bool, loadSimExceptions []string) (*NoteRepository, error) {
-	err := db.Update(func(tx *bolt.Tx) error {
+func createBucket(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte(DefaultBucketName))
 		if err != nil {
 			return fmt.Errorf("failed to create bucket: %w", err)
 		}
 		return nil
 	})
-	if err != nil {
-		return nil, err
-	}
+}
 
-	passwordPartialHash, err := crypt.CalculateHash([]byte(password))
+// deriveFolderKey mixes the password with the folder name so that the same password gives a different key per folder
+func deriveFolderKey(folder, password string) (string, error) {
+	return deriveFolderKeyFromBytes(folder, []byte(password))
+}
+
+func deriveFolderKeyFromBytes(folder string, password []byte) (string, error) {
+	passwordPartialHash, err := crypt.CalculateHash(password)
 	if err != nil {
-		return nil, fmt.Errorf("unable to hash pwd %w", err)
+		return "", fmt.Errorf("unable to hash pwd %w", err)
 	}
 
 	passwordStep2, err := crypt.CalculateHash(append(passwordPartialHash, []byte(folder)...))
 	if err != nil {
-		return nil, fmt.Errorf("unable to hash pwd %w", err)
+		return "", fmt.Errorf("unable to hash pwd %w", err)
 	}
 
 	var finalPassword []byte
@@ -237,49 +737,205 @@ func newNoteRepository(db *bolt.DB, folder string, password string, encrypterFun
 		finalPassword = append(finalPassword, passwordStep2[i])
 	}
 
-	pwdByte := hex.EncodeToString(finalPassword)
+	return hex.EncodeToString(finalPassword), nil
+}
 
-	encrypter, err := encrypterFunc(pwdByte)
+// locatorHash gives the bucket key of the locator that folderKey may have for the folder
+func locatorHash(folder string, folderKey []byte) (string, error) {
+	mixed := append(append([]byte(nil), folderKey...), folder...)
+	hash, err := crypt.CalculateHash(mixed)
+	secret.Zero(mixed)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create encrypter %w", err)
+		return "", fmt.Errorf("failed to calculate locator hash %w", err)
 	}
 
-	decrypter, err := decrypterFunc(pwdByte)
+	return hex.EncodeToString(hash), nil
+}
+
+// resolveFolder finds the bucket key and the key of the folder opened by folderKey. A locator readable with folderKey
+// wins over the folder name hash, otherwise the folder name hash and folderKey itself are used as before.
+func resolveFolder(db *bolt.DB, folder, folderKey string, decrypterFunc func(string) (soul.Decrypter, error)) (string, string, error) {
+	folderHash, err := crypt.CalculateStringHash(folder)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create decrypter %w", err)
+		return "", "", fmt.Errorf("failed to calculate folder name hash %w", err)
 	}
 
-	folderHash, err := crypt.CalculateStringHash(folder)
+	locatorKey, err := locatorHash(folder, []byte(folderKey))
 	if err != nil {
-		return nil, fmt.Errorf("failed to calculate folder name hash %w", err)
+		return "", "", err
 	}
 
-	repo := &NoteRepository{
-		encrypter:  encrypter,
-		decrypter:  decrypter,
-		db:         db,
-		folderHash: folderHash,
+	encrypted, err := getRaw(db, locatorKey)
+	if err != nil {
+		return "", "", err
 	}
 
-	if enableLoadSim {
-		// start load simulation service
-		simulator, err := NewLoadSimulator(db, loadSimExceptions, func(key string) (soul.Encrypter, error) {
-			crypter, err := crypt.NewCryptor(key)
-			if err != nil {
-				return nil, err
-			}
+	if len(encrypted) == 0 {
+		return folderHash, folderKey, nil
+	}
 
-			return crypter, nil
-		}, func(err error) {
-			repo.simErr = err
-		})
+	decrypter, err := decrypterFunc(folderKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create decrypter %w", err)
+	}
+
+	decrypted, err := decrypter.Decrypt(encrypted)
+	if err != nil {
+		// not a locator of ours, just an entry that happens to share the key
+		return folderHash, folderKey, nil
+	}
+
+	locator := new(folderLocator)
+	err = gob.NewDecoder(bytes.NewReader(decrypted)).Decode(locator)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode locator %w", err)
+	}
+
+	return locator.Location, locator.Key, nil
+}
+
+// RegisterDuressPassword makes duressPassword open a separate decoy folder under the same folder name, seeded with
+// decoyNotes so that it is believable on its own. The decoy is padded to the size class of the real folder, the real
+// folder keeps no record of it, and the decoy and its locator look like any other entry in the bucket.
+func (nr *NoteRepository) RegisterDuressPassword(duressPassword string, decoyNotes []string) error {
+	if len(strings.TrimSpace(duressPassword)) == 0 {
+		return fmt.Errorf("duress password cannot be empty")
+	}
+
+	err := checkPassword([]byte(duressPassword))
+	if err != nil {
+		return err
+	}
+
+	duressKey, err := deriveFolderKey(nr.folder, duressPassword)
+	if err != nil {
+		return err
+	}
+
+	if duressKey == string(nr.folderKey.Bytes()) {
+		return fmt.Errorf("duress password must differ from the folder password")
+	}
+
+	decrypter, err := nr.decrypterFunc(duressKey)
+	if err != nil {
+		return fmt.Errorf("failed to create decrypter %w", err)
+	}
+
+	existing, err := nr.getRawFolder(nr.folderHash)
+	if err != nil {
+		return err
+	}
+
+	if len(existing) != 0 && opensFolder(decrypter, existing) {
+		return fmt.Errorf("duress password already opens this folder")
+	}
+
+	encrypter, err := nr.encrypterFunc(duressKey)
+	if err != nil {
+		return fmt.Errorf("failed to create encrypter %w", err)
+	}
+
+	location, err := randomHash()
+	if err != nil {
+		return err
+	}
+
+	decoy, err := sealDecoy(encrypter, decoyNotes, sizeClass(len(existing)))
+	if err != nil {
+		return err
+	}
+
+	locatorKey, err := locatorHash(nr.folder, []byte(duressKey))
+	if err != nil {
+		return err
+	}
+
+	locator, err := encryptLocator(encrypter, &folderLocator{Location: location, Key: duressKey})
+	if err != nil {
+		return err
+	}
 
+	return nr.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		err := b.Put([]byte(location), decoy)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to store decoy folder %w", err)
+		}
+
+		err = b.Put([]byte(locatorKey), locator)
+		if err != nil {
+			return fmt.Errorf("failed to store locator %w", err)
 		}
 
-		simulator.Start()
+		return nil
+	})
+}
+
+// sealDecoy gives a padded folder value holding texts as notes, at least size bytes long
+func sealDecoy(encrypter soul.Encrypter, texts []string, size int) ([]byte, error) {
+	var notes []Note
+	for _, text := range texts {
+		notes = append(notes, Note{ID: uuid.NewString(), Text: text})
 	}
 
-	return repo, nil
+	notes, err := trackRevisions(nil, notes, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := encodeFolder(notes, new(folderMeta))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := encrypter.Encrypt(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt %w", err)
+	}
+
+	if used := sizeClass(headerSize + len(body)); used > size {
+		size = used
+	}
+
+	raw, err := padding(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealOuter(encrypter, raw, body, 0)
+}
+
+func encryptLocator(encrypter soul.Encrypter, locator *folderLocator) ([]byte, error) {
+	paddingLen, err := rand.Int(rand.Reader, big.NewInt(maxLocatorPadding))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pick padding length %w", err)
+	}
+
+	locator.Padding = make([]byte, paddingLen.Int64())
+	if _, err = io.ReadFull(rand.Reader, locator.Padding); err != nil {
+		return nil, fmt.Errorf("failed to generate padding %w", err)
+	}
+
+	var encoded bytes.Buffer
+	err = gob.NewEncoder(&encoded).Encode(locator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode locator %w", err)
+	}
+
+	encrypted, err := encrypter.Encrypt(encoded.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt locator %w", err)
+	}
+
+	return encrypted, nil
+}
+
+// randomHash gives a random bucket key that is indistinguishable from a folder name hash
+func randomHash() (string, error) {
+	random := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return "", fmt.Errorf("failed to generate random key %w", err)
+	}
+
+	return hex.EncodeToString(random), nil
 }
@@ -1,11 +1,20 @@
 package disk_test
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
 	"soul"
 	"soul/crypt"
 	"soul/disk"
+	"soul/secret"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/google/uuid"
@@ -33,6 +42,19 @@ func TestReadWrite(t *testing.T) {
 	assert.NotEmpty(t, updated)
 }
 
+// openPadded decrypts the notes of a padded folder value, which follow a header holding their length
+func openPadded(decrypter soul.Decrypter, value []byte) error {
+	const headerSize = 12 + 8 + 16
+	header, err := decrypter.Decrypt(value[:headerSize])
+	if err != nil {
+		return err
+	}
+
+	_, err = decrypter.Decrypt(value[headerSize : headerSize+int(binary.BigEndian.Uint32(header))])
+
+	return err
+}
+
 func TestShouldGenerateDiffPassword(t *testing.T) {
 	t.Parallel()
 
@@ -67,7 +89,6 @@ func TestShouldGenerateDiffPassword(t *testing.T) {
 		b := tx.Bucket([]byte(disk.DefaultBucketName))
 		count := 0
 		b.ForEach(func(k, v []byte) error {
-			fmt.Println(k, v)
 			count++
 
 			keyStr := string(k)
@@ -76,23 +97,21 @@ func TestShouldGenerateDiffPassword(t *testing.T) {
 			case folder1Hash:
 				fetched := b.Get([]byte(folder1Hash))
 				decrypter, _ := crypt.NewSoulDecrypter(folder1Pwd)
-				_, err := decrypter.Decrypt(fetched)
-				assert.Nil(t, err)
+				assert.Nil(t, openPadded(decrypter, fetched))
 
 				//ensure vise versa is not possible
 				decrypter2, _ := crypt.NewSoulDecrypter(folder2Pwd)
-				_, err = decrypter2.Decrypt(fetched)
+				err := openPadded(decrypter2, fetched)
 				assert.NotNil(t, err)
 
 			case folder2Hash:
 				fetched := b.Get([]byte(folder2Hash))
 				decrypter, _ := crypt.NewSoulDecrypter(folder2Pwd)
-				_, err := decrypter.Decrypt(fetched)
-				assert.Nil(t, err)
+				assert.Nil(t, openPadded(decrypter, fetched))
 
 				//ensure vise versa is not possible
 				decrypter2, _ := crypt.NewSoulDecrypter(folder1Pwd)
-				_, err = decrypter2.Decrypt(fetched)
+				err := openPadded(decrypter2, fetched)
 				assert.NotNil(t, err)
 			default:
 				t.Fatal("other found")
@@ -105,3 +124,1029 @@ func TestShouldGenerateDiffPassword(t *testing.T) {
 		return nil
 	})
 }
+
+func TestDuressPassword(t *testing.T) {
+	t.Parallel()
+
+	var dbPath = fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	db, err := bolt.Open(dbPath, 0600, nil)
+	assert.Nil(t, err)
+
+	folder := "folder"
+	realPwd := "real key"
+	duressPwd := "duress key"
+
+	repo, err := disk.NewNoteRepositoryWithDb(db, folder, realPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("real note")}))
+
+	assert.NotNil(t, repo.RegisterDuressPassword(realPwd, nil))
+	assert.Nil(t, repo.RegisterDuressPassword(duressPwd, []string{"groceries", "call the dentist"}))
+
+	decoyRepo, err := disk.NewNoteRepositoryWithDb(db, folder, duressPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	decoyNotes, err := decoyRepo.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, decoyNotes, 2)
+	txt, _ := decoyNotes[1].Text.Get()
+	assert.Equal(t, "call the dentist", txt)
+	assert.Nil(t, decoyRepo.Update(&soul.Note{Text: soul.NewBindingFromString("decoy note")}))
+
+	realRepo, err := disk.NewNoteRepositoryWithDb(db, folder, realPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	realNotes, err := realRepo.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, realNotes, 1)
+	txt, _ = realNotes[0].Text.Get()
+	assert.Equal(t, "real note", txt)
+
+	decoyNotes, err = decoyRepo.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, decoyNotes, 3)
+	txt, _ = decoyNotes[2].Text.Get()
+	assert.Equal(t, "decoy note", txt)
+
+	// the real folder entry is untouched, the decoy and its locator are two more opaque entries
+	count, err := disk.GetKeysCount(db)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	// the decoy is as big as the real folder, only the small locator differs
+	var sizes []int
+	db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(disk.DefaultBucketName)).ForEach(func(k, v []byte) error {
+			sizes = append(sizes, len(v))
+			return nil
+		})
+	})
+	sort.Ints(sizes)
+	assert.Equal(t, sizes[1], sizes[2])
+}
+
+func TestHiddenFolder(t *testing.T) {
+	t.Parallel()
+
+	var dbPath = fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	db, err := bolt.Open(dbPath, 0600, nil)
+	assert.Nil(t, err)
+
+	folder := "folder"
+	outerPwd := "outer key"
+	hiddenPwd := "hidden key"
+
+	outer, err := disk.NewNoteRepositoryWithDb(db, folder, outerPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, outer.Update(&soul.Note{Text: soul.NewBindingFromString("outer note")}))
+	space, err := outer.HiddenFolderSpace()
+	assert.Nil(t, err)
+	assert.NotNil(t, outer.CreateHiddenFolder(outerPwd, 4096))
+	assert.NotNil(t, outer.CreateHiddenFolder(hiddenPwd, space+1))
+	assert.Nil(t, outer.CreateHiddenFolder(hiddenPwd, 4096))
+
+	hidden, err := disk.NewNoteRepositoryWithDb(db, folder, hiddenPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	notes, err := hidden.GetAll()
+	assert.Nil(t, err)
+	assert.Empty(t, notes)
+	assert.Nil(t, hidden.Update(&soul.Note{Text: soul.NewBindingFromString("hidden note")}))
+	assert.NotNil(t, hidden.Update(&soul.Note{Text: soul.NewBindingFromString(disk.Lorel + disk.Lorel)}))
+
+	// an outer folder opened without the hidden password keeps the padding as it is
+	reopened, err := disk.NewNoteRepositoryWithDb(db, folder, outerPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, reopened.Update(&soul.Note{Text: soul.NewBindingFromString("another outer note")}))
+	notes, err = reopened.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, notes, 2)
+
+	notes, err = hidden.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, notes, 1)
+	txt, _ := notes[0].Text.Get()
+	assert.Equal(t, "hidden note", txt)
+
+	// once protected, the outer folder refuses to grow into the hidden one
+	assert.NotNil(t, reopened.ProtectHiddenFolder("wrong key"))
+	assert.Nil(t, reopened.ProtectHiddenFolder(hiddenPwd))
+	err = reopened.Update(&soul.Note{Text: soul.NewBindingFromString(strings.Repeat("x", space-2048))})
+	assert.True(t, errors.Is(err, disk.ErrHiddenFolderProtected))
+
+	notes, err = hidden.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, notes, 1)
+
+	// growing past its padding moves the padding, and the folder hiding in it, to the end of a bigger value
+	unprotected, err := disk.NewNoteRepositoryWithDb(db, folder, outerPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, unprotected.Update(&soul.Note{Text: soul.NewBindingFromString(strings.Repeat("y", 2*space))}))
+	notes, err = hidden.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, notes, 1)
+}
+
+func TestHiddenFolderDeniable(t *testing.T) {
+	t.Parallel()
+
+	folder := "folder"
+	outerPwd := "outer key"
+
+	// two copies of the same folder, only one of them hides another folder
+	open := func() (*bolt.DB, *disk.NoteRepository) {
+		db, err := bolt.Open(fmt.Sprintf("./tmp/%s.db", uuid.NewString()), 0600, nil)
+		assert.Nil(t, err)
+		repo, err := disk.NewNoteRepositoryWithDb(db, folder, outerPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		assert.Nil(t, err)
+		assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("outer note")}))
+
+		return db, repo
+	}
+	plainDb, plain := open()
+	withHiddenDb, withHidden := open()
+	assert.Nil(t, withHidden.CreateHiddenFolder("hidden key", 64<<10))
+
+	value := func(db *bolt.DB) []byte {
+		var value []byte
+		db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(disk.DefaultBucketName)).ForEach(func(k, v []byte) error {
+				value = append([]byte(nil), v...)
+				return nil
+			})
+		})
+
+		return value
+	}
+
+	// the outer password sees the same notes, the same size and the same free padding either way
+	assert.Equal(t, len(value(plainDb)), len(value(withHiddenDb)))
+	for _, db := range []*bolt.DB{plainDb, withHiddenDb} {
+		reopened, err := disk.NewNoteRepositoryWithDb(db, folder, outerPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		assert.Nil(t, err)
+		notes, err := reopened.GetAll()
+		assert.Nil(t, err)
+		assert.Len(t, notes, 1)
+	}
+
+	plainSpace, err := plain.HiddenFolderSpace()
+	assert.Nil(t, err)
+	withHiddenSpace, err := withHidden.HiddenFolderSpace()
+	assert.Nil(t, err)
+	assert.Equal(t, plainSpace, withHiddenSpace)
+}
+
+func TestKeySlots(t *testing.T) {
+	t.Parallel()
+
+	var dbPath = fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	db, err := bolt.Open(dbPath, 0600, nil)
+	assert.Nil(t, err)
+
+	folder := "shared"
+	ownerPwd := "owner key"
+	teamPwd := "team key"
+
+	open := func(pwd string) []soul.Note {
+		repo, err := disk.NewNoteRepositoryWithDb(db, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		assert.Nil(t, err)
+		notes, err := repo.GetAll()
+		if err != nil {
+			return nil
+		}
+
+		return notes
+	}
+
+	owner, err := disk.NewNoteRepositoryWithDb(db, folder, ownerPwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, owner.Update(&soul.Note{Text: soul.NewBindingFromString("shared note")}))
+
+	slots, err := owner.ListKeySlots()
+	assert.Nil(t, err)
+	assert.Len(t, slots, 1)
+	assert.NotNil(t, owner.RevokeKeySlot(0))
+
+	assert.NotNil(t, owner.AddKeySlot(ownerPwd))
+	assert.Nil(t, owner.AddKeySlot(teamPwd))
+	assert.NotNil(t, owner.AddKeySlot(teamPwd))
+	assert.Len(t, open(ownerPwd), 1)
+	assert.Len(t, open(teamPwd), 1)
+
+	// the owner keeps writing with the master key
+	assert.Nil(t, owner.Update(&soul.Note{Text: soul.NewBindingFromString("second note")}))
+	assert.Len(t, open(teamPwd), 2)
+
+	slots, err = owner.ListKeySlots()
+	assert.Nil(t, err)
+	assert.Len(t, slots, 2)
+	assert.True(t, slots[0].Current)
+	assert.False(t, slots[1].Current)
+
+	assert.Nil(t, owner.RevokeKeySlot(1))
+	assert.Nil(t, open(teamPwd))
+	assert.Len(t, open(ownerPwd), 2)
+	assert.NotNil(t, owner.RevokeKeySlot(0))
+}
+
+func TestRekeyWhileReading(t *testing.T) {
+	t.Parallel()
+
+	db, err := bolt.Open(fmt.Sprintf("./tmp/%s.db", uuid.NewString()), 0600, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	// the first key slot moves the folder to a new key, reads under way keep opening it
+	for i := 0; i < 10; i++ {
+		repo, err := disk.NewNoteRepositoryWithDb(db, fmt.Sprintf("folder %d", i), "dummy key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		assert.Nil(t, err)
+		assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("note")}))
+
+		stop := make(chan struct{})
+		errs := make(chan error, 4)
+		for j := 0; j < 4; j++ {
+			go func() {
+				for {
+					select {
+					case <-stop:
+						errs <- nil
+						return
+					default:
+					}
+
+					_, err := repo.GetAll()
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+
+		assert.Nil(t, repo.AddKeySlot("another key"))
+		close(stop)
+		for j := 0; j < 4; j++ {
+			assert.Nil(t, <-errs)
+		}
+	}
+}
+
+// trackedCrypter counts its wipes
+type trackedCrypter struct {
+	*crypt.Crypter
+	wiped *int32
+}
+
+func (tc trackedCrypter) Wipe() {
+	atomic.AddInt32(tc.wiped, 1)
+	tc.Crypter.Wipe()
+}
+
+func TestRekeyWipesReplacedKey(t *testing.T) {
+	t.Parallel()
+
+	var wiped int32
+	newCrypter := func(key string) (trackedCrypter, error) {
+		crypter, err := crypt.NewCryptor(key)
+		return trackedCrypter{Crypter: crypter, wiped: &wiped}, err
+	}
+	encrypterFunc := func(key string) (soul.Encrypter, error) { return newCrypter(key) }
+	decrypterFunc := func(key string) (soul.Decrypter, error) { return newCrypter(key) }
+
+	repo, err := disk.NewNoteRepository(fmt.Sprintf("./tmp/%s.db", uuid.NewString()), "folder", "dummy key", encrypterFunc, decrypterFunc)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("note")}))
+
+	// the first key slot moves the folder to a master key, the crypters of the password key are wiped
+	assert.Nil(t, repo.AddKeySlot("another key"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&wiped))
+
+	notes, err := repo.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, notes, 1)
+
+	assert.Nil(t, repo.Close())
+	assert.Equal(t, int32(4), atomic.LoadInt32(&wiped))
+}
+
+func TestRecoverFolder(t *testing.T) {
+	t.Parallel()
+
+	var dbPath = fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	db, err := bolt.Open(dbPath, 0600, nil)
+	assert.Nil(t, err)
+
+	folder := "folder"
+	repo, err := disk.NewNoteRepositoryWithDb(db, folder, "forgotten key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("precious note")}))
+
+	recoveryKey, err := repo.RecoveryKey()
+	assert.Nil(t, err)
+	shares, err := crypt.SplitSecret(recoveryKey, 3, 2)
+	assert.Nil(t, err)
+
+	// the shares stay valid while slots are added
+	assert.Nil(t, repo.AddKeySlot("another key"))
+
+	combined, err := crypt.CombineShares([]crypt.Share{shares[2], shares[0]})
+	assert.Nil(t, err)
+	_, err = disk.RecoverFolderWithDb(db, folder, "new key", combined[:len(combined)-1], crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.NotNil(t, err)
+	_, err = disk.RecoverFolderWithDb(db, folder, "new key", combined, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+
+	recovered, err := disk.NewNoteRepositoryWithDb(db, folder, "new key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	notes, err := recovered.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, notes, 1)
+
+	slots, err := recovered.ListKeySlots()
+	assert.Nil(t, err)
+	assert.Len(t, slots, 3)
+}
+
+func TestShareNote(t *testing.T) {
+	t.Parallel()
+
+	var dbPath = fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	db, err := bolt.Open(dbPath, 0600, nil)
+	assert.Nil(t, err)
+
+	senderRepo, err := disk.NewNoteRepositoryWithDb(db, "sender", "sender key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	recipientRepo, err := disk.NewNoteRepositoryWithDb(db, "recipient", "recipient key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	otherRepo, err := disk.NewNoteRepositoryWithDb(db, "other", "other key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+
+	sender := soul.NewNoteService(senderRepo)
+	recipient := soul.NewNoteService(recipientRepo)
+	other := soul.NewNoteService(otherRepo)
+
+	recipientIdentity, err := recipient.Identity()
+	assert.Nil(t, err)
+
+	// the identity is stored with the folder
+	reopened, err := recipientRepo.Identity()
+	assert.Nil(t, err)
+	assert.Equal(t, recipientIdentity.PublicKey(), reopened.PublicKey())
+
+	note := &soul.Note{Text: soul.NewBindingFromString("for your eyes only")}
+	armored, err := sender.ShareNote(note, []string{recipientIdentity.PublicKey()})
+	assert.Nil(t, err)
+	assert.Contains(t, armored, soul.SharedNoteType)
+
+	_, err = other.ImportNote(armored)
+	assert.NotNil(t, err)
+
+	imported, err := recipient.ImportNote(armored)
+	assert.Nil(t, err)
+	text, err := imported.Text.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "for your eyes only", text)
+
+	notes, err := recipientRepo.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, notes, 1)
+}
+
+func TestSignedExport(t *testing.T) {
+	t.Parallel()
+
+	var dbPath = fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	repo, err := disk.NewNoteRepository(dbPath, "folder", "dummy key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("first")}))
+	assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("second")}))
+
+	service := soul.NewNoteService(repo)
+	data, signature, err := service.SignedExport()
+	assert.Nil(t, err)
+
+	signer, err := repo.SigningKey()
+	assert.Nil(t, err)
+	_, err = crypt.VerifyDetached(data, signature, []string{signer.PublicKey()})
+	assert.Nil(t, err)
+
+	export, err := soul.ReadExport(data)
+	assert.Nil(t, err)
+	assert.Len(t, export.Notes, 2)
+
+	// the signing key is kept with the folder, so later exports verify against the same key
+	single, again, err := service.SignedExport(export.Notes[0].ID)
+	assert.Nil(t, err)
+	_, err = crypt.VerifyDetached(single, again, []string{signer.PublicKey()})
+	assert.Nil(t, err)
+	_, err = crypt.VerifyDetached(data, again, []string{signer.PublicKey()})
+	assert.NotNil(t, err)
+}
+
+func TestRepositoryFromSecret(t *testing.T) {
+	t.Parallel()
+
+	var dbPath = fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	password := secret.FromString("dummy key")
+	repo, err := disk.NewNoteRepositoryFromSecret(dbPath, "folder", password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	password.Wipe()
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("note")}))
+
+	// reads and writes under way when the keys are wiped end with ErrWiped
+	errs := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			var err error
+			for err == nil {
+				if i%2 == 0 {
+					_, err = repo.GetAll()
+				} else {
+					err = repo.Update(&soul.Note{Text: soul.NewBindingFromString("note")})
+				}
+			}
+			errs <- err
+		}(i)
+	}
+	repo.Wipe()
+	for i := 0; i < 4; i++ {
+		assert.True(t, errors.Is(<-errs, disk.ErrWiped))
+	}
+
+	_, err = repo.GetAll()
+	assert.True(t, errors.Is(err, disk.ErrWiped))
+	assert.True(t, errors.Is(repo.Update(&soul.Note{Text: soul.NewBindingFromString("note")}), disk.ErrWiped))
+}
+
+func TestCloseReleasesDb(t *testing.T) {
+	t.Parallel()
+
+	var dbPath = fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+
+	// opening waits on the lock of a file that is still open, which would hang the test
+	open := func() (*disk.NoteRepository, error) {
+		type opened struct {
+			repo *disk.NoteRepository
+			err  error
+		}
+		result := make(chan opened, 1)
+		go func() {
+			repo, err := disk.NewNoteRepository(dbPath, "folder", "dummy key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+			result <- opened{repo, err}
+		}()
+
+		select {
+		case r := <-result:
+			return r.repo, r.err
+		case <-time.After(5 * time.Second):
+			return nil, fmt.Errorf("db file still locked")
+		}
+	}
+
+	repo, err := open()
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("note")}))
+	assert.Nil(t, repo.Close())
+
+	_, err = repo.GetAll()
+	assert.True(t, errors.Is(err, disk.ErrWiped))
+
+	repo, err = open()
+	assert.Nil(t, err)
+	notes, err := repo.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, notes, 1)
+	assert.Nil(t, repo.Close())
+
+	// a failed open leaves the file unlocked
+	_, err = disk.RecoverFolder(dbPath, "folder", "new password", []byte("short"), crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.NotNil(t, err)
+
+	repo, err = open()
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Close())
+}
+
+// TestPolicy is not parallel, the policy file is picked through the environment
+func TestPolicy(t *testing.T) {
+	var dbPath = fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	db, err := bolt.Open(dbPath, 0600, nil)
+	assert.Nil(t, err)
+
+	// a folder made before the policy keeps opening with its weak password
+	repo, err := disk.NewNoteRepositoryWithDb(db, "old", "weak", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Update(&soul.Note{Text: soul.NewBindingFromString("old note")}))
+	recoveryKey, err := repo.RecoveryKey()
+	assert.Nil(t, err)
+
+	policyPath := fmt.Sprintf("./tmp/%s.json", uuid.NewString())
+	assert.Nil(t, ioutil.WriteFile(policyPath, []byte(`{"min_password_length": 10, "min_password_classes": 3}`), 0600))
+	os.Setenv(soul.PolicyEnvVar, policyPath)
+	defer os.Unsetenv(soul.PolicyEnvVar)
+
+	_, err = disk.NewNoteRepositoryWithDb(db, "new", "weak", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	var policyErr *soul.PolicyError
+	assert.True(t, errors.As(err, &policyErr))
+	_, err = disk.NewNoteRepositoryWithDb(db, "new", "alllowercase", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.True(t, errors.As(err, &policyErr))
+	strong, err := disk.NewNoteRepositoryWithDb(db, "new", "Strong-Enough1", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+
+	// every other password that opens the folder is held to the policy too
+	assert.True(t, errors.As(strong.AddKeySlot("weak slot"), &policyErr))
+	assert.True(t, errors.As(strong.RegisterDuressPassword("weak duress", nil), &policyErr))
+	assert.True(t, errors.As(strong.CreateHiddenFolder("weak hidden", 1024), &policyErr))
+	assert.Nil(t, strong.AddKeySlot("Strong-Slot-2"))
+
+	// with a key file it is the typed password that is checked, not the one mixed with the file
+	keyFile := []byte(strings.Repeat("key file contents ", 4))
+	weak := secret.FromString("weak")
+	_, err = disk.NewNoteRepositoryWithKeyFile(fmt.Sprintf("./tmp/%s.db", uuid.NewString()), "new", weak, keyFile, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.True(t, errors.As(err, &policyErr))
+	typed := secret.FromString("Strong-Enough1")
+	withKeyFile, err := disk.NewNoteRepositoryWithKeyFile(fmt.Sprintf("./tmp/%s.db", uuid.NewString()), "new", typed, keyFile, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, withKeyFile.Close())
+
+	_, err = disk.NewNoteRepositoryWithDb(db, "old", "weak", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	_, err = disk.RecoverFolderWithDb(db, "old", "weak again", recoveryKey, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.True(t, errors.As(err, &policyErr))
+
+	// a broken policy file blocks rather than lifting the policy
+	assert.Nil(t, ioutil.WriteFile(policyPath, []byte(`{"min_password_length": `), 0600))
+	_, err = disk.NewNoteRepositoryWithDb(db, "old", "weak", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.NotNil(t, err)
+}
+
+func TestMergeFiles(t *testing.T) {
+	t.Parallel()
+
+	folder, pwd := "folder", "merge key"
+	laptopPath := fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	desktopPath := fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+
+	texts := func(path string) map[string]string {
+		db, err := bolt.Open(path, 0600, nil)
+		assert.Nil(t, err)
+		defer db.Close()
+
+		repo, err := disk.NewNoteRepositoryWithDb(db, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		assert.Nil(t, err)
+		notes, err := repo.GetAll()
+		assert.Nil(t, err)
+
+		texts := make(map[string]string)
+		for _, note := range notes {
+			texts[note.ID], _ = note.Text.Get()
+		}
+
+		return texts
+	}
+	edit := func(path string, fn func(repo *disk.NoteRepository, notes []soul.Note)) {
+		db, err := bolt.Open(path, 0600, nil)
+		assert.Nil(t, err)
+		defer db.Close()
+
+		repo, err := disk.NewNoteRepositoryWithDb(db, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		assert.Nil(t, err)
+		notes, err := repo.GetAll()
+		assert.Nil(t, err)
+		fn(repo, notes)
+	}
+	set := func(repo *disk.NoteRepository, note soul.Note, text string) {
+		assert.Nil(t, note.Text.Set(text))
+		assert.Nil(t, repo.Update(&note))
+	}
+
+	edit(laptopPath, func(repo *disk.NoteRepository, notes []soul.Note) {
+		assert.Nil(t, repo.Create(&soul.Note{Text: soul.NewBindingFromString("one")}))
+		assert.Nil(t, repo.Create(&soul.Note{Text: soul.NewBindingFromString("two\nsecond line\nthird line\n")}))
+	})
+	data, err := ioutil.ReadFile(laptopPath)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(desktopPath, data, 0600))
+
+	// the copies drift apart, both notes are edited on both but only the second one on different lines
+	edit(laptopPath, func(repo *disk.NoteRepository, notes []soul.Note) {
+		set(repo, notes[0], "one edited on the laptop")
+		set(repo, notes[1], "two on the laptop\nsecond line\nthird line\n")
+	})
+	edit(desktopPath, func(repo *disk.NoteRepository, notes []soul.Note) {
+		set(repo, notes[0], "one edited on the desktop")
+		set(repo, notes[1], "two\nsecond line\nthird line on the desktop\n")
+		assert.Nil(t, repo.Create(&soul.Note{Text: soul.NewBindingFromString("three")}))
+		assert.Nil(t, repo.RegisterDuressPassword("duress key", []string{"decoy note"}))
+	})
+
+	_, err = disk.MergeFiles(laptopPath, desktopPath, folder, "wrong key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.NotNil(t, err)
+
+	source, err := ioutil.ReadFile(desktopPath)
+	assert.Nil(t, err)
+	report, err := disk.MergeFiles(laptopPath, desktopPath, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	// the source is only read
+	data, err = ioutil.ReadFile(desktopPath)
+	assert.Nil(t, err)
+	assert.Equal(t, source, data)
+	assert.Len(t, report.Added, 1)
+	assert.Empty(t, report.Updated)
+	assert.Len(t, report.Merged, 1)
+	assert.Len(t, report.Marked, 1)
+	assert.Empty(t, report.Conflicts)
+	// the decoy folder and its locator
+	assert.Equal(t, 2, report.Entries)
+
+	merged := texts(laptopPath)
+	assert.Len(t, merged, 3)
+	assert.Equal(t, "three", merged[report.Added[0]])
+	assert.Equal(t, "two on the laptop\nsecond line\nthird line on the desktop\n", merged[report.Merged[0]])
+	assert.Equal(t, "<<<<<<< mine\none edited on the laptop\n||||||| ancestor\none\n=======\none edited on the desktop\n>>>>>>> theirs\n", merged[report.Marked[0]])
+
+	// the duress password opens its decoy in the merged file too
+	db, err := bolt.Open(laptopPath, 0600, nil)
+	assert.Nil(t, err)
+	decoyRepo, err := disk.NewNoteRepositoryWithDb(db, folder, "duress key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	decoyNotes, err := decoyRepo.GetAll()
+	assert.Nil(t, err)
+	assert.Len(t, decoyNotes, 1)
+	assert.Nil(t, db.Close())
+
+	// merging again changes nothing, merging back brings the desktop to the same notes
+	report, err = disk.MergeFiles(laptopPath, desktopPath, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Empty(t, report.Added)
+	assert.Empty(t, report.Merged)
+	assert.Empty(t, report.Marked)
+	assert.Equal(t, merged, texts(laptopPath))
+
+	report, err = disk.MergeFiles(desktopPath, laptopPath, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Len(t, report.Updated, 2)
+	assert.Empty(t, report.Marked)
+	assert.Equal(t, 0, report.Entries)
+	assert.Equal(t, merged, texts(desktopPath))
+}
+
+func TestMergeKeySlots(t *testing.T) {
+	t.Parallel()
+
+	folder, pwd := "folder", "slot merge key"
+	newPath := func() string {
+		return fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	}
+	edit := func(path, password string, fn func(repo *disk.NoteRepository)) {
+		db, err := bolt.Open(path, 0600, nil)
+		assert.Nil(t, err)
+		defer db.Close()
+
+		repo, err := disk.NewNoteRepositoryWithDb(db, folder, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		assert.Nil(t, err)
+		fn(repo)
+	}
+	count := func(path, password string) int {
+		notes := -1
+		edit(path, password, func(repo *disk.NoteRepository) {
+			all, err := repo.GetAll()
+			assert.Nil(t, err)
+			notes = len(all)
+		})
+
+		return notes
+	}
+	copyFile := func(from, to string) {
+		data, err := ioutil.ReadFile(from)
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(to, data, 0600))
+	}
+	create := func(path string, slots ...string) {
+		edit(path, pwd, func(repo *disk.NoteRepository) {
+			assert.Nil(t, repo.Create(&soul.Note{Text: soul.NewBindingFromString("note")}))
+			for _, slot := range slots {
+				assert.Nil(t, repo.AddKeySlot(slot))
+			}
+		})
+	}
+
+	// copies sharing a master key keep the slots added to either
+	laptopPath, desktopPath := newPath(), newPath()
+	create(laptopPath, "shared slot")
+	copyFile(laptopPath, desktopPath)
+	edit(desktopPath, pwd, func(repo *disk.NoteRepository) {
+		assert.Nil(t, repo.AddKeySlot("desktop slot"))
+		assert.Nil(t, repo.Create(&soul.Note{Text: soul.NewBindingFromString("desktop note")}))
+	})
+
+	_, err := disk.MergeFiles(laptopPath, desktopPath, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	for _, password := range []string{pwd, "shared slot", "desktop slot"} {
+		assert.Equal(t, 2, count(laptopPath, password))
+	}
+	edit(laptopPath, pwd, func(repo *disk.NoteRepository) {
+		slots, err := repo.ListKeySlots()
+		assert.Nil(t, err)
+		assert.Len(t, slots, 3)
+	})
+
+	// a copy without slots moves to the master key of the one with slots
+	laptopPath, desktopPath = newPath(), newPath()
+	create(laptopPath)
+	copyFile(laptopPath, desktopPath)
+	edit(desktopPath, pwd, func(repo *disk.NoteRepository) {
+		assert.Nil(t, repo.AddKeySlot("desktop slot"))
+	})
+
+	_, err = disk.MergeFiles(laptopPath, desktopPath, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count(laptopPath, pwd))
+	assert.Equal(t, 1, count(laptopPath, "desktop slot"))
+
+	// slots wrapping different master keys cannot both survive, the merge is refused
+	laptopPath, desktopPath = newPath(), newPath()
+	create(laptopPath, "laptop slot")
+	create(desktopPath, "desktop slot")
+
+	_, err = disk.MergeFiles(laptopPath, desktopPath, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, count(laptopPath, "laptop slot"))
+
+	// a slot revoked on one copy stays revoked whichever way the copies are merged
+	opens := func(path, password string) bool {
+		db, err := bolt.Open(path, 0600, nil)
+		assert.Nil(t, err)
+		defer db.Close()
+
+		repo, err := disk.NewNoteRepositoryWithDb(db, folder, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		if err != nil {
+			return false
+		}
+		notes, err := repo.GetAll()
+
+		return err == nil && len(notes) == 1
+	}
+	laptopPath, desktopPath = newPath(), newPath()
+	create(laptopPath, "shared slot", "revoked slot")
+	copyFile(laptopPath, desktopPath)
+	edit(desktopPath, pwd, func(repo *disk.NoteRepository) {
+		assert.Nil(t, repo.RevokeKeySlot(2))
+	})
+	assert.False(t, opens(desktopPath, "revoked slot"))
+
+	_, err = disk.MergeFiles(desktopPath, laptopPath, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.False(t, opens(desktopPath, "revoked slot"))
+	assert.True(t, opens(desktopPath, "shared slot"))
+
+	assert.True(t, opens(laptopPath, "revoked slot"))
+	_, err = disk.MergeFiles(laptopPath, desktopPath, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.False(t, opens(laptopPath, "revoked slot"))
+	assert.True(t, opens(laptopPath, "shared slot"))
+	edit(laptopPath, pwd, func(repo *disk.NoteRepository) {
+		slots, err := repo.ListKeySlots()
+		assert.Nil(t, err)
+		assert.Len(t, slots, 2)
+	})
+}
+
+func TestConflictFreeNotes(t *testing.T) {
+	t.Parallel()
+
+	folder, pwd := "folder", "conflict free key"
+	laptopPath := fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	desktopPath := fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+
+	open := func(path string) (*soul.NoteService, func()) {
+		db, err := bolt.Open(path, 0600, nil)
+		assert.Nil(t, err)
+
+		repo, err := disk.NewNoteRepositoryWithDb(db, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+		assert.Nil(t, err)
+		service := soul.NewNoteService(repo)
+		assert.Nil(t, service.LoadAll())
+
+		return service, func() { assert.Nil(t, db.Close()) }
+	}
+	edit := func(service *soul.NoteService, texts ...string) {
+		note := service.Notes[0]
+		for _, text := range texts {
+			assert.Nil(t, note.Text.Set(text))
+			assert.Nil(t, service.Update(&note))
+		}
+	}
+
+	service, done := open(laptopPath)
+	note, err := service.Create()
+	assert.Nil(t, err)
+	assert.Nil(t, note.Text.Set("the quick fox"))
+	assert.Nil(t, service.SetConflictFree(note, true))
+	assert.NotNil(t, service.Notes[0].Doc)
+	done()
+
+	data, err := ioutil.ReadFile(laptopPath)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(desktopPath, data, 0600))
+
+	// the same line is edited on both, which merges without conflict markers
+	service, done = open(laptopPath)
+	assert.NotNil(t, service.Notes[0].Doc)
+	edit(service, "the quick brown fox")
+	done()
+
+	service, done = open(desktopPath)
+	edit(service, "the very quick fox", "the very quick fox jumps")
+	done()
+
+	report, err := disk.MergeFiles(laptopPath, desktopPath, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Len(t, report.Merged, 1)
+	assert.Empty(t, report.Marked)
+
+	service, done = open(laptopPath)
+	text, _ := service.Notes[0].Text.Get()
+	assert.Equal(t, "the very quick brown fox jumps", text)
+
+	// back to plain text, the note merges as text again
+	assert.Nil(t, service.SetConflictFree(&service.Notes[0], false))
+	done()
+	service, done = open(laptopPath)
+	assert.Nil(t, service.Notes[0].Doc)
+	done()
+}
+
+func TestLoadSimulator(t *testing.T) {
+	t.Parallel()
+
+	db, err := bolt.Open(fmt.Sprintf("./tmp/%s.db", uuid.NewString()), 0600, nil)
+	assert.Nil(t, err)
+	repo, err := disk.NewNoteRepositoryWithDb(db, "folder", "simulated key", crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Create(&soul.Note{Text: soul.NewBindingFromString("real note")}))
+	assert.Nil(t, repo.AddKeySlot("slot key"))
+	assert.Nil(t, repo.RegisterDuressPassword("duress key", []string{"decoy note"}))
+
+	entries := func() map[string]string {
+		entries := make(map[string]string)
+		assert.Nil(t, db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(disk.DefaultBucketName)).ForEach(func(k, v []byte) error {
+				entries[string(k)] = string(v)
+				return nil
+			})
+		}))
+
+		return entries
+	}
+	before := entries()
+
+	var failures int32
+	simulator, err := disk.NewLoadSimulator(db, nil, crypt.NewSoulEncrypter, func(error) {
+		atomic.AddInt32(&failures, 1)
+	})
+	assert.Nil(t, err)
+
+	// the simulator only ever writes to entries of its own, the folder, its locators and the decoy stay as they were
+	for i := 0; i < 5; i++ {
+		simulator.Start()
+		time.Sleep(20 * time.Millisecond)
+
+		stopped := make(chan struct{})
+		go func() {
+			simulator.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(2 * time.Second):
+			t.Fatal("the simulator did not stop")
+		}
+	}
+
+	after := entries()
+	assert.Greater(t, len(after), len(before))
+	for key, value := range before {
+		assert.Equal(t, value, after[key])
+	}
+
+	// a stopped simulator leaves the db alone, so it can be closed under it
+	assert.Nil(t, db.Close())
+	simulator.Stop()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&failures))
+}
+
+func TestWatchChanges(t *testing.T) {
+	t.Parallel()
+
+	folder, pwd := "folder", "watched key"
+	texts := func(repo soul.NoteRepository) []string {
+		notes, err := repo.GetAll()
+		assert.Nil(t, err)
+
+		var texts []string
+		for _, note := range notes {
+			text, _ := note.Text.Get()
+			texts = append(texts, text)
+		}
+
+		return texts
+	}
+	changed := func(repo soul.ChangeDetector) bool {
+		changed, err := repo.Changed()
+		assert.Nil(t, err)
+
+		return changed
+	}
+
+	// two repositories on the same db, as a peer or a merge writing next to the app would be
+	db, err := bolt.Open(fmt.Sprintf("./tmp/%s.db", uuid.NewString()), 0600, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	app, err := disk.NewNoteRepositoryWithDb(db, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	other, err := disk.NewNoteRepositoryWithDb(db, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+
+	assert.Empty(t, texts(app))
+	note := soul.Note{Text: soul.NewBindingFromString("written by the app")}
+	assert.Nil(t, app.Create(&note))
+	assert.False(t, changed(app))
+
+	assert.Nil(t, other.Create(&soul.Note{Text: soul.NewBindingFromString("written elsewhere")}))
+	assert.True(t, changed(app))
+	assert.Len(t, texts(app), 2)
+	assert.False(t, changed(app))
+
+	// the app's own writes besides notes are not taken for someone else's, nor are writes that were rolled back
+	_, err = app.Identity()
+	assert.Nil(t, err)
+	assert.Nil(t, app.RegisterDuressPassword("duress key", nil))
+	assert.NotNil(t, app.CreateHiddenFolder("hidden key", 1<<30))
+	assert.Nil(t, app.CreateHiddenFolder("hidden key", 1024))
+	assert.False(t, changed(app))
+
+	// a merge that brings nothing new is the app's own write too, one that does is an edit made elsewhere
+	_, record, err := other.Record()
+	assert.Nil(t, err)
+	_, err = app.MergeRecord(record)
+	assert.Nil(t, err)
+	assert.False(t, changed(app))
+
+	peerDb, err := bolt.Open(fmt.Sprintf("./tmp/%s.db", uuid.NewString()), 0600, nil)
+	assert.Nil(t, err)
+	defer peerDb.Close()
+	peer, err := disk.NewNoteRepositoryWithDb(peerDb, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, peer.Create(&soul.Note{Text: soul.NewBindingFromString("from a peer")}))
+	_, record, err = peer.Record()
+	assert.Nil(t, err)
+	_, err = app.MergeRecord(record)
+	assert.Nil(t, err)
+	assert.True(t, changed(app))
+	assert.Len(t, texts(app), 3)
+
+	// a write of the app that keeps someone else's still leaves the notes it read out of date
+	assert.Nil(t, other.Create(&soul.Note{Text: soul.NewBindingFromString("written elsewhere again")}))
+	assert.Nil(t, note.Text.Set("edited by the app"))
+	assert.Nil(t, app.Update(&note))
+	assert.True(t, changed(app))
+	assert.Len(t, texts(app), 4)
+
+	// a file sync tool replaces the db file with a copy holding notes from another device
+	path := fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	repo, err := disk.NewNoteRepository(path, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	service := soul.NewNoteService(repo)
+	assert.Nil(t, service.LoadAll())
+	local, err := service.Create()
+	assert.Nil(t, err)
+	assert.Nil(t, local.Text.Set("not synced yet"))
+	assert.Nil(t, service.Update(local))
+
+	copyPath := fmt.Sprintf("./tmp/%s.db", uuid.NewString())
+	copyDb, err := bolt.Open(copyPath, 0600, nil)
+	assert.Nil(t, err)
+	device, err := disk.NewNoteRepositoryWithDb(copyDb, folder, pwd, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+	assert.Nil(t, device.Create(&soul.Note{Text: soul.NewBindingFromString("from another device")}))
+	assert.Nil(t, copyDb.Close())
+	assert.Nil(t, os.Rename(copyPath, path))
+
+	report, err := service.ReloadIfChanged()
+	assert.Nil(t, err)
+	assert.Len(t, report.Added, 1)
+	assert.Len(t, service.Notes, 2)
+
+	// the notes that were only in the replaced file were merged into the new one, which is written from then on
+	assert.ElementsMatch(t, []string{"not synced yet", "from another device"}, texts(repo))
+	assert.Nil(t, local.Text.Set("synced"))
+	assert.Nil(t, service.Update(local))
+	assert.False(t, changed(repo))
+	report, err = service.ReloadIfChanged()
+	assert.Nil(t, err)
+	assert.Nil(t, report)
+
+	// key slots move the folder to another key, which is the repository's own write as well
+	assert.Nil(t, repo.AddKeySlot("slot key"))
+	assert.Nil(t, repo.AddKeySlot("another slot key"))
+	assert.Nil(t, repo.RevokeKeySlot(1))
+	assert.False(t, changed(repo))
+}
@@ -0,0 +1,441 @@
+package disk
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"soul"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// layout tells how a folder is laid out inside its bucket value
+type layout int
+
+const (
+	// layoutPlain is the whole value encrypted in one go, as folders were written before they were padded
+	layoutPlain layout = iota
+	// layoutOuter is a header and the encrypted notes at the start of the value, followed by padding
+	layoutOuter
+	// layoutHidden is the encrypted notes and a header at the very end of an outer folder's padding
+	layoutHidden
+)
+
+// headerSize is the size of an encrypted header, the nonce, 8 bytes of lengths and the GCM tag as produced by crypt.Crypter
+const headerSize = 12 + 8 + 16
+
+// minFolderSize is the smallest size class, every folder is written padded to a size class whether or not a folder
+// hides in its padding, so that the outer password alone cannot tell the two apart
+const minFolderSize = 256 << 10
+
+// sizeClass gives the size of the value a folder using n bytes is padded to, minFolderSize doubled until n fits
+func sizeClass(n int) int {
+	size := minFolderSize
+	for size < n {
+		size *= 2
+	}
+
+	return size
+}
+
+// isPadded tells whether raw is a padded folder value rather than one written before folders were padded
+func isPadded(raw []byte) bool {
+	return len(raw) >= minFolderSize && sizeClass(len(raw)) == len(raw)
+}
+
+// padding gives size random bytes
+func padding(size int) ([]byte, error) {
+	raw := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		return nil, fmt.Errorf("failed to generate padding %w", err)
+	}
+
+	return raw, nil
+}
+
+// ErrHiddenFolderProtected is returned when a write to an outer folder would overwrite its protected hidden folder
+var ErrHiddenFolderProtected = errors.New("write would overwrite the hidden folder, the outer folder is full")
+
+// detectLayout works out the layout of raw that the decrypter can open, along with the region of a hidden folder. It
+// falls back to plain so that a wrong password keeps failing the way it always has.
+func detectLayout(decrypter soul.Decrypter, raw []byte) (layout, int) {
+	if !isPadded(raw) {
+		return layoutPlain, 0
+	}
+
+	if _, _, err := openHeader(decrypter, raw[:headerSize]); err == nil {
+		return layoutOuter, 0
+	}
+
+	if _, regionCap, err := openHeader(decrypter, raw[len(raw)-headerSize:]); err == nil {
+		return layoutHidden, regionCap
+	}
+
+	return layoutPlain, 0
+}
+
+// opensFolder tells whether the decrypter opens raw, as the folder itself or as one hidden in it
+func opensFolder(decrypter soul.Decrypter, raw []byte) bool {
+	if folderLayout, _ := detectLayout(decrypter, raw); folderLayout != layoutPlain {
+		return true
+	}
+
+	_, err := decrypter.Decrypt(raw)
+
+	return err == nil
+}
+
+func (nr *NoteRepository) open(raw []byte) ([]byte, error) {
+	if nr.isWiped() {
+		return nil, ErrWiped
+	}
+
+	folderLayout := nr.layout
+	if folderLayout != layoutHidden {
+		// a folder written before folders were padded is padded on its next write
+		folderLayout = layoutPlain
+		if isPadded(raw) {
+			folderLayout = layoutOuter
+		}
+	}
+
+	if folderLayout != layoutPlain && len(raw) < headerSize {
+		return nil, fmt.Errorf("corrupted folder, value is too short")
+	}
+
+	var encrypted []byte
+	switch folderLayout {
+	case layoutOuter:
+		bodyLen, _, err := openHeader(nr.decrypter, raw[:headerSize])
+		if err != nil {
+			return nil, nr.wipedOr(err)
+		}
+
+		if headerSize+bodyLen > len(raw) {
+			return nil, fmt.Errorf("corrupted folder, body exceeds its value")
+		}
+
+		encrypted = raw[headerSize : headerSize+bodyLen]
+	case layoutHidden:
+		bodyLen, _, err := openHeader(nr.decrypter, raw[len(raw)-headerSize:])
+		if err != nil {
+			return nil, nr.wipedOr(err)
+		}
+
+		if headerSize+bodyLen > len(raw) {
+			return nil, fmt.Errorf("corrupted folder, body exceeds its value")
+		}
+
+		encrypted = raw[len(raw)-headerSize-bodyLen : len(raw)-headerSize]
+	default:
+		encrypted = raw
+	}
+
+	decrypted, err := nr.decrypter.Decrypt(encrypted)
+	if err != nil {
+		return nil, nr.wipedOr(fmt.Errorf("failed to decrypt %w", err))
+	}
+
+	return decrypted, nil
+}
+
+// seal encrypts the encoded notes and places them in the existing raw value according to the folder's layout
+func (nr *NoteRepository) seal(raw, encoded []byte) ([]byte, error) {
+	if nr.isWiped() {
+		return nil, ErrWiped
+	}
+
+	body, err := nr.encrypter.Encrypt(encoded)
+	if err != nil {
+		return nil, nr.wipedOr(fmt.Errorf("failed to encrypt %w", err))
+	}
+
+	if nr.layout == layoutHidden {
+		raw, err = sealHidden(nr.encrypter, raw, body, nr.regionCap)
+	} else {
+		raw, err = sealOuter(nr.encrypter, raw, body, nr.protectedCap)
+	}
+	if err != nil {
+		return nil, nr.wipedOr(err)
+	}
+
+	return raw, nil
+}
+
+// sealOuter writes the body at the start of raw and leaves the rest of the padding, and whatever hides in it, as it
+// is. Growing beyond the padding is refused while protectedCap is set. Otherwise the value grows to a bigger size class
+// with the old one at its end, so that a folder hiding there survives when the body did not reach it.
+func sealOuter(encrypter soul.Encrypter, raw, body []byte, protectedCap int) ([]byte, error) {
+	header, err := sealHeader(encrypter, len(body), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isPadded(raw) {
+		raw = nil
+	}
+
+	used := len(header) + len(body)
+	if used > len(raw)-protectedCap {
+		if protectedCap > 0 {
+			return nil, ErrHiddenFolderProtected
+		}
+
+		grown, err := padding(sizeClass(used + len(raw)))
+		if err != nil {
+			return nil, err
+		}
+
+		copy(grown[len(grown)-len(raw):], raw)
+		raw = grown
+	} else {
+		raw = append([]byte(nil), raw...)
+	}
+
+	copy(raw, header)
+	copy(raw[len(header):], body)
+
+	return raw, nil
+}
+
+// sealHidden writes the body and its header at the end of raw, within the last regionCap bytes
+func sealHidden(encrypter soul.Encrypter, raw, body []byte, regionCap int) ([]byte, error) {
+	header, err := sealHeader(encrypter, len(body), regionCap)
+	if err != nil {
+		return nil, err
+	}
+
+	if regionCap > len(raw) {
+		return nil, fmt.Errorf("corrupted hidden folder, region exceeds its value")
+	}
+
+	if len(header)+len(body) > regionCap {
+		return nil, fmt.Errorf("hidden folder is full, it can hold %d bytes", regionCap-len(header))
+	}
+
+	raw = append([]byte(nil), raw...)
+	regionStart := len(raw) - regionCap
+	bodyStart := len(raw) - len(header) - len(body)
+	if _, err := io.ReadFull(rand.Reader, raw[regionStart:bodyStart]); err != nil {
+		return nil, fmt.Errorf("failed to generate padding %w", err)
+	}
+
+	copy(raw[bodyStart:], body)
+	copy(raw[len(raw)-len(header):], header)
+
+	return raw, nil
+}
+
+func sealHeader(encrypter soul.Encrypter, bodyLen, regionCap int) ([]byte, error) {
+	plain := make([]byte, 8)
+	binary.BigEndian.PutUint32(plain, uint32(bodyLen))
+	binary.BigEndian.PutUint32(plain[4:], uint32(regionCap))
+
+	header, err := encrypter.Encrypt(plain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt header %w", err)
+	}
+
+	if len(header) != headerSize {
+		return nil, fmt.Errorf("encrypter is not supported for padded folders, header is %d bytes", len(header))
+	}
+
+	return header, nil
+}
+
+func openHeader(decrypter soul.Decrypter, header []byte) (int, int, error) {
+	plain, err := decrypter.Decrypt(header)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decrypt header %w", err)
+	}
+
+	if len(plain) != 8 {
+		return 0, 0, fmt.Errorf("corrupted header")
+	}
+
+	return int(binary.BigEndian.Uint32(plain)), int(binary.BigEndian.Uint32(plain[4:])), nil
+}
+
+// CreateHiddenFolder hides an empty folder, opened with hiddenPassword, in the last capacity bytes of the padding this
+// folder already has. The size of the folder and everything its password can read stay as they were, so without
+// hiddenPassword the hidden folder is indistinguishable from the padding. Any folder previously hidden in this folder
+// is lost.
+func (nr *NoteRepository) CreateHiddenFolder(hiddenPassword string, capacity int) error {
+	if nr.isWiped() {
+		return ErrWiped
+	}
+
+	if nr.layout == layoutHidden {
+		return fmt.Errorf("cannot create a hidden folder inside a hidden folder")
+	}
+
+	if len(strings.TrimSpace(hiddenPassword)) == 0 {
+		return fmt.Errorf("hidden folder password cannot be empty")
+	}
+
+	err := checkPassword([]byte(hiddenPassword))
+	if err != nil {
+		return err
+	}
+
+	hiddenKey, err := deriveFolderKey(nr.folder, hiddenPassword)
+	if err != nil {
+		return err
+	}
+
+	if hiddenKey == string(nr.folderKey.Bytes()) {
+		return fmt.Errorf("hidden folder password must differ from the folder password")
+	}
+
+	hiddenEncrypter, err := nr.encrypterFunc(hiddenKey)
+	if err != nil {
+		return fmt.Errorf("failed to create encrypter %w", err)
+	}
+
+	hiddenEncoded, err := encodeFolder(nil, new(folderMeta))
+	if err != nil {
+		return err
+	}
+
+	hiddenBody, err := hiddenEncrypter.Encrypt(hiddenEncoded)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %w", err)
+	}
+
+	err = nr.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		raw := b.Get([]byte(nr.folderHash))
+		if !isPadded(raw) {
+			// a folder written before folders were padded gets its padding first
+			notes, meta, err := nr.readFolder(raw)
+			if err != nil {
+				return err
+			}
+
+			err = nr.writeFolderTx(tx, notes, meta)
+			if err != nil {
+				return err
+			}
+
+			raw = b.Get([]byte(nr.folderHash))
+		}
+
+		free, err := nr.freeSpace(raw)
+		if err != nil {
+			return err
+		}
+
+		if capacity > free {
+			return fmt.Errorf("the folder has %d bytes of padding free, a hidden folder of %d bytes does not fit", free, capacity)
+		}
+
+		raw, err = sealHidden(hiddenEncrypter, raw, hiddenBody, capacity)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(nr.folderHash), raw)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store hidden folder %w", err)
+	}
+
+	nr.protectedCap = capacity
+
+	return nil
+}
+
+// HiddenFolderSpace gives how many bytes of this folder's padding a hidden folder can take
+func (nr *NoteRepository) HiddenFolderSpace() (int, error) {
+	if nr.isWiped() {
+		return 0, ErrWiped
+	}
+
+	var space int
+	err := nr.viewFolder(func(raw []byte) error {
+		var err error
+		if isPadded(raw) {
+			space, err = nr.freeSpace(raw)
+			return err
+		}
+
+		// the folder is padded on its next write, its body stays the same size
+		notes, meta, err := nr.readFolder(raw)
+		if err != nil {
+			return err
+		}
+
+		encoded, err := encodeFolder(notes, meta)
+		if err != nil {
+			return err
+		}
+
+		body, err := nr.encrypter.Encrypt(encoded)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %w", err)
+		}
+
+		used := headerSize + len(body)
+		space = sizeClass(used) - used
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return space, nil
+}
+
+// freeSpace gives the padding left after the header and the body of the padded folder raw
+func (nr *NoteRepository) freeSpace(raw []byte) (int, error) {
+	if nr.isWiped() {
+		return 0, ErrWiped
+	}
+
+	bodyLen, _, err := openHeader(nr.decrypter, raw[:headerSize])
+	if err != nil {
+		return 0, err
+	}
+
+	return len(raw) - headerSize - bodyLen, nil
+}
+
+// ProtectHiddenFolder makes writes to this outer folder fail with ErrHiddenFolderProtected instead of overwriting the
+// folder hidden in its padding. It needs the hidden folder's password, as nothing else can tell where that folder is.
+func (nr *NoteRepository) ProtectHiddenFolder(hiddenPassword string) error {
+	if nr.layout == layoutHidden {
+		return fmt.Errorf("no hidden folder opens with this password")
+	}
+
+	hiddenKey, err := deriveFolderKey(nr.folder, hiddenPassword)
+	if err != nil {
+		return err
+	}
+
+	hiddenDecrypter, err := nr.decrypterFunc(hiddenKey)
+	if err != nil {
+		return fmt.Errorf("failed to create decrypter %w", err)
+	}
+
+	raw, err := nr.getRawFolder(nr.folderHash)
+	if err != nil {
+		return err
+	}
+
+	if !isPadded(raw) {
+		return fmt.Errorf("no hidden folder opens with this password")
+	}
+
+	_, regionCap, err := openHeader(hiddenDecrypter, raw[len(raw)-headerSize:])
+	if err != nil {
+		return fmt.Errorf("no hidden folder opens with this password")
+	}
+
+	nr.protectedCap = regionCap
+
+	return nil
+}
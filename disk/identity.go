@@ -0,0 +1,81 @@
+package disk
+
+import (
+	"soul"
+	"soul/crypt"
+
+	"github.com/boltdb/bolt"
+)
+
+var _ soul.IdentityProvider = &NoteRepository{}
+var _ soul.SignerProvider = &NoteRepository{}
+
+// Identity gives the identity notes are shared to, it is created and stored with the folder on first use
+func (nr *NoteRepository) Identity() (soul.Identity, error) {
+	var identity *crypt.Identity
+	err := nr.updateMeta(func(meta *folderMeta) (bool, error) {
+		var err error
+		if len(meta.Identity) > 0 {
+			identity, err = crypt.IdentityFromPrivateKey(meta.Identity)
+			return false, err
+		}
+
+		identity, err = crypt.NewIdentity()
+		if err != nil {
+			return false, err
+		}
+
+		meta.Identity = identity.PrivateKey()
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// SigningKey gives the key exports of this folder are signed with, it is created and stored with the folder on first use
+func (nr *NoteRepository) SigningKey() (soul.Signer, error) {
+	var signingKey *crypt.SigningKey
+	err := nr.updateMeta(func(meta *folderMeta) (bool, error) {
+		var err error
+		if len(meta.SigningKey) > 0 {
+			signingKey, err = crypt.SigningKeyFromSeed(meta.SigningKey)
+			return false, err
+		}
+
+		signingKey, err = crypt.NewSigningKey()
+		if err != nil {
+			return false, err
+		}
+
+		meta.SigningKey = signingKey.Seed()
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return signingKey, nil
+}
+
+// updateMeta runs fn on the folder meta and writes the folder back if fn reports a change
+func (nr *NoteRepository) updateMeta(fn func(meta *folderMeta) (bool, error)) error {
+	return nr.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		notes, meta, err := nr.readFolder(b.Get([]byte(nr.folderHash)))
+		if err != nil {
+			return err
+		}
+
+		changed, err := fn(meta)
+		if err != nil || !changed {
+			return err
+		}
+
+		return nr.writeFolderTx(tx, notes, meta)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"soul"
 	"soul/crypt"
+	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -20,6 +21,15 @@ type LoadSimulator struct {
 	reportError   func(error)
 	exceptions    []string
 	encryptorFunc func(key string) (soul.Encrypter, error)
+	// update runs a write transaction on db, a repository routes it through its own lock on the db
+	update func(fn func(tx *bolt.Tx) error) error
+	// created holds the keys this simulator wrote, the only ones it ever changes or deletes
+	created []string
+
+	// mu guards stop and done, stop ends the writes started by Start, which close done once they have
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
 }
 
 const Lorel = `
@@ -39,8 +49,20 @@ Where can I get some?
 
 There are many variations of passages of Lorem Ipsum available, but the majority have suffered alteration in some form, by injected humour, or randomised words which don't look even slightly believable. If you are going to use a passage of Lorem Ipsum, you need to be sure there isn't anything embarrassing hidden in the middle of text. All the Lorem Ipsum generators on the Internet tend to repeat predefined chunks as necessary, making this the first true generator on the Internet. It uses a dictionary of over 200 Latin words, combined with a handful of model sentence structures, to generate Lorem Ipsum which looks reasonable. The generated Lorem Ipsum is therefore always free from repetition, injected humour, or non-characteristic words etc.`
 
+// Start writes to the db in the background until Stop is called, starting a started simulator does nothing
 func (ls *LoadSimulator) Start() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.stop != nil {
+		return
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	ls.stop, ls.done = stop, done
+
 	go func() {
+		defer close(done)
 		for {
 			createOrUpdate := GetRandomNumInRange(-100, 1200)
 			err := ls.executeUpdate(createOrUpdate < 0)
@@ -50,123 +72,152 @@ func (ls *LoadSimulator) Start() {
 
 			// now decide a random number of seconds to sleep and execute again
 			randomSleepSeconds := GetRandomNumInRange(0, 4)
-			time.Sleep(time.Duration(randomSleepSeconds) * time.Second)
+			select {
+			case <-time.After(time.Duration(randomSleepSeconds) * time.Second):
+			case <-stop:
+				return
+			}
 		}
 	}()
 }
 
+// Stop stops the writes started by Start, waiting for the one under way. Stopping a stopped simulator does nothing.
+func (ls *LoadSimulator) Stop() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.stop == nil {
+		return
+	}
+
+	close(ls.stop)
+	<-ls.done
+	ls.stop, ls.done = nil, nil
+}
+
+// executeUpdate writes a new decoy entry or changes one written before, entries it did not write itself are never
+// touched
 func (ls *LoadSimulator) executeUpdate(createMode bool) error {
-	if createMode {
-		err := ls.db.Update(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(DefaultBucketName))
+	if createMode || len(ls.created) == 0 {
+		return ls.createEntry()
+	}
 
-			newPwd := uuid.NewString()[:10]
-			encrypter, err := ls.encryptorFunc(newPwd)
-			if err != nil {
-				return fmt.Errorf("failed to create new encryptor %w", err)
-			}
+	index := GetRandomNumInRange(0, len(ls.created)-1)
+	key := []byte(ls.created[index])
+	gone := false
+	err := ls.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		v := b.Get(key)
+		if v == nil {
+			// the db file was replaced meanwhile
+			gone = true
+			return nil
+		}
 
-			key, err := crypt.CalculateHash([]byte(uuid.NewString()[:GetRandomNumInRange(4, 15)]))
-			if err != nil {
-				return err
-			}
+		newPwd := uuid.NewString()[:10]
+		encrypter, err := ls.encryptorFunc(newPwd)
+		if err != nil {
+			return fmt.Errorf("failed to create new encryptor %w", err)
+		}
 
-			v := []byte(gofakeit.Sentence(GetRandomNumInRange(50, 500)))
-			encrypted, err := encrypter.Encrypt(v)
-			if err != nil {
-				return fmt.Errorf("failed to encrypt %w", err)
+		// either increase the length, or decrease the length
+		words := GetRandomNumInRange(-100, 600)
+		if words < 0 {
+			// reduce by 300 bytes
+			reduceFactor := 300
+			if len(v) <= reduceFactor+1 {
+				gone = true
+				return b.Delete(key)
 			}
 
-			err = b.Put([]byte(key), encrypted)
-			if err != nil {
-				return fmt.Errorf("failed to put val %w", err)
-			}
+			v = v[:len(v)-reduceFactor]
+		}
 
-			return nil
-		})
+		// v belongs to the transaction, it is copied before it grows
+		v = append(append([]byte(nil), v...), []byte(gofakeit.Sentence(words))...)
+		encrypted, err := encrypter.Encrypt(v)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %w", err)
+		}
 
+		err = b.Put(key, encrypted)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to update val %w", err)
 		}
 
 		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	totalKeys, err := GetKeysCount(ls.db)
+	if gone {
+		ls.created = append(ls.created[:index], ls.created[index+1:]...)
+	}
+
+	return nil
+}
+
+// createEntry writes a decoy entry under a new random key, a key that is taken is left alone
+func (ls *LoadSimulator) createEntry() error {
+	key, err := crypt.CalculateHash([]byte(uuid.NewString()[:GetRandomNumInRange(4, 15)]))
 	if err != nil {
-		return fmt.Errorf("faile to get total keys %w", err)
+		return err
 	}
 
-	if totalKeys == 0 {
+	if ls.isException(key) {
 		return nil
 	}
 
-	randomIndex := GetRandomNumInRange(0, int(totalKeys)-1)
-
-	err = ls.db.Update(func(tx *bolt.Tx) error {
+	created := false
+	err = ls.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(DefaultBucketName))
-		c := b.Cursor()
-
-		index := 0
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			if index == randomIndex {
-				for _, exception := range ls.exceptions {
-					if bytes.Equal(k, []byte(exception)) {
-						break
-					}
-				}
-
-				newPwd := uuid.NewString()[:10]
-				encrypter, err := ls.encryptorFunc(newPwd)
-				if err != nil {
-					return fmt.Errorf("failed to create new encryptor %w", err)
-				}
-
-				// either increase the length, or decrease the length
-				words := GetRandomNumInRange(-100, 600)
-				if words < 0 {
-					// reduce by 300 bytes
-					reduceFactor := 300
-					if len(v) <= reduceFactor+1 {
-						// delete
-						err = b.Delete(k)
-						if err != nil {
-							return err
-						}
-
-						return nil
-					}
-
-					v = v[:len(v)-300]
-				}
-
-				v = append(v, []byte(gofakeit.Sentence(words))...)
-				encrypted, err := encrypter.Encrypt(v)
-				if err != nil {
-					return fmt.Errorf("failed to encrypt %w", err)
-				}
-
-				err = b.Put(k, encrypted)
-				if err != nil {
-					return fmt.Errorf("failed to update val %w", err)
-				}
-
-				break
-			}
+		if b.Get(key) != nil {
+			return nil
+		}
+
+		newPwd := uuid.NewString()[:10]
+		encrypter, err := ls.encryptorFunc(newPwd)
+		if err != nil {
+			return fmt.Errorf("failed to create new encryptor %w", err)
+		}
 
-			index++
+		v := []byte(gofakeit.Sentence(GetRandomNumInRange(50, 500)))
+		encrypted, err := encrypter.Encrypt(v)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %w", err)
 		}
 
+		err = b.Put(key, encrypted)
+		if err != nil {
+			return fmt.Errorf("failed to put val %w", err)
+		}
+
+		created = true
 		return nil
 	})
-
 	if err != nil {
 		return err
 	}
 
+	if created {
+		ls.created = append(ls.created, string(key))
+	}
+
 	return nil
 }
 
+// isException tells whether key is one the simulator must leave alone
+func (ls *LoadSimulator) isException(key []byte) bool {
+	for _, exception := range ls.exceptions {
+		if bytes.Equal(key, []byte(exception)) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func GetRandomNumInRange(min, max int) int {
 	rand.Seed(time.Now().UnixNano())
 	return rand.Intn(max-min+1) + min
@@ -240,6 +291,7 @@ func NewLoadSimulator(db *bolt.DB, exceptions []string, encryptorFunc func(key s
 	return &LoadSimulator{
 		reportError:   reportErr,
 		db:            db,
+		update:        db.Update,
 		exceptions:    exceptionsHash,
 		encryptorFunc: encryptorFunc,
 	}, nil
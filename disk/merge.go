@@ -0,0 +1,599 @@
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"soul"
+	"soul/crypt"
+	"soul/secret"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/google/uuid"
+)
+
+// mergeOpenTimeout bounds the wait for a db file that another process, such as a running soul, holds open
+const mergeOpenTimeout = time.Second
+
+// MergeReport tells what merging a folder from another db file changed
+type MergeReport struct {
+	// Added holds the notes only the source had
+	Added []string
+	// Updated holds the notes the source had newer edits of
+	Updated []string
+	// Merged holds the notes edited on both sides whose edits merged cleanly
+	Merged []string
+	// Marked holds the notes edited on both sides whose conflicting edits are left between conflict markers
+	Marked []string
+	// Conflicts maps the notes edited on both sides without a known common ancestor to the copy that keeps the edits
+	// that lost
+	Conflicts map[string]string
+	// Entries is the number of other entries copied over as they are, other folders and decoys among them
+	Entries int
+}
+
+// MergeFiles merges a folder from the db file at sourcePath into the same folder in the db file at targetPath, only
+// the target is written and the source is opened read only. Running it the other way round afterwards brings both files to the same notes.
+func MergeFiles(targetPath, sourcePath, folder, password string, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error)) (*MergeReport, error) {
+	target, err := bolt.Open(targetPath, 0600, &bolt.Options{Timeout: mergeOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open target db %w", err)
+	}
+	defer target.Close()
+
+	source, err := bolt.Open(sourcePath, 0600, &bolt.Options{Timeout: mergeOpenTimeout, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source db %w", err)
+	}
+	defer source.Close()
+
+	return MergeDbs(target, source, folder, password, encrypterFunc, decrypterFunc)
+}
+
+// MergeDbs merges a folder from source into the same folder in target. Notes are matched by ID, a note edited on
+// top of the other side's copy wins and a note edited on both sides keeps the newer edit under its ID and the other
+// one as a copy. Entries of source that target lacks and that are not part of the folder, decoys and folders opened by
+// other passwords, are copied over unread so that the merged file gives away no more than either did. The key slots of
+// both copies open the merged folder, copies whose slots wrap different master keys are not merged.
+func MergeDbs(target, source *bolt.DB, folder, password string, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error)) (*MergeReport, error) {
+	if target == source {
+		return nil, fmt.Errorf("cannot merge a db into itself")
+	}
+
+	// the source is only read, and neither side gets the decoy writes of a repository opened for use
+	sourceRepo, sourceRaw, err := openFolder(source, folder, []byte(password), encrypterFunc, decrypterFunc)
+	if err != nil {
+		return nil, err
+	}
+	defer sourceRepo.Wipe()
+
+	if len(sourceRaw) == 0 {
+		return nil, fmt.Errorf("the source db has no such folder")
+	}
+
+	sourceNotes, sourceMeta, err := sourceRepo.readFolder(sourceRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	err = createBucket(target)
+	if err != nil {
+		return nil, err
+	}
+
+	targetRepo, _, err := openFolder(target, folder, []byte(password), encrypterFunc, decrypterFunc)
+	if err != nil {
+		return nil, err
+	}
+	defer targetRepo.Wipe()
+
+	// the folder itself, its locators and its key slots are merged rather than copied
+	skip := make(map[string]bool)
+	for _, repo := range []*NoteRepository{sourceRepo, targetRepo} {
+		locator, err := locatorHash(folder, repo.folderKey.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		skip[repo.folderHash], skip[locator] = true, true
+	}
+	for _, slot := range sourceMeta.Slots {
+		skip[slot.Locator] = true
+	}
+
+	entries, err := readEntries(source, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	slotLocators := make(map[string][]byte, len(sourceMeta.Slots))
+	for _, slot := range sourceMeta.Slots {
+		slotLocators[slot.Locator], err = getRaw(source, slot.Locator)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &MergeReport{Conflicts: make(map[string]string)}
+	// the target may move to the source's key, the key it gives up is wiped
+	err = targetRepo.updateKeyed(func(tx *bolt.Tx) error {
+		// the folder is read before anything is copied, a stale entry of source may share its key
+		b := tx.Bucket([]byte(DefaultBucketName))
+		targetNotes, targetMeta, err := targetRepo.readFolder(b.Get([]byte(targetRepo.folderHash)))
+		if err != nil {
+			return err
+		}
+
+		err = targetRepo.mergeSlotsTx(b, targetMeta, sourceRepo.key, sourceMeta, slotLocators)
+		if err != nil {
+			return err
+		}
+
+		for key, value := range entries {
+			if b.Get([]byte(key)) != nil {
+				continue
+			}
+
+			err = b.Put([]byte(key), value)
+			if err != nil {
+				return fmt.Errorf("failed to copy entry %w", err)
+			}
+			report.Entries++
+		}
+
+		return targetRepo.mergeNotesTx(tx, targetNotes, targetMeta, sourceNotes, sourceMeta, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Record gives the bucket key and the encrypted value of this folder, as opaque to anyone without its key as the db
+// file is
+func (nr *NoteRepository) Record() (string, []byte, error) {
+	if nr.isWiped() {
+		return "", nil, ErrWiped
+	}
+
+	raw, err := nr.getRawFolder(nr.folderHash)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return nr.folderHash, raw, nil
+}
+
+// MergeRecord merges the notes of a value given by Record on another copy of this folder into this one
+func (nr *NoteRepository) MergeRecord(value []byte) (*MergeReport, error) {
+	if nr.isWiped() {
+		return nil, ErrWiped
+	}
+
+	report := &MergeReport{Conflicts: make(map[string]string)}
+	err := nr.update(func(tx *bolt.Tx) error {
+		// the other copy may be laid out differently, an outer folder for instance
+		other := *nr
+		other.layout, other.regionCap = detectLayout(nr.decrypter, value)
+		notes, meta, err := other.readFolder(value)
+		if err != nil {
+			return fmt.Errorf("failed to open the record %w", err)
+		}
+
+		b := tx.Bucket([]byte(DefaultBucketName))
+		return nr.mergeFolderTx(tx, b.Get([]byte(nr.folderHash)), notes, meta, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the merge is a write of this repository, but notes it brought in are edits made elsewhere
+	if report.changed() {
+		nr.changedElsewhere()
+	}
+
+	return report, nil
+}
+
+// changed tells whether the merge changed any note
+func (mr *MergeReport) changed() bool {
+	return len(mr.Added)+len(mr.Updated)+len(mr.Merged)+len(mr.Marked)+len(mr.Conflicts) != 0
+}
+
+// mergeRecordDb merges notes read from a record into the folder in db, which is not the repository's own yet
+func (nr *NoteRepository) mergeRecordDb(db *bolt.DB, notes []Note, meta *folderMeta) (*MergeReport, error) {
+	report := &MergeReport{Conflicts: make(map[string]string)}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		return nr.mergeFolderTx(tx, b.Get([]byte(nr.folderHash)), notes, meta, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// mergeFolderTx merges notes from another copy of the folder into the folder stored as raw and writes it back
+func (nr *NoteRepository) mergeFolderTx(tx *bolt.Tx, raw []byte, notes []Note, otherMeta *folderMeta, report *MergeReport) error {
+	existing, meta, err := nr.readFolder(raw)
+	if err != nil {
+		return err
+	}
+
+	return nr.mergeNotesTx(tx, existing, meta, notes, otherMeta, report)
+}
+
+// mergeNotesTx merges notes from another copy of the folder into the existing ones and writes the folder back
+func (nr *NoteRepository) mergeNotesTx(tx *bolt.Tx, existing []Note, meta *folderMeta, notes []Note, otherMeta *folderMeta, report *MergeReport) error {
+	merged, err := mergeNotes(existing, notes, report)
+	if err != nil {
+		return err
+	}
+
+	if len(meta.Identity) == 0 {
+		meta.Identity = otherMeta.Identity
+	}
+	if len(meta.SigningKey) == 0 {
+		meta.SigningKey = otherMeta.SigningKey
+	}
+
+	return nr.writeFolderTx(tx, merged, meta)
+}
+
+// mergeSlotsTx carries the key slots of another copy of the folder over along with their locators, so that every
+// password that opened either copy opens the merged one. Copies made from one another share the master key their slots
+// wrap, a copy without slots moves to the master key of the other, and copies whose slots wrap different master keys
+// are refused rather than locking out the passwords of one side. A slot revoked on either side stays revoked.
+func (nr *NoteRepository) mergeSlotsTx(b *bolt.Bucket, meta *folderMeta, otherKey *secret.Buffer, otherMeta *folderMeta, locators map[string][]byte) error {
+	if len(otherMeta.Slots) == 0 {
+		return nil
+	}
+
+	if len(meta.Slots) == 0 {
+		// the password opened both copies, the other one has a slot for it
+		err := nr.useKey(otherKey.Copy())
+		if err != nil {
+			return err
+		}
+	} else if !bytes.Equal(otherKey.Bytes(), nr.key.Bytes()) {
+		return fmt.Errorf("cannot merge copies of the folder whose key slots use different master keys, add the " +
+			"source's passwords as key slots of the target instead")
+	}
+
+	revoked := make(map[string]bool, len(meta.Revoked)+len(otherMeta.Revoked))
+	for _, locator := range meta.Revoked {
+		revoked[locator] = true
+	}
+	for _, locator := range otherMeta.Revoked {
+		if !revoked[locator] {
+			revoked[locator] = true
+			meta.Revoked = append(meta.Revoked, locator)
+		}
+	}
+
+	known := make(map[string]bool, len(meta.Slots))
+	kept := meta.Slots[:0]
+	for _, slot := range meta.Slots {
+		known[slot.Locator] = true
+		if !revoked[slot.Locator] {
+			kept = append(kept, slot)
+			continue
+		}
+
+		err := b.Delete([]byte(slot.Locator))
+		if err != nil {
+			return fmt.Errorf("failed to delete revoked key slot %w", err)
+		}
+	}
+	meta.Slots = kept
+
+	for _, slot := range otherMeta.Slots {
+		if known[slot.Locator] || revoked[slot.Locator] {
+			continue
+		}
+
+		if len(locators[slot.Locator]) == 0 {
+			return fmt.Errorf("the source db is missing the locator of a key slot")
+		}
+
+		err := b.Put([]byte(slot.Locator), locators[slot.Locator])
+		if err != nil {
+			return fmt.Errorf("failed to copy key slot %w", err)
+		}
+		meta.Slots = append(meta.Slots, slot)
+	}
+
+	if len(meta.Slots) == 0 {
+		return fmt.Errorf("cannot merge copies of the folder that revoked each other's remaining key slots")
+	}
+
+	return nil
+}
+
+// readEntries copies every entry of the bucket but the skipped ones
+func readEntries(db *bolt.DB, skip map[string]bool) (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(DefaultBucketName)).ForEach(func(k, v []byte) error {
+			if !skip[string(k)] {
+				entries[string(k)] = append([]byte(nil), v...)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source entries %w", err)
+	}
+
+	return entries, nil
+}
+
+// mergeNotes merges the source notes into the target ones, keeping the target order and adding new notes at the end
+func mergeNotes(target, source []Note, report *MergeReport) ([]Note, error) {
+	merged := append([]Note(nil), target...)
+	index := make(map[string]int, len(merged))
+	for i, note := range merged {
+		index[note.ID] = i
+	}
+
+	add := func(note Note) {
+		index[note.ID] = len(merged)
+		merged = append(merged, note)
+	}
+
+	for _, theirs := range source {
+		i, ok := index[theirs.ID]
+		if !ok {
+			add(theirs)
+			report.Added = append(report.Added, theirs.ID)
+			continue
+		}
+
+		ours := merged[i]
+		if ours.Text == theirs.Text {
+			if theirs.Version > ours.Version {
+				merged[i].Version = theirs.Version
+			}
+			continue
+		}
+
+		oursAfter, err := descends(ours, theirs)
+		if err != nil {
+			return nil, err
+		}
+		if oursAfter {
+			continue
+		}
+
+		theirsAfter, err := descends(theirs, ours)
+		if err != nil {
+			return nil, err
+		}
+		if theirsAfter {
+			merged[i] = theirs
+			report.Updated = append(report.Updated, theirs.ID)
+			continue
+		}
+
+		// edited on both sides, conflict-free notes merge their documents
+		if len(ours.CRDT) != 0 && len(theirs.CRDT) != 0 {
+			merged[i], err = mergeDocs(ours, theirs)
+			if err != nil {
+				return nil, err
+			}
+
+			report.Merged = append(report.Merged, ours.ID)
+			continue
+		}
+
+		// others are merged from their common ancestor when it is still known
+		if base, ok := commonAncestor(ours, theirs); ok {
+			merged[i], err = mergeText(base, ours, theirs)
+			if err != nil {
+				return nil, err
+			}
+
+			if soul.HasConflicts(merged[i].Text) {
+				report.Marked = append(report.Marked, ours.ID)
+			} else {
+				report.Merged = append(report.Merged, ours.ID)
+			}
+			continue
+		}
+
+		winner, loser := ours, theirs
+		if newer(theirs, ours) {
+			winner, loser = theirs, ours
+		}
+
+		copied, err := conflictCopy(loser)
+		if err != nil {
+			return nil, err
+		}
+
+		// the losing edit becomes part of the winner's history, merging the same files again changes nothing
+		winner.Revisions, err = noteRevisions(winner)
+		if err != nil {
+			return nil, err
+		}
+		winner.Revisions = appendRevision(winner.Revisions, copied.Revisions[len(copied.Revisions)-1])
+		merged[i] = winner
+
+		if j, ok := index[copied.ID]; ok {
+			merged[j] = copied
+		} else {
+			add(copied)
+		}
+		report.Conflicts[winner.ID] = copied.ID
+	}
+
+	return merged, nil
+}
+
+// commonAncestor finds the text of the latest revision both notes went through
+func commonAncestor(ours, theirs Note) (string, bool) {
+	theirRevisions := make(map[string]bool, len(theirs.Revisions))
+	for _, revision := range theirs.Revisions {
+		theirRevisions[revision] = true
+	}
+
+	for i := len(ours.Revisions) - 1; i >= 0; i-- {
+		revision := ours.Revisions[i]
+		if !theirRevisions[revision] {
+			continue
+		}
+
+		for _, history := range []map[string]string{ours.History, theirs.History} {
+			if text, ok := history[revision]; ok {
+				return text, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// mergeText merges the edits made on both sides since base
+func mergeText(base string, ours, theirs Note) (Note, error) {
+	text := soul.Merge3(base, ours.Text, theirs.Text).Text()
+
+	// a note made conflict-free on one side only stays so, with the merged text
+	for _, side := range []Note{ours, theirs} {
+		doc, err := decodeDoc(side)
+		if err != nil {
+			return Note{}, err
+		}
+		if doc == nil {
+			continue
+		}
+
+		doc.SetText(text)
+		state, err := doc.MarshalBinary()
+		if err != nil {
+			return Note{}, err
+		}
+
+		return mergedRevision(ours, theirs, text, state)
+	}
+
+	return mergedRevision(ours, theirs, text, nil)
+}
+
+// mergeDocs merges the documents of conflict-free notes edited on both sides
+func mergeDocs(ours, theirs Note) (Note, error) {
+	doc, err := decodeDoc(ours)
+	if err != nil {
+		return Note{}, err
+	}
+
+	theirDoc, err := decodeDoc(theirs)
+	if err != nil {
+		return Note{}, err
+	}
+
+	doc.Merge(theirDoc)
+	state, err := doc.MarshalBinary()
+	if err != nil {
+		return Note{}, err
+	}
+
+	return mergedRevision(ours, theirs, doc.Text(), state)
+}
+
+// mergedRevision gives a new revision of ours with the merged text, going through both sides' revisions so that
+// either side merged again descends from it
+func mergedRevision(ours, theirs Note, text string, state []byte) (Note, error) {
+	merged := ours
+	merged.Text = text
+	merged.CRDT = state
+	if theirs.Version > merged.Version {
+		merged.Version = theirs.Version
+	}
+	merged.Version++
+	merged.UpdatedAt = time.Now()
+
+	revision, err := crypt.CalculateStringHash(merged.Text)
+	if err != nil {
+		return Note{}, err
+	}
+
+	known := make(map[string]bool, len(ours.Revisions))
+	for _, r := range ours.Revisions {
+		known[r] = true
+	}
+
+	merged.Revisions = append([]string(nil), ours.Revisions...)
+	for _, r := range theirs.Revisions {
+		if !known[r] {
+			merged.Revisions = append(merged.Revisions, r)
+		}
+	}
+	merged.Revisions = appendRevision(merged.Revisions, revision)
+	merged.History = keepHistory(merged.Revisions, ours.History, theirs.History, map[string]string{revision: merged.Text})
+
+	return merged, nil
+}
+
+// descends tells whether note was edited on top of the text other has
+func descends(note, other Note) (bool, error) {
+	revisions, err := noteRevisions(note)
+	if err != nil {
+		return false, err
+	}
+
+	revision, err := crypt.CalculateStringHash(other.Text)
+	if err != nil {
+		return false, err
+	}
+
+	for _, r := range revisions {
+		if r == revision {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// newer tells whether a wins over b when both were edited, by version, then edit time and then text so that both
+// sides of a merge pick the same winner
+func newer(a, b Note) bool {
+	if a.Version != b.Version {
+		return a.Version > b.Version
+	}
+
+	if !a.UpdatedAt.Equal(b.UpdatedAt) {
+		return a.UpdatedAt.After(b.UpdatedAt)
+	}
+
+	return bytes.Compare([]byte(a.Text), []byte(b.Text)) > 0
+}
+
+// conflictCopy gives the copy that keeps a losing edit, its ID is derived from the note and the edit so that merging
+// again finds the same copy
+func conflictCopy(note Note) (Note, error) {
+	revision, err := crypt.CalculateStringHash(note.Text)
+	if err != nil {
+		return Note{}, err
+	}
+
+	revisions, err := noteRevisions(note)
+	if err != nil {
+		return Note{}, err
+	}
+
+	if len(revisions) == 0 || revisions[len(revisions)-1] != revision {
+		revisions = appendRevision(revisions, revision)
+	}
+
+	return Note{
+		ID:        uuid.NewSHA1(uuid.NameSpaceOID, []byte(note.ID+revision)).String(),
+		Version:   note.Version,
+		Text:      note.Text,
+		UpdatedAt: note.UpdatedAt,
+		Revisions: revisions,
+	}, nil
+}
@@ -0,0 +1,191 @@
+package disk
+
+import (
+	"encoding/hex"
+	"fmt"
+	"soul"
+	"soul/secret"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// folderHashSize is the size of a decoded folder name hash
+const folderHashSize = 32
+
+// RecoveryKey gives the key material that opens this folder without any password, to be split into recovery shares.
+// The folder is moved onto key slots first so that the key stays valid while slots come and go.
+func (nr *NoteRepository) RecoveryKey() ([]byte, error) {
+	currentLocator, err := locatorHash(nr.folder, nr.folderKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	err = nr.updateKeyed(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		notes, meta, err := nr.readFolder(b.Get([]byte(nr.folderHash)))
+		if err != nil {
+			return err
+		}
+
+		if len(meta.Slots) != 0 {
+			return nil
+		}
+
+		err = nr.enableKeySlotsTx(b, meta, currentLocator)
+		if err != nil {
+			return err
+		}
+
+		return nr.writeFolderTx(tx, notes, meta)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := hex.DecodeString(nr.folderHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode folder location %w", err)
+	}
+
+	nr.watch.dbMu.RLock()
+	defer nr.watch.dbMu.RUnlock()
+
+	return append(location, nr.key.Bytes()...), nil
+}
+
+// RecoverFolder opens the folder with key material from RecoveryKey and adds a key slot for newPassword, after which
+// the folder opens with the new password as usual
+func RecoverFolder(dbPath, folder, newPassword string, recoveryKey []byte, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error)) (*NoteRepository, error) {
+	db, err := bolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init db %w", err)
+	}
+
+	repo, err := RecoverFolderWithDb(db, folder, newPassword, recoveryKey, encrypterFunc, decrypterFunc)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func RecoverFolderWithDb(db *bolt.DB, folder, newPassword string, recoveryKey []byte, encrypterFunc func(string) (soul.Encrypter, error), decrypterFunc func(string) (soul.Decrypter, error)) (*NoteRepository, error) {
+	if len(strings.TrimSpace(newPassword)) == 0 {
+		return nil, fmt.Errorf("new password cannot be empty")
+	}
+
+	policy, err := soul.ActivePolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = policy.CheckPassword([]byte(newPassword))
+	if err != nil {
+		return nil, err
+	}
+
+	err = createBucket(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recoveryKey) <= folderHashSize {
+		return nil, fmt.Errorf("recovery key is too short")
+	}
+
+	folderHash := hex.EncodeToString(recoveryKey[:folderHashSize])
+	key := string(recoveryKey[folderHashSize:])
+
+	raw, err := getRaw(db, folderHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("recovery key does not belong to any folder in this db")
+	}
+
+	folderKey, err := deriveFolderKey(folder, newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypter, err := encrypterFunc(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encrypter %w", err)
+	}
+
+	decrypter, err := decrypterFunc(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decrypter %w", err)
+	}
+
+	folderLayout, regionCap := detectLayout(decrypter, raw)
+	repo := &NoteRepository{
+		encrypter:     encrypter,
+		decrypter:     decrypter,
+		db:            db,
+		watch:         newFolderWatch(db),
+		folderHash:    folderHash,
+		layout:        folderLayout,
+		regionCap:     regionCap,
+		folder:        folder,
+		folderKey:     secret.FromString(folderKey),
+		key:           secret.FromString(key),
+		encrypterFunc: encrypterFunc,
+		decrypterFunc: decrypterFunc,
+	}
+
+	if _, _, err := repo.readFolder(raw); err != nil {
+		return nil, fmt.Errorf("recovery key does not open the folder %w", err)
+	}
+
+	newLocator, err := locatorHash(folder, []byte(folderKey))
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.updateKeyed(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		if b.Get([]byte(newLocator)) != nil {
+			return fmt.Errorf("password already opens a folder under this name")
+		}
+
+		notes, meta, err := repo.readFolder(b.Get([]byte(folderHash)))
+		if err != nil {
+			return err
+		}
+
+		if len(meta.Slots) == 0 {
+			// the lost password keeps no slot, only the new one opens the folder from now on
+			err = repo.useMasterKey()
+			if err != nil {
+				return err
+			}
+		}
+
+		err = repo.putLocatorTx(b, newLocator, folderKey)
+		if err != nil {
+			return err
+		}
+
+		meta.Slots = append(meta.Slots, keySlot{Locator: newLocator, CreatedAt: time.Now()})
+
+		return repo.writeFolderTx(tx, notes, meta)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.RequireDecoyTraffic {
+		err = repo.startLoadSimulation([]string{folder})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return repo, nil
+}
@@ -0,0 +1,261 @@
+package disk
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"soul/secret"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// folderMeta holds folder wide data, it is encoded after the notes so older versions simply ignore it
+type folderMeta struct {
+	Slots []keySlot
+	// Revoked holds the locators of revoked key slots, so that merging in a copy made before the revocation does not
+	// bring them back
+	Revoked []string
+	// Identity is the private key of the folder's identity, created the first time it is asked for
+	Identity []byte
+	// SigningKey is the seed of the folder's signing key, created the first time it is asked for
+	SigningKey []byte
+}
+
+// keySlot records the locator that wraps the folder key for one password, the password itself is never stored
+type keySlot struct {
+	Locator   string
+	CreatedAt time.Time
+}
+
+// KeySlot describes a key slot without revealing anything about its password
+type KeySlot struct {
+	Index     int
+	CreatedAt time.Time
+	// Current is set for the slot this repository was opened with
+	Current bool
+}
+
+// ListKeySlots lists the passwords that open this folder. A folder without key slots only opens with the password it
+// was created with, which is listed as a single slot that cannot be revoked.
+func (nr *NoteRepository) ListKeySlots() ([]KeySlot, error) {
+	var slots []KeySlot
+	err := nr.viewFolder(func(raw []byte) error {
+		_, meta, err := nr.readFolder(raw)
+		if err != nil {
+			return err
+		}
+
+		if len(meta.Slots) == 0 {
+			slots = []KeySlot{{Index: 0, Current: true}}
+			return nil
+		}
+
+		current, err := locatorHash(nr.folder, nr.folderKey.Bytes())
+		if err != nil {
+			return err
+		}
+
+		for i, slot := range meta.Slots {
+			slots = append(slots, KeySlot{
+				Index:     i,
+				CreatedAt: slot.CreatedAt,
+				Current:   slot.Locator == current,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+// AddKeySlot lets password open this folder as well. The first slot moves the folder to a random master key that every
+// slot wraps from then on, so that slots can be added and revoked later without touching the notes again.
+func (nr *NoteRepository) AddKeySlot(password string) error {
+	if len(strings.TrimSpace(password)) == 0 {
+		return fmt.Errorf("key slot password cannot be empty")
+	}
+
+	err := checkPassword([]byte(password))
+	if err != nil {
+		return err
+	}
+
+	slotKey, err := deriveFolderKey(nr.folder, password)
+	if err != nil {
+		return err
+	}
+
+	if slotKey == string(nr.folderKey.Bytes()) {
+		return fmt.Errorf("password already opens this folder")
+	}
+
+	slotLocator, err := locatorHash(nr.folder, []byte(slotKey))
+	if err != nil {
+		return err
+	}
+
+	currentLocator, err := locatorHash(nr.folder, nr.folderKey.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return nr.updateKeyed(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		if b.Get([]byte(slotLocator)) != nil {
+			return fmt.Errorf("password already opens a folder under this name")
+		}
+
+		notes, meta, err := nr.readFolder(b.Get([]byte(nr.folderHash)))
+		if err != nil {
+			return err
+		}
+
+		if len(meta.Slots) == 0 {
+			err = nr.enableKeySlotsTx(b, meta, currentLocator)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = nr.putLocatorTx(b, slotLocator, slotKey)
+		if err != nil {
+			return err
+		}
+
+		meta.Slots = append(meta.Slots, keySlot{Locator: slotLocator, CreatedAt: time.Now()})
+
+		return nr.writeFolderTx(tx, notes, meta)
+	})
+}
+
+// RevokeKeySlot stops the password of the slot at index from opening this folder. The last slot cannot be revoked.
+func (nr *NoteRepository) RevokeKeySlot(index int) error {
+	return nr.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		notes, meta, err := nr.readFolder(b.Get([]byte(nr.folderHash)))
+		if err != nil {
+			return err
+		}
+
+		if index < 0 || index >= len(meta.Slots) {
+			return fmt.Errorf("key slot %d does not exist", index)
+		}
+
+		if len(meta.Slots) == 1 {
+			return fmt.Errorf("cannot revoke the last key slot")
+		}
+
+		err = b.Delete([]byte(meta.Slots[index].Locator))
+		if err != nil {
+			return fmt.Errorf("failed to delete key slot %w", err)
+		}
+
+		meta.Revoked = append(meta.Revoked, meta.Slots[index].Locator)
+		meta.Slots = append(meta.Slots[:index], meta.Slots[index+1:]...)
+
+		return nr.writeFolderTx(tx, notes, meta)
+	})
+}
+
+// updateKeyed runs fn in a write transaction and puts the repository's key back if fn switched it but failed, the
+// key given up either way is wiped. Reads decrypt under the db lock, which is held to itself here so that none of them
+// sees the key change halfway.
+func (nr *NoteRepository) updateKeyed(fn func(tx *bolt.Tx) error) error {
+	nr.watch.dbMu.Lock()
+	defer nr.watch.dbMu.Unlock()
+
+	oldEncrypter, oldDecrypter, oldKey := nr.encrypter, nr.decrypter, nr.key
+	err := nr.updateLocked(fn)
+	if nr.key == oldKey {
+		return err
+	}
+
+	if err != nil {
+		wipeKey(nr.key, nr.encrypter, nr.decrypter)
+		nr.encrypter, nr.decrypter, nr.key = oldEncrypter, oldDecrypter, oldKey
+		return err
+	}
+
+	wipeKey(oldKey, oldEncrypter, oldDecrypter)
+
+	return nil
+}
+
+// enableKeySlotsTx moves the folder to a master key and gives currentLocator the first slot, the folder must be
+// written afterwards to be re-encrypted
+func (nr *NoteRepository) enableKeySlotsTx(b *bolt.Bucket, meta *folderMeta, currentLocator string) error {
+	err := nr.useMasterKey()
+	if err != nil {
+		return err
+	}
+
+	err = nr.putLocatorTx(b, currentLocator, string(nr.folderKey.Bytes()))
+	if err != nil {
+		return err
+	}
+
+	meta.Slots = append(meta.Slots, keySlot{Locator: currentLocator, CreatedAt: time.Now()})
+
+	return nil
+}
+
+// useMasterKey switches the repository to a fresh random key, the folder is re-encrypted on its next write
+func (nr *NoteRepository) useMasterKey() error {
+	random := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return fmt.Errorf("failed to generate master key %w", err)
+	}
+
+	key := secret.New(hex.EncodedLen(len(random)))
+	hex.Encode(key.Bytes(), random)
+	secret.Zero(random)
+
+	return nr.useKey(key)
+}
+
+// useKey switches the repository to key, which it takes over, the folder is re-encrypted on its next write. The key it
+// replaces is left to updateKeyed, which puts it back if the write fails.
+func (nr *NoteRepository) useKey(key *secret.Buffer) error {
+	encrypter, err := nr.encrypterFunc(string(key.Bytes()))
+	if err != nil {
+		key.Wipe()
+		return fmt.Errorf("failed to create encrypter %w", err)
+	}
+
+	decrypter, err := nr.decrypterFunc(string(key.Bytes()))
+	if err != nil {
+		wipeKey(key, encrypter)
+		return fmt.Errorf("failed to create decrypter %w", err)
+	}
+
+	nr.encrypter, nr.decrypter, nr.key = encrypter, decrypter, key
+
+	return nil
+}
+
+// putLocatorTx stores a locator, readable with slotKey, that points at this folder and its current key
+func (nr *NoteRepository) putLocatorTx(b *bolt.Bucket, locatorKey, slotKey string) error {
+	encrypter, err := nr.encrypterFunc(slotKey)
+	if err != nil {
+		return fmt.Errorf("failed to create encrypter %w", err)
+	}
+
+	locator, err := encryptLocator(encrypter, &folderLocator{Location: nr.folderHash, Key: string(nr.key.Bytes())})
+	if err != nil {
+		return err
+	}
+
+	err = b.Put([]byte(locatorKey), locator)
+	if err != nil {
+		return fmt.Errorf("failed to store locator %w", err)
+	}
+
+	return nil
+}
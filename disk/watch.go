@@ -0,0 +1,180 @@
+package disk
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"soul"
+	"sync"
+
+	"github.com/boltdb/bolt"
+)
+
+var _ soul.ChangeDetector = &NoteRepository{}
+
+// folderWatch keeps track of the folder value as this repository last saw it, so that writes made by anyone else can
+// be told apart from its own. Other writers are peers and sync servers merging into the same db, other repositories
+// opened on it and tools replacing the db file.
+type folderWatch struct {
+	// dbMu guards the db of the repository, which is swapped for a new one when the file is replaced, for as long as
+	// each transaction on it runs. It guards the key and crypters of the repository too, which a rekey swaps.
+	dbMu sync.RWMutex
+	// file is the db file as it was opened
+	file os.FileInfo
+
+	mu sync.Mutex
+	// seen is the fingerprint of the folder value last read or written, known tells whether there is one yet
+	seen  [sha256.Size]byte
+	known bool
+	// changed is set when a write of this repository had to build on a value someone else wrote
+	changed bool
+}
+
+func newFolderWatch(db *bolt.DB) *folderWatch {
+	// a db that is not backed by a file it can stat is not watched for being replaced
+	file, _ := os.Stat(db.Path())
+
+	return &folderWatch{file: file}
+}
+
+// Changed tells whether the notes were changed by another writer since GetAll last read them. A db file replaced on
+// disk, by a file sync tool for instance, is opened in place of the old one with this repository's notes merged into
+// it, as they may have edits the new file lacks.
+func (nr *NoteRepository) Changed() (bool, error) {
+	if nr.isWiped() {
+		return false, ErrWiped
+	}
+
+	replaced, err := nr.reopenReplaced()
+	if err != nil || replaced {
+		return replaced, err
+	}
+
+	raw, err := nr.getRawFolder(nr.folderHash)
+	if err != nil {
+		return false, err
+	}
+
+	nr.watch.mu.Lock()
+	defer nr.watch.mu.Unlock()
+
+	return nr.watch.changed || (nr.watch.known && nr.watch.seen != sha256.Sum256(raw)), nil
+}
+
+// saw notes that the folder value was read, later changes are measured against it
+func (nr *NoteRepository) saw(raw []byte) {
+	nr.watch.mu.Lock()
+	defer nr.watch.mu.Unlock()
+
+	nr.watch.seen, nr.watch.known, nr.watch.changed = sha256.Sum256(raw), true, false
+}
+
+// wrote notes a committed write of this repository from the fingerprint of the value before it to the one after, the
+// write keeping what someone else wrote before it still leaves the notes read last out of date
+func (nr *NoteRepository) wrote(before, after [sha256.Size]byte) {
+	nr.watch.mu.Lock()
+	defer nr.watch.mu.Unlock()
+
+	if nr.watch.known && nr.watch.seen != before {
+		nr.watch.changed = true
+	}
+	nr.watch.seen, nr.watch.known = after, true
+}
+
+// changedElsewhere notes that the notes read last are out of date
+func (nr *NoteRepository) changedElsewhere() {
+	nr.watch.mu.Lock()
+	defer nr.watch.mu.Unlock()
+
+	nr.watch.changed = true
+}
+
+// update runs fn in a write transaction on the db of the repository, which is not swapped for a new one meanwhile. The
+// folder value it leaves is noted as this repository's own once the transaction commits, so that Changed does not take
+// it for someone else's.
+func (nr *NoteRepository) update(fn func(tx *bolt.Tx) error) error {
+	nr.watch.dbMu.RLock()
+	defer nr.watch.dbMu.RUnlock()
+
+	return nr.updateLocked(fn)
+}
+
+// updateLocked is update for a caller that holds the db lock
+func (nr *NoteRepository) updateLocked(fn func(tx *bolt.Tx) error) error {
+	var before, after [sha256.Size]byte
+	err := nr.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DefaultBucketName))
+		before = sha256.Sum256(b.Get([]byte(nr.folderHash)))
+
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+
+		after = sha256.Sum256(b.Get([]byte(nr.folderHash)))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	nr.wrote(before, after)
+
+	return nil
+}
+
+// updateDb runs fn in a write transaction on the db of the repository like update does, for writes that are not the
+// repository's own
+func (nr *NoteRepository) updateDb(fn func(tx *bolt.Tx) error) error {
+	nr.watch.dbMu.RLock()
+	defer nr.watch.dbMu.RUnlock()
+
+	return nr.db.Update(fn)
+}
+
+// reopenReplaced opens the db file anew when it was replaced on disk and merges the folder as it was into the new one
+func (nr *NoteRepository) reopenReplaced() (bool, error) {
+	nr.watch.dbMu.Lock()
+	defer nr.watch.dbMu.Unlock()
+
+	if nr.watch.file == nil {
+		return false, nil
+	}
+
+	current, err := os.Stat(nr.db.Path())
+	if err != nil || os.SameFile(nr.watch.file, current) {
+		// a file that is gone for now is most likely in the middle of being replaced
+		return false, nil
+	}
+
+	raw, err := getRaw(nr.db, nr.folderHash)
+	if err != nil {
+		return false, err
+	}
+
+	db, err := bolt.Open(nr.db.Path(), 0600, &bolt.Options{Timeout: mergeOpenTimeout})
+	if err != nil {
+		return false, fmt.Errorf("failed to open the replaced db file %w", err)
+	}
+
+	err = createBucket(db)
+	if err == nil && len(raw) != 0 {
+		var notes []Note
+		var meta *folderMeta
+		notes, meta, err = nr.readFolder(raw)
+		if err == nil {
+			_, err = nr.mergeRecordDb(db, notes, meta)
+		}
+	}
+	if err != nil {
+		db.Close()
+		return false, fmt.Errorf("failed to merge the folder into the replaced db file %w", err)
+	}
+
+	old := nr.db
+	nr.db, nr.watch.file = db, current
+	old.Close()
+	nr.changedElsewhere()
+
+	return true, nil
+}
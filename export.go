@@ -0,0 +1,115 @@
+package soul
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ExportFormat is the version of the export format written by ExportNotes
+const ExportFormat = 1
+
+// Signer signs data with a detached signature
+type Signer interface {
+	// PublicKey gives the key the signatures are checked against
+	PublicKey() string
+	SignDetached(data []byte) ([]byte, error)
+}
+
+// SignerProvider is implemented by repositories that keep a signing key for their folder
+type SignerProvider interface {
+	SigningKey() (Signer, error)
+}
+
+// Export is a portable copy of notes
+type Export struct {
+	Format     int            `json:"format"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Notes      []ExportedNote `json:"notes"`
+}
+
+// ExportedNote is a single note in an export
+type ExportedNote struct {
+	ID      string  `json:"id"`
+	Version Version `json:"version"`
+	Text    string  `json:"text"`
+}
+
+// ExportNotes exports the notes of the repository with the given ids, or all of them when no ids are given
+func ExportNotes(repo NoteRepository, ids ...string) ([]byte, error) {
+	notes, err := repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	export := Export{Format: ExportFormat, ExportedAt: time.Now().UTC(), Notes: []ExportedNote{}}
+	for _, note := range notes {
+		if len(wanted) > 0 && !wanted[note.ID] {
+			continue
+		}
+
+		text, err := note.Text.Get()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read text from note %w", err)
+		}
+
+		export.Notes = append(export.Notes, ExportedNote{ID: note.ID, Version: note.Version, Text: text})
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode export %w", err)
+	}
+
+	return data, nil
+}
+
+// ReadExport decodes an export written by ExportNotes, the signature should be verified before trusting it
+func ReadExport(data []byte) (*Export, error) {
+	export := new(Export)
+	err := json.Unmarshal(data, export)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode export %w", err)
+	}
+
+	if export.Format != ExportFormat {
+		return nil, fmt.Errorf("unsupported export format %d", export.Format)
+	}
+
+	return export, nil
+}
+
+// SigningKey gives the signing key of the folder the notes are stored in
+func (ns *NoteService) SigningKey() (Signer, error) {
+	provider, ok := ns.Repo.(SignerProvider)
+	if !ok {
+		return nil, fmt.Errorf("repository does not support signing")
+	}
+
+	return provider.SigningKey()
+}
+
+// SignedExport exports the notes with the given ids, or all of them, along with a detached signature over the export
+func (ns *NoteService) SignedExport(ids ...string) ([]byte, []byte, error) {
+	signer, err := ns.SigningKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := ExportNotes(ns.Repo, ids...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signature, err := signer.SignDetached(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign export %w", err)
+	}
+
+	return data, signature, nil
+}
@@ -0,0 +1,205 @@
+// Package filestore keeps configuration in a json file, for use where no fyne app is running such as the cli
+package filestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"soul"
+	"sync"
+)
+
+var _ soul.ConfigStore = &Store{}
+
+const (
+	// fileMode keeps the config, which holds encrypted credentials, private to the user
+	fileMode = 0600
+	dirMode  = 0700
+
+	lockExtension = ".lock"
+)
+
+// Store is a ConfigStore backed by a json file. Every write replaces the file atomically and is serialized with other
+// processes through a lock file next to it, so that concurrent writers do not lose each other's keys.
+type Store struct {
+	path string
+
+	mu  sync.Mutex
+	err error
+}
+
+// DefaultPath gives the config file in the user's config directory, $XDG_CONFIG_HOME/soul/config.json on linux
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the config directory %w", err)
+	}
+
+	return filepath.Join(dir, "soul", "config.json"), nil
+}
+
+// New opens the config file at path, creating its directory if needed, the file itself is created on the first write
+func New(path string) (*Store, error) {
+	err := os.MkdirAll(filepath.Dir(path), dirMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config directory %w", err)
+	}
+
+	store := &Store{path: path}
+	_, err = store.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// NewDefault opens the config file at DefaultPath
+func NewDefault() (*Store, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return New(path)
+}
+
+// Path gives the config file's path
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Err gives the error of the last failed read or write, ConfigStore has no way to return them
+func (s *Store) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *Store) GetString(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values, err := s.read()
+	if err != nil {
+		s.err = err
+		return ""
+	}
+
+	return values[key]
+}
+
+func (s *Store) SetString(key, val string) {
+	s.update(func(values map[string]string) {
+		values[key] = val
+	})
+}
+
+func (s *Store) Delete(key string) {
+	s.update(func(values map[string]string) {
+		delete(values, key)
+	})
+}
+
+// read loads the values holding a shared lock, the caller holds s.mu
+func (s *Store) read() (map[string]string, error) {
+	unlock, err := lockFile(s.path+lockExtension, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.load()
+}
+
+// update changes the values holding an exclusive lock, from loading them to replacing the file
+func (s *Store) update(fn func(map[string]string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockFile(s.path+lockExtension, true)
+	if err != nil {
+		s.err = err
+		return
+	}
+	defer unlock()
+
+	values, err := s.load()
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	fn(values)
+	err = s.write(values)
+	if err != nil {
+		s.err = err
+	}
+}
+
+func (s *Store) load() (map[string]string, error) {
+	values := make(map[string]string)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %w", err)
+	}
+
+	if len(data) == 0 {
+		return values, nil
+	}
+
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config %s %w", s.path, err)
+	}
+
+	return values, nil
+}
+
+// write replaces the file through a temporary one in the same directory, so that readers never see half a config
+func (s *Store) write(values map[string]string) error {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary config %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	err = tmp.Chmod(fileMode)
+	if err != nil {
+		return fmt.Errorf("failed to set config permissions %w", err)
+	}
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to write config %w", err)
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync config %w", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close config %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace config %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package filestore_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"soul"
+	"soul/filestore"
+	"soul/testhelpers"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStore(t *testing.T) *filestore.Store {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "soul-filestore")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	store, err := filestore.New(filepath.Join(dir, "soul", "config.json"))
+	assert.Nil(t, err)
+
+	return store
+}
+
+func TestFileConfig(t *testing.T) {
+	store := newStore(t)
+
+	testhelpers.ExecuteConfigStoreTests(t, store)
+	testhelpers.ExecutePINTests(t, store)
+	testhelpers.ExecuteSessionTests(t, store)
+	testhelpers.ExecuteProfileTests(t, store)
+	testhelpers.ExecuteSettingsTests(t, store)
+	testhelpers.ExecutePolicyTests(t, store)
+	assert.Nil(t, store.Err())
+
+	info, err := os.Stat(store.Path())
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// values outlive the store they were written with
+	store.SetString("KEY", "value")
+	reopened, err := filestore.New(store.Path())
+	assert.Nil(t, err)
+	assert.Equal(t, "value", reopened.GetString("KEY"))
+	reopened.Delete("KEY")
+	assert.Equal(t, "", store.GetString("KEY"))
+}
+
+// TestEnforceOtherPolicy is not parallel, the active policy is picked through the environment
+func TestEnforceOtherPolicy(t *testing.T) {
+	store := newStore(t)
+	settings := soul.DefaultSettings()
+	settings.AutoLock = 0
+	assert.Nil(t, soul.SaveSettings(store, settings))
+
+	policyPath := filepath.Join(filepath.Dir(store.Path()), "policy.json")
+	assert.Nil(t, ioutil.WriteFile(policyPath, []byte(`{"max_auto_lock_minutes": 5}`), 0600))
+	os.Setenv(soul.PolicyEnvVar, policyPath)
+
+	// the settings are capped by the policy enforced, not by the one on disk
+	err := (&soul.Policy{MaxAutoLockMinutes: 10}).Enforce(store)
+	os.Unsetenv(soul.PolicyEnvVar)
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Minute, soul.GetAutoLock(store))
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	store := newStore(t)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		writer, err := filestore.New(store.Path())
+		assert.Nil(t, err)
+
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				writer.SetString(fmt.Sprintf("KEY_%d_%d", w, i), "value")
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < 4; w++ {
+		for i := 0; i < 25; i++ {
+			assert.Equal(t, "value", store.GetString(fmt.Sprintf("KEY_%d_%d", w, i)))
+		}
+	}
+}
+
+func TestCorruptedConfig(t *testing.T) {
+	store := newStore(t)
+	assert.Nil(t, ioutil.WriteFile(store.Path(), []byte("{not json"), 0600))
+
+	_, err := filestore.New(store.Path())
+	assert.NotNil(t, err)
+
+	assert.Equal(t, "", store.GetString("KEY"))
+	assert.NotNil(t, store.Err())
+}
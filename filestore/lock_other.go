@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package filestore
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// lockFile fails where no file lock is implemented, writers in other processes could otherwise overwrite each other's
+// settings unnoticed
+func lockFile(string, bool) (func(), error) {
+	return nil, fmt.Errorf("locking the config file is not supported on %s", runtime.GOOS)
+}
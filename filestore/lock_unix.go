@@ -0,0 +1,40 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an flock on path, shared for readers and exclusive for writers, until the returned func is called.
+// The lock lives on a file of its own since the config file is replaced on every write.
+func lockFile(path string, exclusive bool) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %w", err)
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	for {
+		err = syscall.Flock(int(file.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock config %w", err)
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
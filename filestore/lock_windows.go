@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package filestore
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes a LockFileEx lock on path, shared for readers and exclusive for writers, until the returned func is
+// called. The lock lives on a file of its own since the config file is replaced on every write.
+func lockFile(path string, exclusive bool) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %w", err)
+	}
+
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+
+	// the whole file is locked, however long it gets
+	handle := windows.Handle(file.Fd())
+	overlapped := new(windows.Overlapped)
+	err = windows.LockFileEx(handle, flags, 0, ^uint32(0), ^uint32(0), overlapped)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock config %w", err)
+	}
+
+	return func() {
+		windows.UnlockFileEx(handle, 0, ^uint32(0), ^uint32(0), overlapped)
+		file.Close()
+	}, nil
+}
@@ -2,27 +2,40 @@ package fyne
 
 import (
 	"fmt"
+	"soul/secret"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/widget"
 )
 
-func NewCheckInPage(_ fyne.Window,
-	onSubmitFunc func(password string, loginInstead bool) error) fyne.CanvasObject {
+// NewCheckInPage asks for the password of the logged in folder, or for its PIN when pinEnabled. profilePicker is shown
+// above the form when not nil.
+func NewCheckInPage(_ fyne.Window, profilePicker fyne.CanvasObject, pinEnabled bool,
+	onSubmitFunc func(password *secret.Buffer, usePIN, loginInstead bool) error) fyne.CanvasObject {
 
 	passwordWidget := widget.NewPasswordEntry()
 	passwordWidget.SetPlaceHolder("Logged In Folder Password")
+	passwordItem := &widget.FormItem{Text: "Password", Widget: passwordWidget}
 
-	form := &widget.Form{
-		Items: []*widget.FormItem{
-			{Text: "Password", Widget: passwordWidget},
-		},
+	usePIN := pinEnabled
+	form := &widget.Form{Items: []*widget.FormItem{passwordItem}}
+	if pinEnabled {
+		passwordWidget.SetPlaceHolder("PIN")
+		passwordItem.Text = "PIN"
+		form.Append("", widget.NewCheck("Use the folder password instead", func(b bool) {
+			usePIN = !b
+			if usePIN {
+				passwordWidget.SetPlaceHolder("PIN")
+			} else {
+				passwordWidget.SetPlaceHolder("Logged In Folder Password")
+			}
+		}))
 	}
 
 	loginPageButton := widget.NewButton("Login Instead", nil)
 	loginPageButton.OnTapped = func() {
-		onSubmitFunc("", true)
+		onSubmitFunc(nil, false, true)
 	}
 
 	submitButton := widget.NewButton("Submit", nil)
@@ -36,14 +49,23 @@ func NewCheckInPage(_ fyne.Window,
 			loginPageButton.Enable()
 		}()
 
-		err := onSubmitFunc(passwordWidget.Text, false)
+		// the callee wipes the password, the entry is cleared so that its copy goes with the page
+		err := onSubmitFunc(secret.FromString(passwordWidget.Text), usePIN, false)
 		if err != nil {
 			fyne.CurrentApp().SendNotification(fyne.NewNotification("Unable to check in",
 				fmt.Sprintf("due to %v", err)))
+			return
 		}
+
+		passwordWidget.SetText("")
 	}
 
-	return container.NewVBox(form, container.NewCenter(
+	page := container.NewVBox(form, container.NewCenter(
 		container.NewHBox(submitButton, loginPageButton),
 	))
+	if profilePicker != nil {
+		page.Objects = append([]fyne.CanvasObject{profilePicker, widget.NewSeparator()}, page.Objects...)
+	}
+
+	return page
 }
@@ -15,3 +15,43 @@ func TestFyneConfig(t *testing.T) {
 
 	testhelpers.ExecuteConfigStoreTests(t, fyne.NewFyneConfigStore(app))
 }
+
+func TestFynePIN(t *testing.T) {
+	t.Parallel()
+
+	app := fyneapp.NewWithID("org.testing.soul.pin")
+
+	testhelpers.ExecutePINTests(t, fyne.NewFyneConfigStore(app))
+}
+
+func TestFyneSession(t *testing.T) {
+	t.Parallel()
+
+	app := fyneapp.NewWithID("org.testing.soul.session")
+
+	testhelpers.ExecuteSessionTests(t, fyne.NewFyneConfigStore(app))
+}
+
+func TestFyneProfiles(t *testing.T) {
+	t.Parallel()
+
+	app := fyneapp.NewWithID("org.testing.soul.profiles")
+
+	testhelpers.ExecuteProfileTests(t, fyne.NewFyneConfigStore(app))
+}
+
+func TestFyneSettings(t *testing.T) {
+	t.Parallel()
+
+	app := fyneapp.NewWithID("org.testing.soul.settings")
+
+	testhelpers.ExecuteSettingsTests(t, fyne.NewFyneConfigStore(app))
+}
+
+func TestFynePolicy(t *testing.T) {
+	t.Parallel()
+
+	app := fyneapp.NewWithID("org.testing.soul.policy")
+
+	testhelpers.ExecutePolicyTests(t, fyne.NewFyneConfigStore(app))
+}
@@ -0,0 +1,114 @@
+package fyne
+
+import (
+	"fmt"
+	"soul"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// resolutionChoices are the ways a conflict can be resolved, in the order of soul.Resolution
+var resolutionChoices = []string{"Keep mine", "Keep theirs", "Keep both"}
+
+// showConflictsDialog shows the conflicts a merge left in the selected note side by side and replaces them with the
+// sides picked
+func (ui *Home) showConflictsDialog() {
+	if ui.selectedNote == nil {
+		return
+	}
+
+	note := ui.selectedNote
+	text, err := note.Text.Get()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("unable to read note %w", err), ui.window)
+		return
+	}
+
+	result := soul.ParseConflicts(text)
+	count := result.Conflicts()
+	if count == 0 {
+		dialog.ShowInformation("Resolve Conflicts", "This note has no conflicting edits", ui.window)
+		return
+	}
+
+	resolutions := make([]soul.Resolution, count)
+	conflicts := container.NewVBox()
+	for _, hunk := range result.Hunks {
+		if !hunk.Conflict {
+			continue
+		}
+
+		i := len(conflicts.Objects)
+		choice := widget.NewRadioGroup(resolutionChoices, func(selected string) {
+			for r, label := range resolutionChoices {
+				if label == selected {
+					resolutions[i] = soul.Resolution(r)
+				}
+			}
+		})
+		choice.Horizontal = true
+		choice.Required = true
+		choice.SetSelected(resolutionChoices[soul.ResolveOurs])
+
+		sides := container.NewGridWithColumns(2,
+			widget.NewCard("", "Mine", conflictSide(hunk.Ours)),
+			widget.NewCard("", "Theirs", conflictSide(hunk.Theirs)))
+		conflicts.Add(widget.NewCard(fmt.Sprintf("Conflict %d of %d", i+1, count), "", container.NewBorder(nil, choice, nil, nil, sides)))
+	}
+
+	d := dialog.NewCustomConfirm("Resolve Conflicts", "Resolve", "Cancel", container.NewVScroll(conflicts), func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		// the sync service saves the resolved text like any other edit
+		err := note.Text.Set(result.Resolve(resolutions))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to update note %w", err), ui.window)
+		}
+	}, ui.window)
+	d.Resize(fyne.NewSize(720, 480))
+	d.Show()
+}
+
+// conflictSide shows one side of a conflict
+func conflictSide(text string) fyne.CanvasObject {
+	label := widget.NewLabel(text)
+	label.Wrapping = fyne.TextWrapWord
+	if len(text) == 0 {
+		label.SetText("(removed)")
+	}
+
+	return label
+}
+
+// showConflictFreeDialog switches the selected note between plain text and conflict-free editing
+func (ui *Home) showConflictFreeDialog() {
+	if ui.selectedNote == nil {
+		return
+	}
+
+	note := ui.selectedNote
+	enable := note.Doc == nil
+	message := "Edits made to this note on other devices will merge without conflicts,\n" +
+		"deleted text is kept hidden in the folder to make that work. Turn it on?"
+	if !enable {
+		message = "Edits made to this note on other devices may conflict again. Turn conflict-free editing off?"
+	}
+
+	dialog.ShowConfirm("Conflict-Free Editing", message, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		err := ui.Service.SetConflictFree(note, enable)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to change note %w", err), ui.window)
+			return
+		}
+		ui.watchNotes()
+	}, ui.window)
+}
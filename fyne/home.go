@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"runtime"
 	"soul"
+	"soul/crypt"
+	"soul/disk"
+	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
@@ -19,14 +24,90 @@ type Home struct {
 	Service *soul.NoteService
 
 	selectedNote *soul.Note
-	textWidget   *widget.Entry
+	textWidget   *activityEntry
 	infoLabel    *widget.Label
 	listWidget   *widget.List
-	OnLoggedOut  func()
+	window       fyne.Window
+	syncService  *soul.SyncService
+	idle         *idleMonitor
+	// stopStatus stops following the sync status
+	stopStatus func()
+	// stopReload stops watching for notes changed elsewhere
+	stopReload func()
+	// failed holds the notes that failed to save, they are badged in the list
+	failed   map[string]bool
+	failedMu sync.Mutex
+	// loggedOut guards against a lock and a logout racing each other
+	loggedOut   sync.Once
+	OnLoggedOut func()
+	// OnLocked is called instead of OnLoggedOut when the folder locks, it falls back to OnLoggedOut
+	OnLocked func()
+	// Config holds the settings, auto lock is off and the settings cannot be changed without it
+	Config   soul.ConfigStore
+	settings soul.Settings
+}
+
+// duressRegisterer is implemented by repositories that can hide a decoy folder behind a duress password
+type duressRegisterer interface {
+	RegisterDuressPassword(password string, decoyNotes []string) error
+}
+
+// hiddenFolderCreator is implemented by repositories that can hide a folder in the padding of another
+type hiddenFolderCreator interface {
+	HiddenFolderSpace() (int, error)
+	CreateHiddenFolder(hiddenPassword string, capacity int) error
+	ProtectHiddenFolder(hiddenPassword string) error
+}
+
+// keySlotManager is implemented by repositories that let several passwords open the same folder
+type keySlotManager interface {
+	ListKeySlots() ([]disk.KeySlot, error)
+	AddKeySlot(password string) error
+	RevokeKeySlot(index int) error
+}
+
+// recoveryKeyProvider is implemented by repositories whose key can be split into recovery shares
+type recoveryKeyProvider interface {
+	RecoveryKey() ([]byte, error)
+}
+
+// wiper is implemented by repositories that can forget their keys on logout
+type wiper interface {
+	Wipe()
+}
+
+// closer is implemented by repositories that hold a db file open, closing also forgets the keys
+type closer interface {
+	Close() error
+}
+
+// autoLockOptions are the idle times offered for auto lock
+var autoLockOptions = []struct {
+	name    string
+	timeout time.Duration
+}{
+	{"Never", 0},
+	{"1 minute", time.Minute},
+	{"5 minutes", 5 * time.Minute},
+	{"15 minutes", 15 * time.Minute},
+	{"1 hour", time.Hour},
+}
+
+// hiddenFolderShares are the shares of the folder's free padding offered to a hidden folder, in percent
+var hiddenFolderShares = []struct {
+	name    string
+	percent int
+}{
+	{"A quarter of the free space", 25},
+	{"Half of the free space", 50},
+	{"Three quarters of the free space", 75},
 }
 
 const DefaultInfo = "Welcome to your soul"
 
+// reloadInterval is how often the folder is checked for notes changed elsewhere
+const reloadInterval = 2 * time.Second
+
 func (home *Home) addNote() error {
 	newNote, err := home.Service.Create()
 	if err != nil {
@@ -34,10 +115,23 @@ func (home *Home) addNote() error {
 	}
 
 	home.setNoteAndBind(newNote)
+	home.watchNotes()
 
 	return nil
 }
 
+// watchNotes has the sync service save edits to notes added since it started
+func (ui *Home) watchNotes() {
+	if ui.syncService == nil {
+		return
+	}
+
+	err := ui.syncService.Watch()
+	if err != nil {
+		ui.infoLabel.SetText(fmt.Sprintf("failed to watch notes %v", err))
+	}
+}
+
 func (ui *Home) setNoteAndBind(n *soul.Note) {
 	ui.textWidget.Unbind()
 	if n == nil {
@@ -54,41 +148,137 @@ func (ui *Home) setNoteAndBind(n *soul.Note) {
 func (ui *Home) buildList(notes []soul.Note) *widget.List {
 	list := widget.NewList(
 		func() int {
-			return len(ui.Service.Notes)
+			return ui.Service.Len()
 		},
 		func() fyne.CanvasObject {
-			return widget.NewLabel("Title")
+			badge := widget.NewIcon(theme.ErrorIcon())
+			badge.Hide()
+			return container.NewBorder(nil, nil, nil, badge, widget.NewLabel("Title"))
 		},
 		func(id widget.ListItemID, obj fyne.CanvasObject) {
-			label := obj.(*widget.Label)
-			note := ui.Service.Notes[id]
+			item := obj.(*fyne.Container)
+			label, badge := item.Objects[0].(*widget.Label), item.Objects[1].(*widget.Icon)
+			note, ok := ui.Service.NoteAt(id)
+			if !ok {
+				return
+			}
 			label.Bind(note.Title())
+			if ui.failedToSave(note.ID) {
+				badge.Show()
+			} else {
+				badge.Hide()
+			}
 		})
 
 	list.OnSelected = func(id widget.ListItemID) {
-		n := ui.Service.Notes[id]
+		ui.touch()
+		n, ok := ui.Service.NoteAt(id)
+		if !ok {
+			return
+		}
 		ui.setNoteAndBind(&n)
 	}
 
 	return list
 }
 
+// Logout saves pending edits and logs out to OnLoggedOut
 func (ui *Home) Logout() {
-	ui.Service.Notes = nil
+	ui.Flush()
+	ui.logout(ui.OnLoggedOut)
+}
+
+// Flush saves pending edits right away, failures are reported as a notification too
+func (ui *Home) Flush() error {
+	if ui.syncService == nil {
+		return nil
+	}
+
+	err := ui.syncService.Flush()
+	if err != nil {
+		fyne.CurrentApp().SendNotification(fyne.NewNotification("Unable to save pending edits", fmt.Sprintf("%v", err)))
+	}
+
+	return err
+}
+
+// Lock saves pending edits and logs out to OnLocked, it is what auto lock, the lock shortcut and system signals run
+func (ui *Home) Lock() {
+	ui.Flush()
+
+	onLocked := ui.OnLocked
+	if onLocked == nil {
+		onLocked = ui.OnLoggedOut
+	}
+
+	ui.logout(onLocked)
+}
+
+// touch reports user activity to the idle monitor
+func (ui *Home) touch() {
+	if ui.idle != nil {
+		ui.idle.Touch()
+	}
+}
+
+func (ui *Home) logout(then func()) {
+	ui.loggedOut.Do(func() {
+		ui.clear()
+		if then != nil {
+			runtime.GC()
+			then()
+		}
+	})
+}
+
+func (ui *Home) clear() {
+	if ui.idle != nil {
+		ui.idle.Stop()
+		ui.idle = nil
+	}
+	if ui.stopReload != nil {
+		ui.stopReload()
+		ui.stopReload = nil
+	}
+	if ui.syncService != nil {
+		ui.syncService.Stop()
+		ui.syncService = nil
+	}
+	if ui.stopStatus != nil {
+		ui.stopStatus()
+		ui.stopStatus = nil
+	}
+	ui.Service.Clear()
 	ui.listWidget = nil
 	ui.textWidget = nil
 	ui.selectedNote = nil
 	ui.Text = nil
+	switch repo := ui.Service.Repo.(type) {
+	case closer:
+		// the db file stays locked until closed, and the next login opens it again
+		err := repo.Close()
+		if err != nil {
+			fyne.LogError("unable to close notes", err)
+		}
+	case wiper:
+		repo.Wipe()
+	}
 	ui.Service.Repo = nil
-	if ui.OnLoggedOut != nil {
-		runtime.GC()
-		ui.OnLoggedOut()
+	if ui.window != nil {
+		ui.window.SetMainMenu(nil)
+		ui.window = nil
 	}
 }
 
 func (ui *Home) LoadDataAndBuildUI() (fyne.CanvasObject, error) {
-	ui.textWidget = widget.NewMultiLineEntry()
-	ui.textWidget.Wrapping = fyne.TextWrapWord
+	ui.settings = soul.DefaultSettings()
+	if ui.Config != nil {
+		// invalid settings fall back to their defaults, they are fixed the next time the settings are saved
+		ui.settings, _ = soul.LoadSettings(ui.Config)
+	}
+
+	ui.textWidget = newActivityEntry(ui.touch)
+	ui.textWidget.Wrapping = textWrap(ui.settings.Wrap)
 	ui.textWidget.SetText(ui.placeholderContent())
 	ui.infoLabel = widget.NewLabel("Welcome to your Soul")
 
@@ -96,34 +286,15 @@ func (ui *Home) LoadDataAndBuildUI() (fyne.CanvasObject, error) {
 	if err != nil {
 		return nil, err
 	}
+	ui.Service.Sort(ui.settings.SortOrder)
 
-	ui.listWidget = ui.buildList(ui.Service.Notes)
-	notes := ui.Service.Notes
+	notes := ui.Service.Snapshot()
+	ui.listWidget = ui.buildList(notes)
 	if len(notes) > 0 {
-		ui.setNoteAndBind(&ui.Service.Notes[0])
+		ui.setNoteAndBind(&notes[0])
 		ui.listWidget.Select(0)
 	}
 
-	var updateNote = func(note *soul.Note, disableDuringOp bool) {
-		ui.infoLabel.SetText("updating note.....")
-		defer func() {
-			ui.infoLabel.SetText(DefaultInfo)
-
-			if ui.textWidget.Disabled() {
-				ui.textWidget.Enable()
-			}
-		}()
-
-		if disableDuringOp {
-			ui.textWidget.Disable()
-		}
-
-		err := ui.Service.Update(note)
-		if err != nil {
-			fyne.CurrentApp().SendNotification(fyne.NewNotification("Unable to save this note", fmt.Sprintf("%v", err)))
-		}
-	}
-
 	bar := widget.NewToolbar(
 		widget.NewToolbarAction(theme.ContentAddIcon(), func() {
 			err := ui.addNote()
@@ -132,7 +303,10 @@ func (ui *Home) LoadDataAndBuildUI() (fyne.CanvasObject, error) {
 			}
 		}),
 		widget.NewToolbarAction(theme.DocumentSaveIcon(), func() {
-			updateNote(ui.selectedNote, true)
+			err := ui.updateNote(ui.selectedNote, true)
+			if err != nil {
+				fyne.CurrentApp().SendNotification(fyne.NewNotification("Unable to save this note", fmt.Sprintf("%v", err)))
+			}
 		}),
 		widget.NewToolbarAction(theme.LogoutIcon(), func() {
 			ui.Logout()
@@ -143,18 +317,198 @@ func (ui *Home) LoadDataAndBuildUI() (fyne.CanvasObject, error) {
 		bar, container.NewVScroll(ui.listWidget), ui.infoLabel)
 
 	// finally start our sync service
+	ui.startSync(ui.settings.SyncInterval)
+	ui.startReload()
+
+	if ui.Config != nil {
+		ui.idle = newIdleMonitor(ui.settings.AutoLock, ui.Lock)
+	}
+
+	// TODO : fix correct size and disable resie window
+	return container.NewMax(newActivityLayer(ui.touch), newAdaptiveSplit(side, ui.textWidget)), nil
+}
+
+func (ui *Home) updateNote(note *soul.Note, disableDuringOp bool) error {
+	if disableDuringOp {
+		ui.textWidget.Disable()
+		defer ui.textWidget.Enable()
+	}
+
+	return ui.Service.Update(note)
+}
+
+// startSync starts saving edited notes, replacing the running sync service after saving its edits
+func (ui *Home) startSync(interval time.Duration) {
+	if ui.syncService != nil {
+		err := ui.syncService.Stop()
+		if err != nil {
+			ui.infoLabel.SetText(fmt.Sprintf("failed to sync note %v", err))
+		}
+	}
+	if ui.stopStatus != nil {
+		ui.stopStatus()
+	}
+
+	// failures are shown from the status, which keeps them until the notes save
 	ss := soul.NewSyncService(func() ([]soul.Note, error) {
-		return ui.Service.Notes, nil
+		return ui.Service.Snapshot(), nil
 	}, func(note *soul.Note) error {
-		updateNote(note, false)
-		return nil
-	}, func(err error) {
-		ui.infoLabel.SetText(fmt.Sprintf("failed to sync note %v", err))
-	}, 5*time.Second)
+		return ui.updateNote(note, false)
+	}, func(error) {}, interval)
+
+	statuses, stop := ss.Subscribe()
+	ui.stopStatus = stop
+	go ui.followSyncStatus(statuses, ui.infoLabel, ui.listWidget)
+
 	ss.Start()
+	ui.syncService = ss
+}
 
-	// TODO : fix correct size and disable resie window
-	return newAdaptiveSplit(side, ui.textWidget), nil
+// startReload reloads the notes whenever another instance, a merge, a sync or a file sync tool changes them, so that
+// the next save does not write over the newer notes
+func (ui *Home) startReload() {
+	if _, ok := ui.Service.Repo.(soul.ChangeDetector); !ok {
+		return
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ui.stopReload = func() {
+		close(done)
+		<-stopped
+	}
+
+	go func(label *widget.Label, list *widget.List) {
+		defer close(stopped)
+
+		ticker := time.NewTicker(reloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ui.reloadChanged(label, list)
+			case <-done:
+				return
+			}
+		}
+	}(ui.infoLabel, ui.listWidget)
+}
+
+// reloadChanged reloads the notes if they changed elsewhere, the widgets are passed in as clear drops them
+func (ui *Home) reloadChanged(label *widget.Label, list *widget.List) {
+	report, err := ui.Service.ReloadIfChanged()
+	if err != nil {
+		label.SetText(fmt.Sprintf("failed to reload notes changed elsewhere %v", err))
+		return
+	}
+	if report == nil || !report.Changed() {
+		return
+	}
+
+	if len(report.Added) != 0 {
+		ui.watchNotes()
+	}
+	list.Refresh()
+
+	switch {
+	case len(report.Conflicts) != 0:
+		fyne.CurrentApp().SendNotification(fyne.NewNotification("Notes changed elsewhere",
+			fmt.Sprintf("%d notes have edits that conflict with yours, resolve them from Note > Resolve Conflicts", len(report.Conflicts))))
+	case len(report.Merged) != 0:
+		label.SetText(fmt.Sprintf("Merged your edits with %d notes changed elsewhere", len(report.Merged)))
+	default:
+		label.SetText("Reloaded notes changed elsewhere")
+	}
+}
+
+// followSyncStatus shows the sync status until the channel closes, the widgets are passed in as clear drops them
+func (ui *Home) followSyncStatus(statuses <-chan soul.SyncStatus, label *widget.Label, list *widget.List) {
+	for status := range statuses {
+		label.SetText(syncStatusText(status))
+
+		failed := make(map[string]bool)
+		for id, note := range status.Notes {
+			if note.State == soul.NoteFailed {
+				failed[id] = true
+			}
+		}
+
+		ui.failedMu.Lock()
+		changed := len(failed) != len(ui.failed)
+		for id := range failed {
+			changed = changed || !ui.failed[id]
+		}
+		ui.failed = failed
+		ui.failedMu.Unlock()
+
+		if changed && list != nil {
+			list.Refresh()
+		}
+	}
+}
+
+// failedToSave tells whether the last attempt to save a note failed
+func (ui *Home) failedToSave(id string) bool {
+	ui.failedMu.Lock()
+	defer ui.failedMu.Unlock()
+
+	return ui.failed[id]
+}
+
+// syncStatusText describes the sync status for the info label, failures are kept until the notes save
+func syncStatusText(status soul.SyncStatus) string {
+	saving := false
+	for _, note := range status.Notes {
+		saving = saving || note.State == soul.NoteSaving
+	}
+
+	switch {
+	case status.Failed == 1:
+		return fmt.Sprintf("Failed to save a note, retrying: %v", status.LastError)
+	case status.Failed > 1:
+		return fmt.Sprintf("Failed to save %d notes, retrying: %v", status.Failed, status.LastError)
+	case saving:
+		return "Saving..."
+	case status.Pending > 0:
+		return "Unsaved changes"
+	case !status.LastSaved.IsZero():
+		return fmt.Sprintf("Last saved at %s", status.LastSaved.Format("15:04:05"))
+	default:
+		return DefaultInfo
+	}
+}
+
+// applySettings applies changed settings to the open folder
+func (ui *Home) applySettings(settings soul.Settings) {
+	previous := ui.settings
+	ui.settings = settings
+
+	ApplyTheme(fyne.CurrentApp(), settings)
+	if ui.textWidget != nil && settings.Wrap != previous.Wrap {
+		ui.textWidget.Wrapping = textWrap(settings.Wrap)
+		ui.textWidget.Refresh()
+	}
+
+	if ui.idle != nil && settings.AutoLock != previous.AutoLock {
+		ui.idle.Reset(settings.AutoLock)
+	}
+
+	if ui.syncService != nil && settings.SyncInterval != previous.SyncInterval {
+		ui.startSync(settings.SyncInterval)
+	}
+
+	if ui.listWidget != nil && settings.SortOrder != previous.SortOrder {
+		ui.Service.Sort(settings.SortOrder)
+		ui.listWidget.UnselectAll()
+		ui.listWidget.Refresh()
+		if ui.selectedNote != nil {
+			for i, note := range ui.Service.Snapshot() {
+				if note.ID == ui.selectedNote.ID {
+					ui.listWidget.Select(i)
+				}
+			}
+		}
+	}
 }
 
 func (ui *Home) RegisterKeys(w fyne.Window) {
@@ -164,8 +518,344 @@ func (ui *Home) RegisterKeys(w fyne.Window) {
 	}
 
 	w.Canvas().AddShortcut(shortcut, func(_ fyne.Shortcut) {
+		ui.touch()
 		ui.addNote()
 	})
+
+	lockShortcut := &desktop.CustomShortcut{KeyName: fyne.KeyL, Modifier: shortcut.Modifier}
+	w.Canvas().AddShortcut(lockShortcut, func(_ fyne.Shortcut) {
+		ui.Lock()
+	})
+
+	// typing while no widget has focus is activity too
+	w.Canvas().SetOnTypedKey(func(*fyne.KeyEvent) {
+		ui.touch()
+	})
+	w.Canvas().SetOnTypedRune(func(rune) {
+		ui.touch()
+	})
+}
+
+// RegisterMenu adds the folder menu to the window, it only lists the actions the repository supports
+func (ui *Home) RegisterMenu(w fyne.Window) {
+	ui.window = w
+
+	var items []*fyne.MenuItem
+	if repo, ok := ui.Service.Repo.(duressRegisterer); ok {
+		items = append(items, fyne.NewMenuItem("Set Duress Password", func() {
+			ui.showDuressDialog(repo)
+		}))
+	}
+
+	if repo, ok := ui.Service.Repo.(hiddenFolderCreator); ok {
+		items = append(items, fyne.NewMenuItem("Create Hidden Folder", func() {
+			ui.showCreateHiddenDialog(repo)
+		}), fyne.NewMenuItem("Protect Hidden Folder", func() {
+			ui.showProtectHiddenDialog(repo)
+		}))
+	}
+
+	if repo, ok := ui.Service.Repo.(keySlotManager); ok {
+		items = append(items, fyne.NewMenuItem("Key Slots", func() {
+			ui.showKeySlotsDialog(repo)
+		}))
+	}
+
+	if repo, ok := ui.Service.Repo.(recoveryKeyProvider); ok {
+		items = append(items, fyne.NewMenuItem("Recovery Shares", func() {
+			ui.showRecoverySharesDialog(repo)
+		}))
+	}
+
+	sessionItems := []*fyne.MenuItem{fyne.NewMenuItem("Lock", ui.Lock)}
+	if ui.Config != nil {
+		sessionItems = append(sessionItems, fyne.NewMenuItem("Settings", ui.showSettingsDialog))
+	}
+
+	menus := []*fyne.Menu{
+		fyne.NewMenu("Session", sessionItems...),
+		fyne.NewMenu("Note",
+			fyne.NewMenuItem("Resolve Conflicts", ui.showConflictsDialog),
+			fyne.NewMenuItem("Conflict-Free Editing", ui.showConflictFreeDialog),
+		),
+	}
+	if len(items) > 0 {
+		menus = append(menus, fyne.NewMenu("Folder", items...))
+	}
+
+	if _, ok := ui.Service.Repo.(soul.IdentityProvider); ok {
+		menus = append(menus, fyne.NewMenu("Share",
+			fyne.NewMenuItem("My Public Key", ui.showPublicKeyDialog),
+			fyne.NewMenuItem("Share Note", ui.showShareNoteDialog),
+			fyne.NewMenuItem("Import Note", ui.showImportNoteDialog),
+		))
+	}
+
+	w.SetMainMenu(fyne.NewMainMenu(menus...))
+}
+
+func (ui *Home) showDuressDialog(repo duressRegisterer) {
+	passwordWidget := widget.NewPasswordEntry()
+	passwordWidget.SetPlaceHolder("Duress Password")
+
+	notesWidget := widget.NewMultiLineEntry()
+	notesWidget.SetPlaceHolder("Groceries\n" + decoyNoteSeparator + "\nCall the dentist")
+
+	dialog.ShowForm("Duress Password", "Save", "Cancel", []*widget.FormItem{
+		{Text: "Password", Widget: passwordWidget, HintText: "Opens a decoy folder instead of this one"},
+		{Text: "Decoy Notes", Widget: notesWidget, HintText: "The notes the decoy opens with, separated by lines of " + decoyNoteSeparator},
+	}, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		err := repo.RegisterDuressPassword(passwordWidget.Text, splitDecoyNotes(notesWidget.Text))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to set duress password %w", err), ui.window)
+		}
+	}, ui.window)
+}
+
+// decoyNoteSeparator is the line separating the notes entered for a decoy folder
+const decoyNoteSeparator = "---"
+
+// splitDecoyNotes splits the text entered for a decoy folder into its notes, dropping empty ones
+func splitDecoyNotes(text string) []string {
+	var notes []string
+	var note []string
+	for _, line := range append(strings.Split(text, "\n"), decoyNoteSeparator) {
+		if strings.TrimSpace(line) != decoyNoteSeparator {
+			note = append(note, line)
+			continue
+		}
+
+		if joined := strings.TrimSpace(strings.Join(note, "\n")); len(joined) != 0 {
+			notes = append(notes, joined)
+		}
+		note = nil
+	}
+
+	return notes
+}
+
+func (ui *Home) showCreateHiddenDialog(repo hiddenFolderCreator) {
+	passwordWidget := widget.NewPasswordEntry()
+	passwordWidget.SetPlaceHolder("Hidden Folder Password")
+
+	space, err := repo.HiddenFolderSpace()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("unable to create hidden folder %w", err), ui.window)
+		return
+	}
+
+	var sizeNames []string
+	for _, option := range hiddenFolderShares {
+		sizeNames = append(sizeNames, fmt.Sprintf("%s, %d KB", option.name, space*option.percent/100>>10))
+	}
+
+	sizeWidget := widget.NewSelect(sizeNames, nil)
+	sizeWidget.SetSelectedIndex(1)
+
+	dialog.ShowForm("Hidden Folder", "Create", "Cancel", []*widget.FormItem{
+		{Text: "Password", Widget: passwordWidget, HintText: "Opens the hidden folder under this folder name"},
+		{Text: "Size", Widget: sizeWidget, HintText: "Space taken from this folder's padding, its size does not change"},
+	}, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		size := space * hiddenFolderShares[sizeWidget.SelectedIndex()].percent / 100
+		err := repo.CreateHiddenFolder(passwordWidget.Text, size)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to create hidden folder %w", err), ui.window)
+		}
+	}, ui.window)
+}
+
+func (ui *Home) showProtectHiddenDialog(repo hiddenFolderCreator) {
+	passwordWidget := widget.NewPasswordEntry()
+	passwordWidget.SetPlaceHolder("Hidden Folder Password")
+
+	dialog.ShowForm("Protect Hidden Folder", "Protect", "Cancel", []*widget.FormItem{
+		{Text: "Password", Widget: passwordWidget, HintText: "Saves that would overwrite it fail until logout"},
+	}, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		err := repo.ProtectHiddenFolder(passwordWidget.Text)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to protect hidden folder %w", err), ui.window)
+		}
+	}, ui.window)
+}
+
+func (ui *Home) showKeySlotsDialog(repo keySlotManager) {
+	slots, err := repo.ListKeySlots()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("unable to list key slots %w", err), ui.window)
+		return
+	}
+
+	var slotsDialog dialog.Dialog
+	rows := container.NewVBox()
+	for _, slot := range slots {
+		index := slot.Index
+		description := fmt.Sprintf("Slot %d", index+1)
+		if !slot.CreatedAt.IsZero() {
+			description += fmt.Sprintf(", added %s", slot.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		if slot.Current {
+			description += " (this login)"
+		}
+
+		revokeButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+			err := repo.RevokeKeySlot(index)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("unable to revoke key slot %w", err), ui.window)
+				return
+			}
+
+			slotsDialog.Hide()
+			ui.showKeySlotsDialog(repo)
+		})
+		rows.Add(container.NewBorder(nil, nil, nil, revokeButton, widget.NewLabel(description)))
+	}
+
+	passwordWidget := widget.NewPasswordEntry()
+	passwordWidget.SetPlaceHolder("New Slot Password")
+	addButton := widget.NewButtonWithIcon("", theme.ContentAddIcon(), func() {
+		err := repo.AddKeySlot(passwordWidget.Text)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to add key slot %w", err), ui.window)
+			return
+		}
+
+		slotsDialog.Hide()
+		ui.showKeySlotsDialog(repo)
+	})
+	rows.Add(container.NewBorder(nil, nil, nil, addButton, passwordWidget))
+
+	slotsDialog = dialog.NewCustom("Key Slots", "Close", rows, ui.window)
+	slotsDialog.Show()
+}
+
+func (ui *Home) showRecoverySharesDialog(repo recoveryKeyProvider) {
+	counts := []string{"2", "3", "4", "5", "6", "7", "8", "9", "10"}
+	countWidget := widget.NewSelect(counts, nil)
+	countWidget.SetSelected("5")
+	thresholdWidget := widget.NewSelect(counts, nil)
+	thresholdWidget.SetSelected("3")
+
+	dialog.ShowForm("Recovery Shares", "Create", "Cancel", []*widget.FormItem{
+		{Text: "Shares", Widget: countWidget, HintText: "Give each share to a different person or place"},
+		{Text: "Needed", Widget: thresholdWidget, HintText: "Shares needed to recover, fewer reveal nothing"},
+	}, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		recoveryKey, err := repo.RecoveryKey()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to read recovery key %w", err), ui.window)
+			return
+		}
+
+		shares, err := crypt.SplitSecret(recoveryKey, countWidget.SelectedIndex()+2, thresholdWidget.SelectedIndex()+2)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to create shares %w", err), ui.window)
+			return
+		}
+
+		var lines []string
+		for _, share := range shares {
+			lines = append(lines, share.Text())
+		}
+
+		sharesWidget := widget.NewMultiLineEntry()
+		sharesWidget.SetText(strings.Join(lines, "\n"))
+		sharesWidget.SetMinRowsVisible(len(lines) + 1)
+		dialog.ShowCustom("Recovery Shares", "Done", container.NewVBox(
+			widget.NewLabel("Anyone holding enough of these shares can open this folder"),
+			sharesWidget,
+		), ui.window)
+	}, ui.window)
+}
+
+func (ui *Home) showPublicKeyDialog() {
+	identity, err := ui.Service.Identity()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("unable to read identity %w", err), ui.window)
+		return
+	}
+
+	keyWidget := widget.NewEntry()
+	keyWidget.SetText(identity.PublicKey())
+	dialog.ShowCustom("My Public Key", "Done", container.NewVBox(
+		widget.NewLabel("Others share notes with this folder using this key"),
+		keyWidget,
+		widget.NewButtonWithIcon("Copy", theme.ContentCopyIcon(), func() {
+			ui.window.Clipboard().SetContent(identity.PublicKey())
+		}),
+	), ui.window)
+}
+
+func (ui *Home) showShareNoteDialog() {
+	if ui.selectedNote == nil {
+		dialog.ShowInformation("Share Note", "Select the note to share first", ui.window)
+		return
+	}
+
+	recipientsWidget := widget.NewMultiLineEntry()
+	recipientsWidget.SetPlaceHolder("One public key per line")
+
+	dialog.ShowForm("Share Note", "Share", "Cancel", []*widget.FormItem{
+		{Text: "Recipients", Widget: recipientsWidget, HintText: "Only these keys can open the shared note"},
+	}, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		armored, err := ui.Service.ShareNote(ui.selectedNote, strings.Fields(recipientsWidget.Text))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to share note %w", err), ui.window)
+			return
+		}
+
+		armoredWidget := widget.NewMultiLineEntry()
+		armoredWidget.SetText(armored)
+		armoredWidget.SetMinRowsVisible(8)
+		dialog.ShowCustom("Shared Note", "Done", container.NewVBox(
+			widget.NewLabel("Send this text to the recipients"),
+			armoredWidget,
+			widget.NewButtonWithIcon("Copy", theme.ContentCopyIcon(), func() {
+				ui.window.Clipboard().SetContent(armored)
+			}),
+		), ui.window)
+	}, ui.window)
+}
+
+func (ui *Home) showImportNoteDialog() {
+	armoredWidget := widget.NewMultiLineEntry()
+	armoredWidget.SetPlaceHolder("-----BEGIN " + soul.SharedNoteType + "-----")
+	armoredWidget.SetMinRowsVisible(8)
+
+	dialog.ShowForm("Import Note", "Import", "Cancel", []*widget.FormItem{
+		{Text: "Shared Note", Widget: armoredWidget},
+	}, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		note, err := ui.Service.ImportNote(armoredWidget.Text)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to import note %w", err), ui.window)
+			return
+		}
+
+		ui.setNoteAndBind(note)
+		ui.watchNotes()
+	}, ui.window)
 }
 
 func (ui *Home) placeholderContent() string {
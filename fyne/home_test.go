@@ -0,0 +1,59 @@
+package fyne_test
+
+import (
+	"soul"
+	"soul/fyne"
+	"soul/mocks"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHomeLock(t *testing.T) {
+	test.NewApp()
+
+	repo := mocks.NewNoteRepository()
+	locked, loggedOut := 0, 0
+	home := &fyne.Home{
+		Service:     soul.NewNoteService(repo),
+		OnLoggedOut: func() { loggedOut++ },
+		OnLocked:    func() { locked++ },
+	}
+
+	_, err := home.LoadDataAndBuildUI()
+	assert.Nil(t, err)
+
+	home.Lock()
+	home.Lock()
+	home.Logout()
+	assert.Equal(t, 1, locked)
+	assert.Equal(t, 0, loggedOut)
+	assert.Nil(t, home.Service.Repo)
+}
+
+func TestHomeSortsNotes(t *testing.T) {
+	store := fyne.NewFyneConfigStore(test.NewApp())
+	settings := soul.DefaultSettings()
+	settings.SortOrder = soul.SortTitle
+	assert.Nil(t, soul.SaveSettings(store, settings))
+
+	home := &fyne.Home{Service: soul.NewNoteService(mocks.NewNoteRepository()), Config: store}
+	_, err := home.LoadDataAndBuildUI()
+	assert.Nil(t, err)
+	defer home.Logout()
+
+	titles := func() []string {
+		var titles []string
+		for _, note := range home.Service.Notes {
+			title, _ := note.Title().Get()
+			titles = append(titles, title)
+		}
+
+		return titles
+	}
+	assert.Equal(t, []string{"first string", "fourth string", "second string", "third string"}, titles())
+
+	home.Service.Sort(soul.SortCreated)
+	assert.Equal(t, []string{"first string", "second string", "third string", "fourth string"}, titles())
+}
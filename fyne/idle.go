@@ -0,0 +1,127 @@
+package fyne
+
+import (
+	"image/color"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+)
+
+// idleMonitor calls onIdle once no activity was reported for the timeout
+type idleMonitor struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	timer   *time.Timer
+	onIdle  func()
+}
+
+func newIdleMonitor(timeout time.Duration, onIdle func()) *idleMonitor {
+	m := &idleMonitor{onIdle: onIdle}
+	m.Reset(timeout)
+
+	return m
+}
+
+// Touch reports activity and restarts the countdown
+func (m *idleMonitor) Touch() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.timer != nil {
+		m.timer.Reset(m.timeout)
+	}
+}
+
+// Reset changes the timeout and restarts the countdown, a timeout of 0 stops monitoring
+func (m *idleMonitor) Reset(timeout time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+
+	m.timeout = timeout
+	if timeout > 0 {
+		m.timer = time.AfterFunc(timeout, m.onIdle)
+	}
+}
+
+// Stop stops monitoring
+func (m *idleMonitor) Stop() {
+	m.Reset(0)
+}
+
+// activityEntry is a multi line entry that reports keyboard and pointer use
+type activityEntry struct {
+	widget.Entry
+	onActivity func()
+}
+
+func newActivityEntry(onActivity func()) *activityEntry {
+	entry := &activityEntry{onActivity: onActivity}
+	entry.MultiLine = true
+	entry.Wrapping = fyne.TextWrapWord
+	entry.ExtendBaseWidget(entry)
+
+	return entry
+}
+
+func (e *activityEntry) TypedRune(r rune) {
+	e.onActivity()
+	e.Entry.TypedRune(r)
+}
+
+func (e *activityEntry) TypedKey(key *fyne.KeyEvent) {
+	e.onActivity()
+	e.Entry.TypedKey(key)
+}
+
+func (e *activityEntry) TypedShortcut(shortcut fyne.Shortcut) {
+	e.onActivity()
+	e.Entry.TypedShortcut(shortcut)
+}
+
+func (e *activityEntry) MouseDown(m *desktop.MouseEvent) {
+	e.onActivity()
+	e.Entry.MouseDown(m)
+}
+
+func (e *activityEntry) Dragged(d *fyne.DragEvent) {
+	e.onActivity()
+	e.Entry.Dragged(d)
+}
+
+// activityLayer sits behind the content and reports pointer movement that no widget in front of it takes
+type activityLayer struct {
+	widget.BaseWidget
+	onActivity func()
+}
+
+var _ desktop.Hoverable = &activityLayer{}
+
+func newActivityLayer(onActivity func()) *activityLayer {
+	layer := &activityLayer{onActivity: onActivity}
+	layer.ExtendBaseWidget(layer)
+
+	return layer
+}
+
+func (l *activityLayer) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(canvas.NewRectangle(color.Transparent))
+}
+
+func (l *activityLayer) MouseIn(*desktop.MouseEvent) {
+	l.onActivity()
+}
+
+func (l *activityLayer) MouseMoved(*desktop.MouseEvent) {
+	l.onActivity()
+}
+
+func (l *activityLayer) MouseOut() {}
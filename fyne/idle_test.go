@@ -0,0 +1,35 @@
+package fyne
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleMonitor(t *testing.T) {
+	t.Parallel()
+
+	var idled int32
+	monitor := newIdleMonitor(200*time.Millisecond, func() {
+		atomic.AddInt32(&idled, 1)
+	})
+
+	// activity keeps pushing the timeout back
+	for i := 0; i < 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		monitor.Touch()
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&idled))
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&idled) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// a zero timeout turns monitoring off
+	monitor.Reset(0)
+	monitor.Touch()
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&idled))
+}
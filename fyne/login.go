@@ -2,53 +2,179 @@ package fyne
 
 import (
 	"fmt"
+	"soul"
+	"soul/secret"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
-func NewLoginPage(currentDbPath string,
-	onSubmitFunc func(email, password, updatedDbPath string, stayLoggedIn bool) error) fyne.CanvasObject {
+// sessionAgeOptions are the times "Keep It Open" is offered for
+var sessionAgeOptions = []struct {
+	name   string
+	maxAge time.Duration
+}{
+	{"1 day", 24 * time.Hour},
+	{"7 days", 7 * 24 * time.Hour},
+	{"30 days", 30 * 24 * time.Hour},
+	{"Until logout", 0},
+}
+
+// sessionCheckInOptions are the numbers of check-ins "Keep It Open" is offered for
+var sessionCheckInOptions = []struct {
+	name        string
+	maxCheckIns int
+}{
+	{"Unlimited", 0},
+	{"5", 5},
+	{"10", 10},
+	{"25", 25},
+}
+
+// NewLoginPage asks for a folder to open, profilePicker is shown above the form when not nil. The options policy
+// blocks are disabled, policy may be nil.
+func NewLoginPage(window fyne.Window, profilePicker fyne.CanvasObject, policy *soul.Policy, currentDbPath string, currentPolicy soul.SessionPolicy,
+	onSubmitFunc func(email string, password, pin *secret.Buffer, keyFilePath, updatedDbPath string, stayLoggedIn bool, policy soul.SessionPolicy) error,
+	onRecoverFunc func()) fyne.CanvasObject {
 	folderIdentifier := widget.NewEntry()
 	folderIdentifier.SetPlaceHolder("Folder Name")
 
 	passwordWidget := widget.NewPasswordEntry()
 	passwordWidget.SetPlaceHolder("Password")
 
+	keyFilePath := widget.NewEntry()
+	keyFilePath.SetPlaceHolder("Key File Path")
+	browseKeyFileButton := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			keyFilePath.SetText(reader.URI().Path())
+		}, window)
+	})
+
 	dbPath := widget.NewEntry()
 	dbPath.SetPlaceHolder("Db File Path")
 	dbPath.SetText(currentDbPath)
 
+	pinWidget := widget.NewPasswordEntry()
+	pinWidget.SetPlaceHolder("PIN")
+
+	var ageNames, checkInNames []string
+	for _, option := range sessionAgeOptions {
+		ageNames = append(ageNames, option.name)
+	}
+	for _, option := range sessionCheckInOptions {
+		checkInNames = append(checkInNames, option.name)
+	}
+
+	ageWidget := widget.NewSelect(ageNames, nil)
+	ageWidget.SetSelectedIndex(len(sessionAgeOptions) - 1)
+	for i, option := range sessionAgeOptions {
+		if option.maxAge == currentPolicy.MaxAge {
+			ageWidget.SetSelectedIndex(i)
+		}
+	}
+
+	checkInWidget := widget.NewSelect(checkInNames, nil)
+	checkInWidget.SetSelectedIndex(0)
+	for i, option := range sessionCheckInOptions {
+		if option.maxCheckIns == currentPolicy.MaxCheckIns {
+			checkInWidget.SetSelectedIndex(i)
+		}
+	}
+
+	sessionWidgets := []fyne.Disableable{pinWidget, ageWidget, checkInWidget}
 	stayLoggedIn := false
+	setSessionWidgets := func() {
+		for _, w := range sessionWidgets {
+			if stayLoggedIn {
+				w.Enable()
+			} else {
+				w.Disable()
+			}
+		}
+	}
+	setSessionWidgets()
+
 	savePreferencesCheckbox := widget.NewCheck("Keep It Open", func(b bool) {
 		stayLoggedIn = b
+		setSessionWidgets()
 	})
+	keepOpenHint := "Stay logged in"
+	if policy != nil && policy.CheckKeepOpen() != nil {
+		savePreferencesCheckbox.Disable()
+		keepOpenHint = "Not allowed by your organisation's policy"
+	}
+
+	passwordHint := "Do not forget this or all data is lost"
+	if policy != nil && policy.MinPasswordLength > 0 {
+		passwordHint = fmt.Sprintf("At least %d characters for new folders, do not forget it or all data is lost", policy.MinPasswordLength)
+	}
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
 			{Text: "Folder Name", Widget: folderIdentifier},
-			{Text: "Password", Widget: passwordWidget, HintText: "Do not forget this or all data is lost"},
+			{Text: "Password", Widget: passwordWidget, HintText: passwordHint},
+			{Text: "Key File", Widget: container.NewBorder(nil, nil, nil, browseKeyFileButton, keyFilePath),
+				HintText: "Optional, needed along with the password if the folder uses one"},
 			{Text: "Db Path", Widget: dbPath, HintText: "Absoulte path to the db file"},
-			{Widget: savePreferencesCheckbox, HintText: "Stay logged in"},
+			{Widget: savePreferencesCheckbox, HintText: keepOpenHint},
+			{Text: "Open For", Widget: ageWidget, HintText: "After this the folder password is needed again"},
+			{Text: "Check-ins", Widget: checkInWidget, HintText: "Check-ins allowed before the folder password is needed again"},
+			{Text: "PIN", Widget: pinWidget, HintText: fmt.Sprintf("Optional, at least %d characters, checks in instead of the password", soul.MinPINLength)},
 		},
 	}
 
+	recoverButton := widget.NewButton("Recover Access", func() {
+		onRecoverFunc()
+	})
+
 	submitButton := widget.NewButton("Submit", nil)
 	submitButton.OnTapped = func() {
 		form.Disable()
+		recoverButton.Disable()
 		submitButton.SetText("Logging in....")
 		defer func() {
 			submitButton.SetText("Submit")
 			form.Enable()
+			if policy != nil && policy.CheckKeepOpen() != nil {
+				savePreferencesCheckbox.Disable()
+			}
+			setSessionWidgets()
+			recoverButton.Enable()
 		}()
 
-		err := onSubmitFunc(folderIdentifier.Text, passwordWidget.Text, dbPath.Text, stayLoggedIn)
+		// the callee wipes the password, the entry is cleared so that its copy goes with the page
+		password := secret.FromString(passwordWidget.Text)
+		pin := secret.FromString(pinWidget.Text)
+		policy := soul.SessionPolicy{
+			MaxAge:      sessionAgeOptions[ageWidget.SelectedIndex()].maxAge,
+			MaxCheckIns: sessionCheckInOptions[checkInWidget.SelectedIndex()].maxCheckIns,
+		}
+		err := onSubmitFunc(folderIdentifier.Text, password, pin, keyFilePath.Text, dbPath.Text, stayLoggedIn, policy)
 		if err != nil {
 			fyne.CurrentApp().SendNotification(fyne.NewNotification("Unable to login",
 				fmt.Sprintf("unable to login/register due to %v", err)))
+			return
 		}
+
+		passwordWidget.SetText("")
+		pinWidget.SetText("")
+	}
+
+	page := container.NewVBox(form, container.NewCenter(
+		container.NewHBox(submitButton, recoverButton),
+	))
+	if profilePicker != nil {
+		page.Objects = append([]fyne.CanvasObject{profilePicker, widget.NewSeparator()}, page.Objects...)
 	}
 
-	return container.NewVBox(form, container.NewCenter(submitButton))
+	return page
 }
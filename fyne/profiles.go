@@ -0,0 +1,68 @@
+package fyne
+
+import (
+	"fmt"
+	"soul"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// NewProfilePicker lets the user switch between, add and remove profiles. Each callback is expected to show the page
+// of the profile it leaves selected, so the picker is rebuilt along with it.
+func NewProfilePicker(window fyne.Window, profiles []string, current string,
+	onSelectFunc func(name string) error,
+	onAddFunc func(name, dbPath string) error,
+	onRemoveFunc func(name string) error) fyne.CanvasObject {
+
+	notifyErr := func(title string, err error) {
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("%s %w", title, err), window)
+		}
+	}
+
+	profileSelect := widget.NewSelect(profiles, nil)
+	profileSelect.SetSelected(current)
+	profileSelect.OnChanged = func(name string) {
+		if name != current {
+			notifyErr("unable to switch profile", onSelectFunc(name))
+		}
+	}
+
+	addButton := widget.NewButtonWithIcon("", theme.ContentAddIcon(), func() {
+		nameEntry := widget.NewEntry()
+		nameEntry.SetPlaceHolder("Profile Name")
+		dbPathEntry := widget.NewEntry()
+		dbPathEntry.SetPlaceHolder("Db File Path")
+
+		dialog.ShowForm("Add Profile", "Add", "Cancel", []*widget.FormItem{
+			{Text: "Name", Widget: nameEntry},
+			{Text: "Db Path", Widget: dbPathEntry, HintText: "Optional, can be set when logging in"},
+		}, func(ok bool) {
+			if ok {
+				notifyErr("unable to add profile", onAddFunc(nameEntry.Text, dbPathEntry.Text))
+			}
+		}, window)
+	})
+
+	removeButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		dialog.ShowConfirm("Remove Profile",
+			fmt.Sprintf("Remove profile %s and the credentials kept for it? Its db file is left as is.", current),
+			func(ok bool) {
+				if ok {
+					notifyErr("unable to remove profile", onRemoveFunc(current))
+				}
+			}, window)
+	})
+	if current == soul.DefaultProfile {
+		removeButton.Disable()
+	}
+
+	return widget.NewForm(&widget.FormItem{
+		Text:   "Profile",
+		Widget: container.NewBorder(nil, nil, nil, container.NewHBox(addButton, removeButton), profileSelect),
+	})
+}
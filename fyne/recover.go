@@ -0,0 +1,61 @@
+package fyne
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+func NewRecoveryPage(currentDbPath string,
+	onSubmitFunc func(folderName, shares, newPassword, dbPath string) error, onCancelFunc func()) fyne.CanvasObject {
+	folderIdentifier := widget.NewEntry()
+	folderIdentifier.SetPlaceHolder("Folder Name")
+
+	sharesWidget := widget.NewMultiLineEntry()
+	sharesWidget.SetPlaceHolder("One recovery share per line")
+	sharesWidget.SetMinRowsVisible(5)
+
+	passwordWidget := widget.NewPasswordEntry()
+	passwordWidget.SetPlaceHolder("New Password")
+
+	dbPath := widget.NewEntry()
+	dbPath.SetPlaceHolder("Db File Path")
+	dbPath.SetText(currentDbPath)
+
+	form := &widget.Form{
+		Items: []*widget.FormItem{
+			{Text: "Folder Name", Widget: folderIdentifier},
+			{Text: "Shares", Widget: sharesWidget, HintText: "As many shares as were needed when they were created"},
+			{Text: "New Password", Widget: passwordWidget, HintText: "Opens the folder from now on"},
+			{Text: "Db Path", Widget: dbPath, HintText: "Absoulte path to the db file"},
+		},
+	}
+
+	cancelButton := widget.NewButton("Cancel", func() {
+		onCancelFunc()
+	})
+
+	submitButton := widget.NewButton("Recover", nil)
+	submitButton.OnTapped = func() {
+		form.Disable()
+		cancelButton.Disable()
+		submitButton.SetText("Recovering....")
+		defer func() {
+			submitButton.SetText("Recover")
+			form.Enable()
+			cancelButton.Enable()
+		}()
+
+		err := onSubmitFunc(folderIdentifier.Text, sharesWidget.Text, passwordWidget.Text, dbPath.Text)
+		if err != nil {
+			fyne.CurrentApp().SendNotification(fyne.NewNotification("Unable to recover",
+				fmt.Sprintf("unable to recover the folder due to %v", err)))
+		}
+	}
+
+	return container.NewVBox(form, container.NewCenter(
+		container.NewHBox(submitButton, cancelButton),
+	))
+}
@@ -0,0 +1,195 @@
+package fyne
+
+import (
+	"fmt"
+	"image/color"
+	"soul"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// settingsTheme is the theme picked in the settings with the editor font size applied to all text
+type settingsTheme struct {
+	fyne.Theme
+	variant  fyne.ThemeVariant
+	textSize float32
+	// fixedVariant is false for the system theme, which follows the variant fyne asks for
+	fixedVariant bool
+}
+
+func (t *settingsTheme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant) color.Color {
+	if t.fixedVariant {
+		variant = t.variant
+	}
+
+	return t.Theme.Color(name, variant)
+}
+
+func (t *settingsTheme) Size(name fyne.ThemeSizeName) float32 {
+	if name == theme.SizeNameText {
+		return t.textSize
+	}
+
+	return t.Theme.Size(name)
+}
+
+// NewSettingsTheme gives the theme the settings pick
+func NewSettingsTheme(settings soul.Settings) fyne.Theme {
+	t := &settingsTheme{Theme: theme.DefaultTheme(), textSize: settings.FontSize, fixedVariant: true}
+	switch settings.Theme {
+	case soul.ThemeLight:
+		t.variant = theme.VariantLight
+	case soul.ThemeSystem:
+		t.fixedVariant = false
+	default:
+		t.variant = theme.VariantDark
+	}
+
+	return t
+}
+
+// ApplyTheme sets the app's theme from the settings
+func ApplyTheme(app fyne.App, settings soul.Settings) {
+	app.Settings().SetTheme(NewSettingsTheme(settings))
+}
+
+// textWrap maps a wrap mode to the editor's wrapping
+func textWrap(mode soul.WrapMode) fyne.TextWrap {
+	switch mode {
+	case soul.WrapOff:
+		return fyne.TextWrapOff
+	case soul.WrapBreak:
+		return fyne.TextWrapBreak
+	default:
+		return fyne.TextWrapWord
+	}
+}
+
+// settingChoice is one of the values offered for a setting
+type settingChoice struct {
+	name  string
+	value interface{}
+}
+
+var themeChoices = []settingChoice{
+	{"Dark", soul.ThemeDark},
+	{"Light", soul.ThemeLight},
+	{"System", soul.ThemeSystem},
+}
+
+var fontSizeChoices = []settingChoice{
+	{"10", float32(10)},
+	{"12", float32(12)},
+	{"14", float32(14)},
+	{"16", float32(16)},
+	{"18", float32(18)},
+	{"20", float32(20)},
+	{"24", float32(24)},
+}
+
+var wrapChoices = []settingChoice{
+	{"At words", soul.WrapWord},
+	{"Anywhere", soul.WrapBreak},
+	{"Off", soul.WrapOff},
+}
+
+var sortChoices = []settingChoice{
+	{"Created", soul.SortCreated},
+	{"Title", soul.SortTitle},
+}
+
+var syncIntervalChoices = []settingChoice{
+	{"Never", time.Duration(0)},
+	{"5 seconds", 5 * time.Second},
+	{"15 seconds", 15 * time.Second},
+	{"30 seconds", 30 * time.Second},
+	{"1 minute", time.Minute},
+}
+
+// newChoiceSelect offers the choices with current selected, current is added as a choice of its own when it is not
+// one of them, so that opening the settings never changes a value
+func newChoiceSelect(choices []settingChoice, current interface{}) (*widget.Select, func() interface{}) {
+	selected := -1
+	var names []string
+	for i, choice := range choices {
+		names = append(names, choice.name)
+		if choice.value == current {
+			selected = i
+		}
+	}
+
+	if selected < 0 {
+		choices = append(append([]settingChoice(nil), choices...), settingChoice{fmt.Sprint(current), current})
+		names = append(names, fmt.Sprint(current))
+		selected = len(choices) - 1
+	}
+
+	selectWidget := widget.NewSelect(names, nil)
+	selectWidget.SetSelectedIndex(selected)
+
+	return selectWidget, func() interface{} {
+		return choices[selectWidget.SelectedIndex()].value
+	}
+}
+
+// showSettingsDialog lets the user change the settings of the open profile
+func (ui *Home) showSettingsDialog() {
+	settings := ui.settings
+
+	// the policy is checked again on save, failing to read it here only loses the hint
+	policy, _ := soul.ActivePolicy()
+	lockHint := "Of no keyboard or pointer activity"
+	var lockChoices []settingChoice
+	for _, option := range autoLockOptions {
+		if policy != nil && policy.CheckSettings(soul.Settings{AutoLock: option.timeout}) != nil {
+			lockHint = "Of no keyboard or pointer activity, limited by your organisation's policy"
+			continue
+		}
+		lockChoices = append(lockChoices, settingChoice{option.name, option.timeout})
+	}
+
+	themeWidget, themeValue := newChoiceSelect(themeChoices, settings.Theme)
+	fontSizeWidget, fontSizeValue := newChoiceSelect(fontSizeChoices, settings.FontSize)
+	wrapWidget, wrapValue := newChoiceSelect(wrapChoices, settings.Wrap)
+	sortWidget, sortValue := newChoiceSelect(sortChoices, settings.SortOrder)
+	syncWidget, syncValue := newChoiceSelect(syncIntervalChoices, settings.SyncInterval)
+	lockWidget, lockValue := newChoiceSelect(lockChoices, settings.AutoLock)
+	windowSizeWidget := widget.NewCheck("Remember the current window size", nil)
+
+	dialog.ShowForm("Settings", "Save", "Cancel", []*widget.FormItem{
+		{Text: "Theme", Widget: themeWidget},
+		{Text: "Font Size", Widget: fontSizeWidget},
+		{Text: "Wrap Lines", Widget: wrapWidget},
+		{Text: "Sort Notes By", Widget: sortWidget},
+		{Text: "Check Every", Widget: syncWidget, HintText: "Edits save once typing stops, this also checks every note"},
+		{Text: "Lock After", Widget: lockWidget, HintText: lockHint},
+		{Widget: windowSizeWidget, HintText: "Used when the app opens"},
+	}, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		settings.Theme = themeValue().(soul.Theme)
+		settings.FontSize = fontSizeValue().(float32)
+		settings.Wrap = wrapValue().(soul.WrapMode)
+		settings.SortOrder = sortValue().(soul.SortOrder)
+		settings.SyncInterval = syncValue().(time.Duration)
+		settings.AutoLock = lockValue().(time.Duration)
+		if windowSizeWidget.Checked && ui.window != nil {
+			size := ui.window.Canvas().Size()
+			settings.WindowWidth, settings.WindowHeight = size.Width, size.Height
+		}
+
+		err := soul.SaveSettings(ui.Config, settings)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("unable to save settings %w", err), ui.window)
+			return
+		}
+
+		ui.applySettings(settings)
+	}, ui.window)
+}
@@ -0,0 +1,348 @@
+package soul
+
+import (
+	"regexp"
+	"strings"
+)
+
+// conflict markers, in the diff3 style so that the ancestor is kept next to both sides
+const (
+	markerOurs   = "<<<<<<< mine"
+	markerBase   = "||||||| ancestor"
+	markerSplit  = "======="
+	markerTheirs = ">>>>>>> theirs"
+)
+
+// words splits text into runs of whitespace and runs of everything else, for merging within lines
+var words = regexp.MustCompile(`\s+|\S+`)
+
+// MergeHunk is a run of merged text, either merged cleanly or a conflict between both sides
+type MergeHunk struct {
+	// Text is the merged text of a clean hunk
+	Text     string
+	Conflict bool
+	// Base, Ours and Theirs are the ancestor's and each side's text of a conflict
+	Base   string
+	Ours   string
+	Theirs string
+}
+
+// MergeResult is the outcome of merging two descendants of a text
+type MergeResult struct {
+	Hunks []MergeHunk
+}
+
+// Resolution picks what a conflict resolves to
+type Resolution int
+
+const (
+	ResolveOurs Resolution = iota
+	ResolveTheirs
+	// ResolveBoth keeps our side followed by theirs
+	ResolveBoth
+)
+
+// Merge3 merges the changes ours and theirs each made to base. Changes to different lines merge, as do changes to
+// different words of the same lines, everything else is a conflict.
+func Merge3(base, ours, theirs string) MergeResult {
+	hunks := merge3(splitLines(base), splitLines(ours), splitLines(theirs))
+
+	var result MergeResult
+	for _, hunk := range hunks {
+		if hunk.Conflict {
+			// the same lines were changed on both sides, the words changed may still differ
+			wordHunks := merge3(splitWords(hunk.Base), splitWords(hunk.Ours), splitWords(hunk.Theirs))
+			if clean(wordHunks) {
+				hunk = MergeHunk{Text: joinHunks(wordHunks)}
+			}
+		}
+
+		result.append(hunk)
+	}
+
+	return result
+}
+
+// Clean tells whether the merge has no conflicts
+func (mr MergeResult) Clean() bool {
+	return clean(mr.Hunks)
+}
+
+// Conflicts counts the conflicts of the merge
+func (mr MergeResult) Conflicts() int {
+	conflicts := 0
+	for _, hunk := range mr.Hunks {
+		if hunk.Conflict {
+			conflicts++
+		}
+	}
+
+	return conflicts
+}
+
+// Text gives the merged text, conflicts are written out between conflict markers
+func (mr MergeResult) Text() string {
+	var text strings.Builder
+	for _, hunk := range mr.Hunks {
+		if !hunk.Conflict {
+			text.WriteString(hunk.Text)
+			continue
+		}
+
+		if text.Len() != 0 && !strings.HasSuffix(text.String(), "\n") {
+			text.WriteString("\n")
+		}
+		for _, part := range []string{markerOurs, hunk.Ours, markerBase, hunk.Base, markerSplit, hunk.Theirs, markerTheirs} {
+			if len(part) == 0 {
+				continue
+			}
+
+			text.WriteString(part)
+			if !strings.HasSuffix(part, "\n") {
+				text.WriteString("\n")
+			}
+		}
+	}
+
+	return text.String()
+}
+
+// Resolve gives the merged text with each conflict resolved by the resolution at its position among the conflicts,
+// conflicts without one keep our side
+func (mr MergeResult) Resolve(resolutions []Resolution) string {
+	var text strings.Builder
+	conflict := 0
+	for _, hunk := range mr.Hunks {
+		if !hunk.Conflict {
+			text.WriteString(hunk.Text)
+			continue
+		}
+
+		resolution := ResolveOurs
+		if conflict < len(resolutions) {
+			resolution = resolutions[conflict]
+		}
+		conflict++
+
+		switch resolution {
+		case ResolveTheirs:
+			text.WriteString(hunk.Theirs)
+		case ResolveBoth:
+			text.WriteString(hunk.Ours)
+			if len(hunk.Ours) != 0 && !strings.HasSuffix(hunk.Ours, "\n") {
+				text.WriteString("\n")
+			}
+			text.WriteString(hunk.Theirs)
+		default:
+			text.WriteString(hunk.Ours)
+		}
+	}
+
+	return text.String()
+}
+
+// ParseConflicts reads the conflicts Text wrote out back into hunks, so that they can be resolved later
+func ParseConflicts(text string) MergeResult {
+	var result MergeResult
+	var hunk *MergeHunk
+	var part *string
+	for _, line := range splitLines(text) {
+		marker := strings.TrimRight(line, "\r\n")
+		switch {
+		case marker == markerOurs && hunk == nil:
+			hunk = &MergeHunk{Conflict: true}
+			part = &hunk.Ours
+		case marker == markerBase && hunk != nil:
+			part = &hunk.Base
+		case marker == markerSplit && hunk != nil:
+			part = &hunk.Theirs
+		case marker == markerTheirs && hunk != nil:
+			result.append(*hunk)
+			hunk, part = nil, nil
+		case hunk != nil:
+			*part += line
+		default:
+			result.append(MergeHunk{Text: line})
+		}
+	}
+
+	// markers that were never closed are kept as they are
+	if hunk != nil {
+		result.append(MergeHunk{Text: markerOurs + "\n" + hunk.Ours})
+	}
+
+	return result
+}
+
+// HasConflicts tells whether text holds conflict markers
+func HasConflicts(text string) bool {
+	return ParseConflicts(text).Conflicts() != 0
+}
+
+// append adds a hunk, joining clean hunks that follow each other
+func (mr *MergeResult) append(hunk MergeHunk) {
+	last := len(mr.Hunks) - 1
+	if !hunk.Conflict && last >= 0 && !mr.Hunks[last].Conflict {
+		mr.Hunks[last].Text += hunk.Text
+		return
+	}
+
+	mr.Hunks = append(mr.Hunks, hunk)
+}
+
+func clean(hunks []MergeHunk) bool {
+	for _, hunk := range hunks {
+		if hunk.Conflict {
+			return false
+		}
+	}
+
+	return true
+}
+
+func joinHunks(hunks []MergeHunk) string {
+	var text strings.Builder
+	for _, hunk := range hunks {
+		text.WriteString(hunk.Text)
+	}
+
+	return text.String()
+}
+
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func splitWords(text string) []string {
+	return words.FindAllString(text, -1)
+}
+
+// merge3 merges token sequences the diff3 way, runs of base that both sides kept split the sequences into chunks and
+// a chunk changed on both sides, differently, is a conflict
+func merge3(base, ours, theirs []string) []MergeHunk {
+	oursAt, theirsAt := matches(base, ours), matches(base, theirs)
+
+	var hunks []MergeHunk
+	i, a, b := 0, 0, 0
+	for i < len(base) || a < len(ours) || b < len(theirs) {
+		// kept on both sides
+		if i < len(base) && oursAt[i] == a && theirsAt[i] == b {
+			hunks = append(hunks, MergeHunk{Text: base[i]})
+			i, a, b = i+1, a+1, b+1
+			continue
+		}
+
+		// the chunk runs up to the next token of base that both sides kept
+		j, oj, tj := i, len(ours), len(theirs)
+		for ; j < len(base); j++ {
+			if oursAt[j] >= a && theirsAt[j] >= b {
+				oj, tj = oursAt[j], theirsAt[j]
+				break
+			}
+		}
+
+		baseChunk := strings.Join(base[i:j], "")
+		oursChunk := strings.Join(ours[a:oj], "")
+		theirsChunk := strings.Join(theirs[b:tj], "")
+		switch {
+		case oursChunk == baseChunk:
+			hunks = append(hunks, MergeHunk{Text: theirsChunk})
+		case theirsChunk == baseChunk, oursChunk == theirsChunk:
+			hunks = append(hunks, MergeHunk{Text: oursChunk})
+		default:
+			hunks = append(hunks, MergeHunk{Conflict: true, Base: baseChunk, Ours: oursChunk, Theirs: theirsChunk})
+		}
+		i, a, b = j, oj, tj
+	}
+
+	return hunks
+}
+
+// matches gives, for each token of a, the position of the token of b it matches in a longest common subsequence or -1
+func matches(a, b []string) []int {
+	at := make([]int, len(a))
+	for i := range at {
+		at[i] = -1
+	}
+
+	for _, pair := range commonSubsequence(a, b) {
+		at[pair[0]] = pair[1]
+	}
+
+	return at
+}
+
+// commonSubsequence finds the pairs of matching tokens of a longest common subsequence of a and b with Myers'
+// algorithm, which is quick when the sequences differ little as notes edited apart usually do
+func commonSubsequence(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+
+	// trace holds, for each number of edits d, the furthest x reached on each diagonal k, at k+d
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		v := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			switch {
+			case d == 0:
+				x = 0
+			case k == -d || (k != d && trace[d-1][k-1+d-1] < trace[d-1][k+1+d-1]):
+				x = trace[d-1][k+1+d-1]
+			default:
+				x = trace[d-1][k-1+d-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[k+d] = x
+
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		trace = append(trace, v)
+	}
+
+	// walk the edits back from the end, collecting the matches of each snake
+	var pairs [][2]int
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+		startX := 0
+		prevX, prevY := 0, 0
+		if d > 0 {
+			prevK := k - 1
+			if k == -d || (k != d && trace[d-1][k-1+d-1] < trace[d-1][k+1+d-1]) {
+				prevK = k + 1
+			}
+
+			prevX = trace[d-1][prevK+d-1]
+			prevY = prevX - prevK
+			startX = prevX
+			if prevK == k-1 {
+				startX++
+			}
+		}
+
+		for x > startX && y > startX-k {
+			x, y = x-1, y-1
+			pairs = append(pairs, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+
+	return pairs
+}
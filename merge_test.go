@@ -0,0 +1,85 @@
+package soul_test
+
+import (
+	"math/rand"
+	"soul"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge3(t *testing.T) {
+	t.Parallel()
+
+	base := "title\nfirst line\nsecond line\nthird line\n"
+	tests := []struct {
+		name, ours, theirs, merged string
+	}{
+		{"different lines", "title\nfirst line edited\nsecond line\nthird line\n", "title\nfirst line\nsecond line\nthird line edited\n",
+			"title\nfirst line edited\nsecond line\nthird line edited\n"},
+		{"different words of a line", "title\nthe first line\nsecond line\nthird line\n", "title\nfirst line here\nsecond line\nthird line\n",
+			"title\nthe first line here\nsecond line\nthird line\n"},
+		{"additions and deletions", "title\nsecond line\nthird line\nfourth line\n", "new title\ntitle\nfirst line\nsecond line\nthird line\n",
+			"new title\ntitle\nsecond line\nthird line\nfourth line\n"},
+		{"the same edit", "title\nfirst line\n", "title\nfirst line\n", "title\nfirst line\n"},
+		{"one side only", base, "title\n", "title\n"},
+	}
+
+	for _, test := range tests {
+		result := soul.Merge3(base, test.ours, test.theirs)
+		assert.True(t, result.Clean(), test.name)
+		assert.Equal(t, test.merged, result.Text(), test.name)
+	}
+}
+
+func TestMerge3Conflicts(t *testing.T) {
+	t.Parallel()
+
+	base := "title\nfirst line\nsecond line\nthird line\n"
+	result := soul.Merge3(base, "title\nfirst line on the laptop\nsecond line\nthird line\n", "title\nfirst line on the desktop\nsecond line\nthird line edited\n")
+	assert.False(t, result.Clean())
+	assert.Equal(t, 1, result.Conflicts())
+
+	text := result.Text()
+	assert.Equal(t, "title\n"+
+		"<<<<<<< mine\nfirst line on the laptop\n"+
+		"||||||| ancestor\nfirst line\n"+
+		"=======\nfirst line on the desktop\n"+
+		">>>>>>> theirs\n"+
+		"second line\nthird line edited\n", text)
+	assert.True(t, soul.HasConflicts(text))
+	assert.False(t, soul.HasConflicts(base))
+
+	// the markers read back to the same conflicts, which resolve either way
+	parsed := soul.ParseConflicts(text)
+	assert.Equal(t, result, parsed)
+	assert.Equal(t, "title\nfirst line on the desktop\nsecond line\nthird line edited\n", parsed.Resolve([]soul.Resolution{soul.ResolveTheirs}))
+	assert.Equal(t, "title\nfirst line on the laptop\nfirst line on the desktop\nsecond line\nthird line edited\n", parsed.Resolve([]soul.Resolution{soul.ResolveBoth}))
+	assert.Equal(t, "title\nfirst line on the laptop\nsecond line\nthird line edited\n", parsed.Resolve(nil))
+
+	// an unfinished conflict is just text
+	assert.False(t, soul.HasConflicts("<<<<<<< mine\nnot closed\n"))
+	assert.Equal(t, "<<<<<<< mine\nnot closed\n", soul.ParseConflicts("<<<<<<< mine\nnot closed\n").Text())
+}
+
+func TestMerge3OneSided(t *testing.T) {
+	t.Parallel()
+
+	// a change on one side only always comes through as it is, however the lines moved
+	random := rand.New(rand.NewSource(1))
+	lines := []string{"a\n", "b\n", "c\n", "d\n", "e\n"}
+	text := func() string {
+		var text strings.Builder
+		for i := random.Intn(20); i > 0; i-- {
+			text.WriteString(lines[random.Intn(len(lines))])
+		}
+		return text.String()
+	}
+
+	for i := 0; i < 500; i++ {
+		base, changed := text(), text()
+		assert.Equal(t, changed, soul.Merge3(base, changed, base).Text())
+		assert.Equal(t, changed, soul.Merge3(base, base, changed).Text())
+	}
+}
@@ -2,7 +2,10 @@ package soul
 
 import (
 	"errors"
+	"sort"
+	"soul/crdt"
 	"strings"
+	"sync"
 
 	"fyne.io/fyne/v2/data/binding"
 )
@@ -15,6 +18,9 @@ type Note struct {
 	ID      string
 	Text    binding.String
 	Version Version
+	// Doc backs the text with a sequence CRDT so that edits made on other devices merge without conflicts, it is nil
+	// for plain text notes
+	Doc *crdt.Doc
 }
 
 // NoteRepository is a repository of notes
@@ -25,8 +31,16 @@ type NoteRepository interface {
 }
 
 type NoteService struct {
-	Repo  NoteRepository
+	Repo NoteRepository
+	// Notes are the notes loaded, code that may run alongside a reload reads them with Snapshot, Len and NoteAt
 	Notes []Note
+	// created is the position of each note in the order it was created, for sorting back to it
+	created map[string]int
+	// mu guards Notes and created, which are reloaded in the background
+	mu sync.RWMutex
+	// saved holds the text of each note as it was last loaded or saved, the base edits made elsewhere are merged from
+	saved   map[string]string
+	savedMu sync.Mutex
 }
 
 func (ns *NoteService) LoadAll() error {
@@ -35,11 +49,128 @@ func (ns *NoteService) LoadAll() error {
 		return err
 	}
 
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
 	ns.Notes = notes
+	ns.created = make(map[string]int, len(notes))
+	for i, note := range notes {
+		ns.created[note.ID] = i
+		note.trackEdits()
+		ns.markSaved(&note)
+	}
 
 	return nil
 }
 
+// Snapshot gives a copy of Notes, the notes share their texts with the ones in Notes
+func (ns *NoteService) Snapshot() []Note {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	return append([]Note(nil), ns.Notes...)
+}
+
+// Len gives the number of notes
+func (ns *NoteService) Len() int {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	return len(ns.Notes)
+}
+
+// NoteAt gives the note at position i of Notes, false when there is none there
+func (ns *NoteService) NoteAt(i int) (Note, bool) {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	if i < 0 || i >= len(ns.Notes) {
+		return Note{}, false
+	}
+
+	return ns.Notes[i], true
+}
+
+// Clear drops the notes loaded
+func (ns *NoteService) Clear() {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	ns.Notes = nil
+}
+
+// markSaved keeps the text of a note as the one that is stored
+func (ns *NoteService) markSaved(note *Note) {
+	text, err := note.Text.Get()
+	if err != nil {
+		return
+	}
+
+	ns.setSaved(note.ID, text)
+}
+
+func (ns *NoteService) setSaved(id, text string) {
+	ns.savedMu.Lock()
+	defer ns.savedMu.Unlock()
+
+	if ns.saved == nil {
+		ns.saved = make(map[string]string)
+	}
+	ns.saved[id] = text
+}
+
+// savedText gives the text of a note as it was last loaded or saved
+func (ns *NoteService) savedText(id string) (string, bool) {
+	ns.savedMu.Lock()
+	defer ns.savedMu.Unlock()
+
+	text, ok := ns.saved[id]
+	return text, ok
+}
+
+// appendNote adds a newly created note to the end of Notes and gives the note as it is in Notes, which is the one
+// already there when a reload got to it first. The caller holds ns.mu.
+func (ns *NoteService) appendNote(note Note) Note {
+	for _, existing := range ns.Notes {
+		if existing.ID == note.ID {
+			return existing
+		}
+	}
+
+	if ns.created == nil {
+		ns.created = make(map[string]int)
+	}
+
+	ns.created[note.ID] = len(ns.created)
+	ns.Notes = append(ns.Notes, note)
+	ns.markSaved(&note)
+
+	return note
+}
+
+// Sort orders Notes by the given order, notes with the same title keep their relative order
+func (ns *NoteService) Sort(order SortOrder) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	switch order {
+	case SortTitle:
+		titles := make(map[string]string, len(ns.Notes))
+		for _, note := range ns.Notes {
+			title, _ := note.Title().Get()
+			titles[note.ID] = strings.ToLower(title)
+		}
+
+		sort.SliceStable(ns.Notes, func(i, j int) bool {
+			return titles[ns.Notes[i].ID] < titles[ns.Notes[j].ID]
+		})
+	default:
+		sort.SliceStable(ns.Notes, func(i, j int) bool {
+			return ns.created[ns.Notes[i].ID] < ns.created[ns.Notes[j].ID]
+		})
+	}
+}
+
 func (ns *NoteService) Create() (*Note, error) {
 	note := Note{Text: binding.NewString()}
 	err := ns.Repo.Create(&note)
@@ -47,13 +178,71 @@ func (ns *NoteService) Create() (*Note, error) {
 		return nil, err
 	}
 
-	ns.Notes = append(ns.Notes, note)
+	ns.mu.Lock()
+	note = ns.appendNote(note)
+	ns.mu.Unlock()
 
 	return &note, nil
 }
 
 func (ns *NoteService) Update(note *Note) error {
-	return ns.Repo.Update(note)
+	text, err := note.Text.Get()
+	if err != nil {
+		return err
+	}
+
+	err = ns.Repo.Update(note)
+	if err != nil {
+		return err
+	}
+
+	ns.setSaved(note.ID, text)
+
+	return nil
+}
+
+// SetConflictFree switches a note between plain text and text backed by a sequence CRDT, which merges edits made on
+// other devices without conflicts at the cost of keeping deleted characters around
+func (ns *NoteService) SetConflictFree(note *Note, enabled bool) error {
+	if enabled == (note.Doc != nil) {
+		return nil
+	}
+
+	note.Doc = nil
+	if enabled {
+		text, err := note.Text.Get()
+		if err != nil {
+			return err
+		}
+
+		note.Doc = crdt.FromText(text)
+		note.trackEdits()
+	}
+
+	ns.mu.Lock()
+	for i := range ns.Notes {
+		if ns.Notes[i].ID == note.ID {
+			ns.Notes[i].Doc = note.Doc
+		}
+	}
+	ns.mu.Unlock()
+
+	return ns.Update(note)
+}
+
+// trackEdits turns each edit of a CRDT note's text into operations on its document as it is made
+func (note *Note) trackEdits() {
+	doc, text := note.Doc, note.Text
+	if doc == nil {
+		return
+	}
+
+	text.AddListener(binding.NewDataListener(func() {
+		current, err := text.Get()
+		if err == nil {
+			doc.SetText(current)
+		}
+	}))
 }
 
 // NewNoteService creates a new NoteService
@@ -0,0 +1,192 @@
+package p2p
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// maxFrame bounds what a peer may send in one frame, as big as a record the sync server takes
+const maxFrame = 64 << 20
+
+// channel is a connection both ends authenticated with the folder password, everything sent on it is encrypted and
+// numbered so that frames cannot be altered, replayed or reordered
+type channel struct {
+	conn    io.ReadWriter
+	sealer  cipher.AEAD
+	opener  cipher.AEAD
+	sendSeq uint64
+	recvSeq uint64
+}
+
+// handshake runs SPAKE2 over conn and has both sides confirm they hold the same keys before anything else is sent.
+// The responder confirms first, so that the initiator learns nothing from a responder that does not know the password.
+func handshake(conn io.ReadWriter, w *big.Int, initiator bool) (*channel, error) {
+	pake, err := newSpake2(w, initiator)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys *sessionKeys
+	if initiator {
+		err = writeFrame(conn, pake.share)
+		if err != nil {
+			return nil, err
+		}
+
+		share, err := readFrame(conn)
+		if err != nil {
+			return nil, err
+		}
+		keys, err = pake.finish(share)
+		if err != nil {
+			return nil, err
+		}
+
+		err = expectFrame(conn, keys.confirmResponder)
+		if err != nil {
+			return nil, err
+		}
+		err = writeFrame(conn, keys.confirmInitiator)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		share, err := readFrame(conn)
+		if err != nil {
+			return nil, err
+		}
+		keys, err = pake.finish(share)
+		if err != nil {
+			return nil, err
+		}
+
+		err = writeFrame(conn, pake.share)
+		if err != nil {
+			return nil, err
+		}
+		err = writeFrame(conn, keys.confirmResponder)
+		if err != nil {
+			return nil, err
+		}
+		err = expectFrame(conn, keys.confirmInitiator)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// an initiator that could not confirm our keys hangs up
+			return nil, fmt.Errorf("the peer hung up instead of confirming, %w", ErrAuth)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sendKey, recvKey := keys.initiator, keys.responder
+	if !initiator {
+		sendKey, recvKey = recvKey, sendKey
+	}
+
+	ch := &channel{conn: conn}
+	ch.sealer, err = newAEAD(sendKey)
+	if err != nil {
+		return nil, err
+	}
+	ch.opener, err = newAEAD(recvKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// write encrypts and sends one message
+func (ch *channel) write(message []byte) error {
+	sealed := ch.sealer.Seal(nil, nonce(ch.sendSeq), message, nil)
+	ch.sendSeq++
+
+	return writeFrame(ch.conn, sealed)
+}
+
+// read reads and decrypts the next message
+func (ch *channel) read() ([]byte, error) {
+	sealed, err := readFrame(ch.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := ch.opener.Open(nil, nonce(ch.recvSeq), sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt a message from the peer %w", err)
+	}
+	ch.recvSeq++
+
+	return message, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// nonce gives the nonce of the message numbered seq, each direction has a key of its own so numbers never repeat
+// under a key
+func nonce(seq uint64) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[4:], seq)
+
+	return n
+}
+
+// expectFrame reads a confirmation tag and checks it against the one expected
+func expectFrame(r io.Reader, expected []byte) error {
+	tag, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(tag, expected) {
+		return ErrAuth
+	}
+
+	return nil
+}
+
+func writeFrame(w io.Writer, data []byte) error {
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	_, err := w.Write(frame)
+	if err != nil {
+		return fmt.Errorf("failed to send to the peer %w", err)
+	}
+
+	return nil
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	_, err := io.ReadFull(r, length[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive from the peer %w", err)
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size > maxFrame {
+		return nil, fmt.Errorf("the peer sent %d bytes, more than the %d a frame may hold", size, maxFrame)
+	}
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive from the peer %w", err)
+	}
+
+	return data, nil
+}
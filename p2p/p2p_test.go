@@ -0,0 +1,210 @@
+package p2p_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"soul"
+	"soul/crypt"
+	"soul/disk"
+	"soul/p2p"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	folder   = "folder"
+	password = "peer key"
+)
+
+type exchange struct {
+	report *disk.MergeReport
+	err    error
+}
+
+// openRepository opens the folder in a new db file, as another machine would
+func openRepository(t *testing.T, password string) *disk.NoteRepository {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "soul-p2p")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	db, err := bolt.Open(filepath.Join(dir, "soul.db"), 0600, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	repo, err := disk.NewNoteRepositoryWithDb(db, folder, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+
+	return repo
+}
+
+// serve runs peer on a loopback listener and gives its address and the outcome of each exchange
+func serve(t *testing.T, peer *p2p.Peer) (string, chan exchange) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	exchanges := make(chan exchange, 4)
+	go peer.Serve(l, func(_ net.Addr, report *disk.MergeReport, err error) {
+		exchanges <- exchange{report: report, err: err}
+	})
+
+	return l.Addr().String(), exchanges
+}
+
+func texts(t *testing.T, repo soul.NoteRepository) []string {
+	t.Helper()
+
+	notes, err := repo.GetAll()
+	assert.Nil(t, err)
+
+	var texts []string
+	for _, note := range notes {
+		text, _ := note.Text.Get()
+		texts = append(texts, text)
+	}
+	sort.Strings(texts)
+
+	return texts
+}
+
+// recordingConn keeps everything that went over the connection
+type recordingConn struct {
+	net.Conn
+	wire bytes.Buffer
+}
+
+func (rc *recordingConn) Read(b []byte) (int, error) {
+	n, err := rc.Conn.Read(b)
+	rc.wire.Write(b[:n])
+
+	return n, err
+}
+
+func (rc *recordingConn) Write(b []byte) (int, error) {
+	rc.wire.Write(b)
+
+	return rc.Conn.Write(b)
+}
+
+func TestSyncPeers(t *testing.T) {
+	laptop, desktop := openRepository(t, password), openRepository(t, password)
+	addr, exchanges := serve(t, p2p.NewPeer(desktop, folder, password))
+	peer := p2p.NewPeer(laptop, folder, password)
+
+	note := soul.Note{Text: soul.NewBindingFromString("laptop note")}
+	assert.Nil(t, laptop.Create(&note))
+	assert.Nil(t, desktop.Create(&soul.Note{Text: soul.NewBindingFromString("desktop note")}))
+
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	recorded := &recordingConn{Conn: conn}
+	report, err := peer.SyncConn(recorded)
+	assert.Nil(t, err)
+	conn.Close()
+	assert.Len(t, report.Added, 1)
+
+	served := <-exchanges
+	assert.Nil(t, served.err)
+	assert.Len(t, served.report.Added, 1)
+
+	assert.Equal(t, []string{"desktop note", "laptop note"}, texts(t, laptop))
+	assert.Equal(t, []string{"desktop note", "laptop note"}, texts(t, desktop))
+
+	// neither the notes, the folder nor its password went over the network in the clear
+	assert.NotEmpty(t, recorded.wire.Bytes())
+	for _, plain := range []string{"laptop", "desktop", folder, password} {
+		assert.False(t, bytes.Contains(recorded.wire.Bytes(), []byte(plain)))
+	}
+
+	// an edit on one side reaches the other on the next sync
+	assert.Nil(t, note.Text.Set("edited on the laptop"))
+	assert.Nil(t, laptop.Update(&note))
+	_, err = peer.Sync(addr)
+	assert.Nil(t, err)
+	assert.Nil(t, (<-exchanges).err)
+	assert.Equal(t, []string{"desktop note", "edited on the laptop"}, texts(t, desktop))
+}
+
+func TestSyncWrongPassword(t *testing.T) {
+	laptop, desktop := openRepository(t, "guessed key"), openRepository(t, password)
+	addr, exchanges := serve(t, p2p.NewPeer(desktop, folder, password))
+
+	assert.Nil(t, desktop.Create(&soul.Note{Text: soul.NewBindingFromString("desktop note")}))
+	assert.Nil(t, laptop.Create(&soul.Note{Text: soul.NewBindingFromString("laptop note")}))
+
+	_, err := p2p.NewPeer(laptop, folder, "guessed key").Sync(addr)
+	assert.True(t, errors.Is(err, p2p.ErrAuth))
+	assert.True(t, errors.Is((<-exchanges).err, p2p.ErrAuth))
+
+	// a peer claiming to know the password fares no better
+	_, err = p2p.NewPeer(desktop, folder, "guessed key").Sync(addr)
+	assert.True(t, errors.Is(err, p2p.ErrAuth))
+	assert.True(t, errors.Is((<-exchanges).err, p2p.ErrAuth))
+
+	assert.Equal(t, []string{"desktop note"}, texts(t, desktop))
+	assert.Equal(t, []string{"laptop note"}, texts(t, laptop))
+}
+
+func TestSyncKeyFile(t *testing.T) {
+	keyFile, err := crypt.NewKeyFile()
+	assert.Nil(t, err)
+	combined, err := crypt.CombineWithKeyFile(password, keyFile)
+	assert.Nil(t, err)
+
+	laptop, desktop := openRepository(t, combined), openRepository(t, combined)
+	served, err := p2p.NewPeerWithKeyFile(desktop, folder, password, keyFile)
+	assert.Nil(t, err)
+	addr, exchanges := serve(t, served)
+	assert.Nil(t, desktop.Create(&soul.Note{Text: soul.NewBindingFromString("desktop note")}))
+
+	// the password alone is not enough for a folder that needs its key file
+	_, err = p2p.NewPeer(laptop, folder, password).Sync(addr)
+	assert.True(t, errors.Is(err, p2p.ErrAuth))
+	assert.True(t, errors.Is((<-exchanges).err, p2p.ErrAuth))
+
+	peer, err := p2p.NewPeerWithKeyFile(laptop, folder, password, keyFile)
+	assert.Nil(t, err)
+	_, err = peer.Sync(addr)
+	assert.Nil(t, err)
+	assert.Nil(t, (<-exchanges).err)
+	assert.Equal(t, []string{"desktop note"}, texts(t, laptop))
+}
+
+func TestSyncPastStalledPeer(t *testing.T) {
+	laptop, desktop := openRepository(t, password), openRepository(t, password)
+	addr, exchanges := serve(t, p2p.NewPeer(desktop, folder, password))
+	assert.Nil(t, desktop.Create(&soul.Note{Text: soul.NewBindingFromString("desktop note")}))
+
+	// a connection that never authenticates does not hold up the peers that do
+	stalled, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer stalled.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	synced := make(chan error, 1)
+	go func() {
+		_, err := p2p.NewPeer(laptop, folder, password).Sync(addr)
+		synced <- err
+	}()
+
+	select {
+	case err := <-synced:
+		assert.Nil(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the sync waited on the stalled peer")
+	}
+	assert.Nil(t, (<-exchanges).err)
+	assert.Equal(t, []string{"desktop note"}, texts(t, laptop))
+}
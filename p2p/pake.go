@@ -0,0 +1,163 @@
+package p2p
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// ErrAuth is given when the other peer does not know the folder password, or the exchange was tampered with
+var ErrAuth = errors.New("the peer failed to authenticate, check that both use the same folder password")
+
+var curve = elliptic.P256()
+
+// m and n are the points both sides blind their shares with, hashed onto the curve so that nobody knows their discrete
+// logs
+var (
+	mx, my = hashToPoint("soul p2p spake2 M")
+	nx, ny = hashToPoint("soul p2p spake2 N")
+)
+
+// hashToPoint maps seed to a point of the curve by trying hashes of it as x until one is on the curve
+func hashToPoint(seed string) (*big.Int, *big.Int) {
+	params := curve.Params()
+	three := big.NewInt(3)
+	for counter := uint32(0); ; counter++ {
+		h := sha256.New()
+		h.Write([]byte(seed))
+		binary.Write(h, binary.BigEndian, counter)
+
+		x := new(big.Int).SetBytes(h.Sum(nil))
+		x.Mod(x, params.P)
+
+		// y² = x³ - 3x + b
+		y2 := new(big.Int).Exp(x, three, params.P)
+		y2.Sub(y2, new(big.Int).Mul(three, x))
+		y2.Add(y2, params.B)
+		y2.Mod(y2, params.P)
+
+		y := new(big.Int).ModSqrt(y2, params.P)
+		if y == nil {
+			continue
+		}
+
+		// either root will do as long as both sides pick the same
+		if y.Bit(0) == 1 {
+			y.Sub(params.P, y)
+		}
+
+		return x, y
+	}
+}
+
+// passwordScalar derives the secret both peers share from what opens the folder, the password combined with the key
+// file for folders that use one
+func passwordScalar(folder string, password []byte) *big.Int {
+	h := sha256.New()
+	h.Write([]byte("soul p2p password"))
+	writeField(h, []byte(folder))
+	writeField(h, password)
+
+	w := new(big.Int).SetBytes(h.Sum(nil))
+	return w.Mod(w, curve.Params().N)
+}
+
+// spake2 is one side of a SPAKE2 exchange, it lets two peers that know the same password agree on a key without
+// giving anyone listening, or a peer that does not know it, anything to guess the password against offline
+type spake2 struct {
+	initiator bool
+	w         *big.Int
+	secret    *big.Int
+	share     []byte
+}
+
+func newSpake2(w *big.Int, initiator bool) (*spake2, error) {
+	secret, err := rand.Int(rand.Reader, new(big.Int).Sub(curve.Params().N, big.NewInt(1)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret %w", err)
+	}
+	secret.Add(secret, big.NewInt(1))
+
+	// the initiator blinds with m and the responder with n, so that a share cannot be reflected back
+	bx, by := mx, my
+	if !initiator {
+		bx, by = nx, ny
+	}
+
+	gx, gy := curve.ScalarBaseMult(secret.Bytes())
+	wx, wy := curve.ScalarMult(bx, by, w.Bytes())
+	x, y := curve.Add(gx, gy, wx, wy)
+
+	return &spake2{initiator: initiator, w: w, secret: secret, share: elliptic.Marshal(curve, x, y)}, nil
+}
+
+// sessionKeys are the keys a finished exchange gives each side
+type sessionKeys struct {
+	// initiator and responder encrypt what each side sends
+	initiator, responder []byte
+	// confirmInitiator and confirmResponder are the tags each side proves it has the same keys with
+	confirmInitiator, confirmResponder []byte
+}
+
+// finish takes the other side's share and derives the session keys
+func (s *spake2) finish(other []byte) (*sessionKeys, error) {
+	ox, oy := elliptic.Unmarshal(curve, other)
+	if ox == nil {
+		return nil, ErrAuth
+	}
+
+	bx, by := nx, ny
+	if !s.initiator {
+		bx, by = mx, my
+	}
+
+	// unblind the other share, K = secret · (share - w · blind)
+	wx, wy := curve.ScalarMult(bx, by, s.w.Bytes())
+	wy = new(big.Int).Sub(curve.Params().P, wy)
+	ux, uy := curve.Add(ox, oy, wx, wy)
+	kx, ky := curve.ScalarMult(ux, uy, s.secret.Bytes())
+	if kx.Sign() == 0 && ky.Sign() == 0 {
+		return nil, ErrAuth
+	}
+
+	initiatorShare, responderShare := s.share, other
+	if !s.initiator {
+		initiatorShare, responderShare = other, s.share
+	}
+
+	transcript := sha256.New()
+	transcript.Write([]byte("soul p2p v1"))
+	writeField(transcript, initiatorShare)
+	writeField(transcript, responderShare)
+	writeField(transcript, elliptic.Marshal(curve, kx, ky))
+	writeField(transcript, s.w.Bytes())
+	key := transcript.Sum(nil)
+
+	return &sessionKeys{
+		initiator:        derive(key, "initiator key"),
+		responder:        derive(key, "responder key"),
+		confirmInitiator: derive(key, "initiator confirmation"),
+		confirmResponder: derive(key, "responder confirmation"),
+	}, nil
+}
+
+func derive(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+
+	return mac.Sum(nil)
+}
+
+// writeField writes data with its length so that fields cannot run into each other
+func writeField(h io.Writer, data []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	h.Write(length[:])
+	h.Write(data)
+}
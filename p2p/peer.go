@@ -0,0 +1,231 @@
+// Package p2p syncs a folder directly between two machines on the same network. Peers find each other by address,
+// prove to each other that they know the folder password with SPAKE2 and then trade the encrypted folder records of
+// their disk repositories over a channel keyed by the exchange. Neither the password nor the notes ever cross the
+// network in the clear, and a peer that does not know the password learns nothing it could guess it from.
+package p2p
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"soul/crypt"
+	"soul/disk"
+	"soul/secret"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAddr is the address peers listen on when none is given
+	DefaultAddr = ":8421"
+	// DefaultTimeout bounds a whole exchange with a peer
+	DefaultTimeout = time.Minute
+)
+
+// message is what peers send each other once authenticated
+type message struct {
+	// Record is the encrypted folder value given by disk.NoteRepository.Record
+	Record []byte
+	// Err tells the other side why this one gave up
+	Err string
+}
+
+// Peer syncs a folder with other peers, it listens for them with Serve and reaches out to them with Sync
+type Peer struct {
+	repo *disk.NoteRepository
+	w    *big.Int
+	// Timeout bounds each exchange, DefaultTimeout when zero
+	Timeout time.Duration
+
+	// mu keeps to one merge at a time. It is not held while talking to a peer, so one that never finishes the
+	// handshake does not hold up the others.
+	mu sync.Mutex
+}
+
+// NewPeer syncs the folder of repo, password is the folder's which only peers that know it can sync with
+func NewPeer(repo *disk.NoteRepository, folder, password string) *Peer {
+	return &Peer{repo: repo, w: passwordScalar(folder, []byte(password))}
+}
+
+// NewPeerWithKeyFile syncs the folder of repo for a folder that opens with password and keyFile, only peers that have
+// both can sync with it
+func NewPeerWithKeyFile(repo *disk.NoteRepository, folder, password string, keyFile []byte) (*Peer, error) {
+	buffer := secret.FromString(password)
+	defer buffer.Wipe()
+
+	combined, err := crypt.CombineSecretWithKeyFile(buffer, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer combined.Wipe()
+
+	return &Peer{repo: repo, w: passwordScalar(folder, combined.Bytes())}, nil
+}
+
+// Serve accepts peers on l until it is closed, done is called after each exchange with its outcome when not nil
+func (p *Peer) Serve(l net.Listener, done func(addr net.Addr, report *disk.MergeReport, err error)) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return fmt.Errorf("failed to accept peers %w", err)
+		}
+
+		go func() {
+			defer conn.Close()
+			report, err := p.ServeConn(conn)
+			if done != nil {
+				done(conn.RemoteAddr(), report, err)
+			}
+		}()
+	}
+}
+
+// Sync connects to the peer at addr and syncs the folder with it, both end up with the same notes
+func (p *Peer) Sync(addr string) (*disk.MergeReport, error) {
+	conn, err := net.DialTimeout("tcp", addr, p.timeout())
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach peer %w", err)
+	}
+	defer conn.Close()
+
+	return p.SyncConn(conn)
+}
+
+// SyncConn syncs the folder with the peer serving conn. The peer sends its record first, this side merges it and sends
+// the result back, which the peer then merges without conflicts as it descends from its own notes.
+func (p *Peer) SyncConn(conn net.Conn) (*disk.MergeReport, error) {
+	ch, err := p.open(conn, true)
+	if err != nil {
+		return nil, err
+	}
+
+	theirs, err := ch.receive()
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := p.mergeRecord(theirs.Record)
+	if err != nil {
+		ch.send(message{Err: "the peer failed to merge"})
+		return nil, err
+	}
+
+	_, ours, err := p.repo.Record()
+	if err != nil {
+		ch.send(message{Err: "the peer failed to read its folder"})
+		return nil, err
+	}
+
+	err = ch.send(message{Record: ours})
+	if err != nil {
+		return nil, err
+	}
+
+	// the peer acknowledges once it has merged the result
+	_, err = ch.receive()
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ServeConn syncs the folder with the peer that connected on conn
+func (p *Peer) ServeConn(conn net.Conn) (*disk.MergeReport, error) {
+	ch, err := p.open(conn, false)
+	if err != nil {
+		return nil, err
+	}
+
+	_, ours, err := p.repo.Record()
+	if err != nil {
+		ch.send(message{Err: "the peer failed to read its folder"})
+		return nil, err
+	}
+
+	err = ch.send(message{Record: ours})
+	if err != nil {
+		return nil, err
+	}
+
+	theirs, err := ch.receive()
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := p.mergeRecord(theirs.Record)
+	if err != nil {
+		ch.send(message{Err: "the peer failed to merge"})
+		return nil, err
+	}
+
+	err = ch.send(message{})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// mergeRecord merges the record of the peer into the folder, an empty record leaves it as it is
+func (p *Peer) mergeRecord(record []byte) (*disk.MergeReport, error) {
+	if len(record) == 0 {
+		return &disk.MergeReport{Conflicts: make(map[string]string)}, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.repo.MergeRecord(record)
+}
+
+// open authenticates the peer on conn and gives the channel to it
+func (p *Peer) open(conn net.Conn, initiator bool) (*channel, error) {
+	err := conn.SetDeadline(time.Now().Add(p.timeout()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set deadline %w", err)
+	}
+
+	return handshake(conn, p.w, initiator)
+}
+
+func (p *Peer) timeout() time.Duration {
+	if p.Timeout == 0 {
+		return DefaultTimeout
+	}
+
+	return p.Timeout
+}
+
+// send sends a message to the peer
+func (ch *channel) send(m message) error {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode message %w", err)
+	}
+
+	return ch.write(buf.Bytes())
+}
+
+// receive reads the next message, a message giving up is turned into an error
+func (ch *channel) receive() (message, error) {
+	var m message
+	data, err := ch.read()
+	if err != nil {
+		return m, err
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&m)
+	if err != nil {
+		return m, fmt.Errorf("failed to decode message %w", err)
+	}
+	if len(m.Err) != 0 {
+		return m, errors.New(m.Err)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,181 @@
+package soul
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"soul/secret"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// PINCredentialsKeyName holds a copy of the stored credentials encrypted with a key derived from the PIN
+	PINCredentialsKeyName = "ENCRYPTED_DATA_PIN"
+	PINSaltKeyName        = "PIN_SALT"
+	PINAttemptsKeyName    = "PIN_FAILED_ATTEMPTS"
+	PINLockedUntilKeyName = "PIN_LOCKED_UNTIL"
+
+	// MinPINLength is the shortest PIN accepted, the KDF and the attempt limit make up for the small key space
+	MinPINLength = 4
+	pinSaltSize  = 16
+)
+
+// Crypter encrypts and decrypts the data
+type Crypter interface {
+	Encrypter
+	Decrypter
+}
+
+// PINCrypterFunc derives the crypter of the PIN protected credentials from the PIN and its salt, it must use a slow
+// KDF as PINs are short
+type PINCrypterFunc func(pin *secret.Buffer, salt []byte) (Crypter, error)
+
+// PINPolicy limits how fast and how often a PIN can be guessed
+type PINPolicy struct {
+	// MaxAttempts is the number of failed attempts after which the stored credentials are wiped
+	MaxAttempts int
+	// Delay is the wait after the first failed attempt, it doubles with every further failure
+	Delay time.Duration
+}
+
+// DefaultPINPolicy wipes the stored credentials after five failed attempts
+var DefaultPINPolicy = PINPolicy{MaxAttempts: 5, Delay: 2 * time.Second}
+
+// ErrWrongPIN is returned when a PIN does not unlock the stored credentials
+var ErrWrongPIN = errors.New("wrong PIN")
+
+// ErrPINWiped is returned when the attempt limit was reached and the stored credentials were wiped
+var ErrPINWiped = errors.New("too many failed attempts, the stored credentials were wiped, log in with the password")
+
+// PINThrottledError is returned while failed attempts keep the PIN locked
+type PINThrottledError struct {
+	Until time.Time
+}
+
+func (e *PINThrottledError) Error() string {
+	return fmt.Sprintf("too many failed attempts, try again in %s", time.Until(e.Until).Round(time.Second))
+}
+
+// HasPIN checks if the stored credentials can be unlocked with a PIN
+func HasPIN(store ConfigStore) bool {
+	return strings.TrimSpace(store.GetString(PINCredentialsKeyName)) != ""
+}
+
+// SetPIN lets the PIN unlock a copy of the credentials, replacing any previous PIN
+func SetPIN(store ConfigStore, pin *secret.Buffer, credentials *Credentials, crypterFunc PINCrypterFunc) error {
+	if pin.Len() < MinPINLength {
+		return fmt.Errorf("PIN must be at least %d characters", MinPINLength)
+	}
+
+	salt := make([]byte, pinSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return fmt.Errorf("failed to generate salt %w", err)
+	}
+
+	crypter, err := crypterFunc(pin, salt)
+	if err != nil {
+		return fmt.Errorf("failed to derive PIN key %w", err)
+	}
+	defer wipeCrypter(crypter)
+
+	err = setCredentials(store, PINCredentialsKeyName, crypter, credentials)
+	if err != nil {
+		return err
+	}
+
+	store.SetString(PINSaltKeyName, base64.StdEncoding.EncodeToString(salt))
+	resetPINAttempts(store)
+
+	return nil
+}
+
+// UnlockWithPIN gives the stored credentials if the PIN matches. Failed attempts are counted in the store, each one
+// locks the PIN for longer and the last allowed one wipes the stored credentials.
+func UnlockWithPIN(store ConfigStore, pin *secret.Buffer, crypterFunc PINCrypterFunc, policy PINPolicy) (*Credentials, error) {
+	if !HasPIN(store) {
+		return nil, fmt.Errorf("no PIN is set")
+	}
+
+	if lockedUntil := getTime(store, PINLockedUntilKeyName); time.Now().Before(lockedUntil) {
+		return nil, &PINThrottledError{Until: lockedUntil}
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(store.GetString(PINSaltKeyName))
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("corrupted PIN salt")
+	}
+
+	crypter, err := crypterFunc(pin, salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive PIN key %w", err)
+	}
+	defer wipeCrypter(crypter)
+
+	credentials, err := getCredentials(store, PINCredentialsKeyName, crypter)
+	if err != nil {
+		return nil, failPINAttempt(store, policy)
+	}
+
+	resetPINAttempts(store)
+
+	return credentials, nil
+}
+
+// PINAttemptsLeft gives the number of failed attempts allowed before the stored credentials are wiped
+func PINAttemptsLeft(store ConfigStore, policy PINPolicy) int {
+	return policy.MaxAttempts - getInt(store, PINAttemptsKeyName)
+}
+
+// DeletePIN removes the PIN, the stored credentials then need the password again
+func DeletePIN(store ConfigStore) {
+	store.Delete(PINCredentialsKeyName)
+	store.Delete(PINSaltKeyName)
+	resetPINAttempts(store)
+}
+
+func failPINAttempt(store ConfigStore, policy PINPolicy) error {
+	attempts := getInt(store, PINAttemptsKeyName) + 1
+	if attempts >= policy.MaxAttempts {
+		DeleteCredentials(store)
+		return ErrPINWiped
+	}
+
+	store.SetString(PINAttemptsKeyName, strconv.Itoa(attempts))
+	delay := policy.Delay << uint(attempts-1)
+	store.SetString(PINLockedUntilKeyName, strconv.FormatInt(time.Now().Add(delay).UnixNano(), 10))
+
+	return ErrWrongPIN
+}
+
+func resetPINAttempts(store ConfigStore) {
+	store.Delete(PINAttemptsKeyName)
+	store.Delete(PINLockedUntilKeyName)
+}
+
+func wipeCrypter(crypter Crypter) {
+	if w, ok := crypter.(interface{ Wipe() }); ok {
+		w.Wipe()
+	}
+}
+
+func getInt(store ConfigStore, key string) int {
+	value, err := strconv.Atoi(store.GetString(key))
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+func getTime(store ConfigStore, key string) time.Time {
+	value, err := strconv.ParseInt(store.GetString(key), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, value)
+}
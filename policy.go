@@ -0,0 +1,184 @@
+package soul
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PolicyEnvVar names a policy file to use instead of the system one
+const PolicyEnvVar = "SOUL_POLICY_FILE"
+
+// Policy is set by an organisation on managed machines, it overrides and locks the matching settings. The zero policy
+// enforces nothing.
+type Policy struct {
+	// MinPasswordLength and MinPasswordClasses apply to new passwords, classes are lower and upper case letters,
+	// digits and everything else
+	MinPasswordLength  int `json:"min_password_length"`
+	MinPasswordClasses int `json:"min_password_classes"`
+	// DisallowKeepOpen stops credentials from being stored, the folder password is needed every time
+	DisallowKeepOpen bool `json:"disallow_keep_open"`
+	// MaxAutoLockMinutes caps the auto lock timeout and stops auto lock from being turned off
+	MaxAutoLockMinutes int `json:"max_auto_lock_minutes"`
+	// RequireDecoyTraffic makes every opened folder run the load simulator, so that writes to the db do not give
+	// away when the real folder is used
+	RequireDecoyTraffic bool `json:"require_decoy_traffic"`
+}
+
+// PolicyError is returned for actions the policy blocks
+type PolicyError struct {
+	Reason string
+}
+
+func (pe *PolicyError) Error() string {
+	return "blocked by your organisation's policy: " + pe.Reason
+}
+
+// SystemPolicyPath gives where administrators put the policy file
+func SystemPolicyPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(os.Getenv("ProgramData"), "soul", "policy.json")
+	case "darwin":
+		return "/Library/Application Support/soul/policy.json"
+	default:
+		return "/etc/soul/policy.json"
+	}
+}
+
+// PolicyPath gives the policy file in use, the one named by PolicyEnvVar or else the system one
+func PolicyPath() string {
+	if path := strings.TrimSpace(os.Getenv(PolicyEnvVar)); path != "" {
+		return path
+	}
+
+	return SystemPolicyPath()
+}
+
+// ActivePolicy reads the policy file at PolicyPath, a missing file gives the zero policy. A policy file that cannot be
+// read is an error rather than no policy, so that breaking the file does not lift the policy.
+func ActivePolicy() (*Policy, error) {
+	return ReadPolicy(PolicyPath())
+}
+
+// ReadPolicy reads the policy file at path, a missing file gives the zero policy
+func ReadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return new(Policy), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy %s %w", path, err)
+	}
+
+	policy := new(Policy)
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode policy %s %w", path, err)
+	}
+
+	if policy.MinPasswordLength < 0 || policy.MinPasswordClasses < 0 || policy.MinPasswordClasses > 4 ||
+		policy.MaxAutoLockMinutes < 0 {
+		return nil, fmt.Errorf("invalid policy %s", path)
+	}
+
+	return policy, nil
+}
+
+// MaxAutoLock gives the longest auto lock timeout allowed, 0 when the policy sets none
+func (p *Policy) MaxAutoLock() time.Duration {
+	return time.Duration(p.MaxAutoLockMinutes) * time.Minute
+}
+
+// CheckPassword checks a new password is as strong as the policy requires
+func (p *Policy) CheckPassword(password []byte) error {
+	text := string(password)
+	if length := len([]rune(text)); length < p.MinPasswordLength {
+		return &PolicyError{Reason: fmt.Sprintf("passwords must be at least %d characters long", p.MinPasswordLength)}
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range text {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+
+	if classes < p.MinPasswordClasses {
+		return &PolicyError{Reason: fmt.Sprintf("passwords must mix at least %d of lower case, upper case, digits and symbols", p.MinPasswordClasses)}
+	}
+
+	return nil
+}
+
+// CheckKeepOpen fails when credentials may not be stored
+func (p *Policy) CheckKeepOpen() error {
+	if p.DisallowKeepOpen {
+		return &PolicyError{Reason: "folders cannot be kept open, the password is needed every time"}
+	}
+
+	return nil
+}
+
+// CheckSettings fails when the settings break the policy
+func (p *Policy) CheckSettings(settings Settings) error {
+	max := p.MaxAutoLock()
+	if max > 0 && (settings.AutoLock == 0 || settings.AutoLock > max) {
+		return &PolicyError{Reason: fmt.Sprintf("folders must lock after at most %v of inactivity", max)}
+	}
+
+	return nil
+}
+
+// EnforceSettings gives the settings with every value the policy locks overridden
+func (p *Policy) EnforceSettings(settings Settings) Settings {
+	max := p.MaxAutoLock()
+	if max > 0 && (settings.AutoLock == 0 || settings.AutoLock > max) {
+		settings.AutoLock = max
+	}
+
+	return settings
+}
+
+// Enforce brings the stored values of every profile in line with the policy, deleting credentials that may no longer
+// be kept and capping settings
+func (p *Policy) Enforce(store ConfigStore) error {
+	for _, name := range ListProfiles(store) {
+		profile := ProfileStore(store, name)
+		if p.DisallowKeepOpen {
+			DeleteCredentials(profile)
+		}
+
+		settings, _ := loadSettings(profile)
+		if p.CheckSettings(settings) != nil {
+			err := saveSettings(profile, p.EnforceSettings(settings), p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package soul
+
+// ChangeDetector is implemented by repositories that can tell when their notes were changed by someone else, another
+// instance, a merge, a sync or a file sync tool replacing the db file
+type ChangeDetector interface {
+	// Changed tells whether the notes changed since they were last read
+	Changed() (bool, error)
+}
+
+// ReloadReport tells what reloading the notes changed, by note id
+type ReloadReport struct {
+	// Added holds the notes created elsewhere
+	Added []string
+	// Reloaded holds the notes without unsaved edits, they took the text written elsewhere
+	Reloaded []string
+	// Merged holds the notes whose unsaved edits merged cleanly with the ones made elsewhere
+	Merged []string
+	// Conflicts holds the notes whose unsaved edits conflict with the ones made elsewhere, both are kept between
+	// conflict markers to resolve
+	Conflicts []string
+}
+
+// Changed tells whether reloading changed any note
+func (rr *ReloadReport) Changed() bool {
+	return len(rr.Added)+len(rr.Reloaded)+len(rr.Merged)+len(rr.Conflicts) != 0
+}
+
+// ReloadIfChanged reloads the notes when the repository tells they were changed by someone else, it gives no report
+// when they were not or the repository cannot tell
+func (ns *NoteService) ReloadIfChanged() (*ReloadReport, error) {
+	detector, ok := ns.Repo.(ChangeDetector)
+	if !ok {
+		return nil, nil
+	}
+
+	changed, err := detector.Changed()
+	if err != nil || !changed {
+		return nil, err
+	}
+
+	return ns.Reload()
+}
+
+// Reload reads the notes again and brings Notes up to date in place, so that bound texts show the changes. A note
+// whose text is still the one last saved takes the new text, one with unsaved edits has them merged with the new
+// text from the text both started from. Notes backed by a CRDT merge their documents instead. It is safe to call
+// alongside the other methods of the service.
+func (ns *NoteService) Reload() (*ReloadReport, error) {
+	notes, err := ns.Repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	positions := make(map[string]int, len(ns.Notes))
+	for i, note := range ns.Notes {
+		positions[note.ID] = i
+	}
+
+	report := new(ReloadReport)
+	for _, fresh := range notes {
+		i, ok := positions[fresh.ID]
+		if !ok {
+			fresh.trackEdits()
+			ns.appendNote(fresh)
+			report.Added = append(report.Added, fresh.ID)
+			continue
+		}
+
+		err = ns.reloadNote(&ns.Notes[i], fresh, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// reloadNote brings note up to date with fresh, its copy just read
+func (ns *NoteService) reloadNote(note *Note, fresh Note, report *ReloadReport) error {
+	theirs, err := fresh.Text.Get()
+	if err != nil {
+		return err
+	}
+	ours, err := note.Text.Get()
+	if err != nil {
+		return err
+	}
+
+	base, ok := ns.savedText(note.ID)
+	if !ok {
+		base = ours
+	}
+	if theirs == base || theirs == ours {
+		ns.setSaved(note.ID, theirs)
+		return nil
+	}
+
+	edited, conflict := ours != base, false
+	var text string
+	switch {
+	case note.Doc != nil && fresh.Doc != nil:
+		// edits reach the document from a listener, which may not have run yet
+		note.Doc.SetText(ours)
+		note.Doc.Merge(fresh.Doc)
+		text = note.Doc.Text()
+	case !edited:
+		text = theirs
+		if note.Doc == nil && fresh.Doc != nil {
+			// the note was made conflict-free elsewhere
+			note.Doc = fresh.Doc
+			note.trackEdits()
+		}
+	default:
+		result := Merge3(base, ours, theirs)
+		text, conflict = result.Text(), !result.Clean()
+	}
+
+	switch {
+	case !edited:
+		report.Reloaded = append(report.Reloaded, note.ID)
+	case conflict:
+		report.Conflicts = append(report.Conflicts, note.ID)
+	default:
+		report.Merged = append(report.Merged, note.ID)
+	}
+
+	// what is stored now is the base of edits still to come
+	ns.setSaved(note.ID, theirs)
+	if text == ours {
+		return nil
+	}
+
+	return note.Text.Set(text)
+}
@@ -0,0 +1,202 @@
+package soul_test
+
+import (
+	"soul"
+	"soul/crdt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// changingRepository keeps notes in memory, notes written by someone else are set with write
+type changingRepository struct {
+	mu      sync.Mutex
+	texts   map[string]string
+	docs    map[string]*crdt.Doc
+	order   []string
+	changed bool
+}
+
+func newChangingRepository() *changingRepository {
+	return &changingRepository{texts: make(map[string]string), docs: make(map[string]*crdt.Doc)}
+}
+
+func (cr *changingRepository) GetAll() ([]soul.Note, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.changed = false
+
+	var notes []soul.Note
+	for _, id := range cr.order {
+		var doc *crdt.Doc
+		if cr.docs[id] != nil {
+			doc = cr.docs[id].Clone()
+		}
+		notes = append(notes, soul.Note{ID: id, Text: soul.NewBindingFromString(cr.texts[id]), Doc: doc})
+	}
+
+	return notes, nil
+}
+
+func (cr *changingRepository) Create(note *soul.Note) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	note.ID = string(rune('a' + len(cr.order)))
+	return cr.update(note)
+}
+
+func (cr *changingRepository) Update(note *soul.Note) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return cr.update(note)
+}
+
+func (cr *changingRepository) update(note *soul.Note) error {
+	text, err := note.Text.Get()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := cr.texts[note.ID]; !ok {
+		cr.order = append(cr.order, note.ID)
+	}
+	cr.texts[note.ID] = text
+	if note.Doc != nil {
+		// stored documents come back as replicas of their own, as they do from disk
+		state, err := note.Doc.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		cr.docs[note.ID], err = crdt.Unmarshal(state)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cr *changingRepository) Changed() (bool, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return cr.changed, nil
+}
+
+// write changes a note as another writer would
+func (cr *changingRepository) write(id, text string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if _, ok := cr.texts[id]; !ok {
+		cr.order = append(cr.order, id)
+	}
+	cr.texts[id] = text
+	if doc := cr.docs[id]; doc != nil {
+		doc.SetText(text)
+	}
+	cr.changed = true
+}
+
+func TestReload(t *testing.T) {
+	repo := newChangingRepository()
+	ns := soul.NewNoteService(repo)
+	for _, text := range []string{"untouched", "first line\nsecond line\n", "ours and theirs", "the quick fox"} {
+		note, err := ns.Create()
+		assert.Nil(t, err)
+		assert.Nil(t, note.Text.Set(text))
+		assert.Nil(t, ns.Update(note))
+	}
+	assert.Nil(t, ns.SetConflictFree(&ns.Notes[3], true))
+
+	// nothing changed elsewhere
+	report, err := ns.ReloadIfChanged()
+	assert.Nil(t, err)
+	assert.Nil(t, report)
+
+	// unsaved edits to three notes while another writer changes all of them and adds one
+	assert.Nil(t, ns.Notes[1].Text.Set("first line edited\nsecond line\n"))
+	assert.Nil(t, ns.Notes[2].Text.Set("ours"))
+	assert.Nil(t, ns.Notes[3].Text.Set("the quick brown fox"))
+	repo.write("a", "changed elsewhere")
+	repo.write("b", "first line\nsecond line edited elsewhere\n")
+	repo.write("c", "theirs")
+	repo.write("d", "the very quick fox")
+	repo.write("z", "created elsewhere")
+
+	report, err = ns.ReloadIfChanged()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"z"}, report.Added)
+	assert.Equal(t, []string{"a"}, report.Reloaded)
+	assert.Equal(t, []string{"b", "d"}, report.Merged)
+	assert.Equal(t, []string{"c"}, report.Conflicts)
+
+	texts := make([]string, len(ns.Notes))
+	for i, note := range ns.Notes {
+		texts[i], _ = note.Text.Get()
+	}
+	assert.Equal(t, "changed elsewhere", texts[0])
+	assert.Equal(t, "first line edited\nsecond line edited elsewhere\n", texts[1])
+	assert.True(t, soul.HasConflicts(texts[2]))
+	assert.Equal(t, "the very quick brown fox", texts[3])
+	assert.Equal(t, "created elsewhere", texts[4])
+
+	// saving the merged edits does not make them look changed elsewhere
+	for i := range ns.Notes {
+		assert.Nil(t, ns.Update(&ns.Notes[i]))
+	}
+	repo.changed = true
+	report, err = ns.Reload()
+	assert.Nil(t, err)
+	assert.False(t, report.Changed())
+}
+
+func TestReloadWhileCreating(t *testing.T) {
+	t.Parallel()
+
+	repo := newChangingRepository()
+	ns := soul.NewNoteService(repo)
+	assert.Nil(t, ns.LoadAll())
+
+	// notes are reloaded in the background while new ones are added and the list is read
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			_, err := ns.Create()
+			assert.Nil(t, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			repo.write(string(rune('A'+i)), "written elsewhere")
+			_, err := ns.ReloadIfChanged()
+			assert.Nil(t, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			for j := 0; j < ns.Len(); j++ {
+				ns.NoteAt(j)
+			}
+			ns.Snapshot()
+		}
+	}()
+	wg.Wait()
+
+	_, err := ns.Reload()
+	assert.Nil(t, err)
+	assert.Len(t, ns.Snapshot(), 40)
+	ids := make(map[string]bool)
+	for _, note := range ns.Snapshot() {
+		assert.False(t, ids[note.ID])
+		ids[note.ID] = true
+	}
+}
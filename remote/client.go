@@ -0,0 +1,119 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a single request to the server
+const DefaultTimeout = 30 * time.Second
+
+// Client reads and writes records on a server
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient creates a client for the server at baseURL, token is sent as a bearer token when set
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// Get reads a record, one that was never written comes back empty at revision 0
+func (c *Client) Get(key string) (Record, error) {
+	resp, err := c.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return Record{}, err
+	}
+	defer resp.Body.Close()
+
+	// an unknown path is a 404 too, only a record that was never written carries a revision
+	if resp.StatusCode == http.StatusNotFound && len(resp.Header.Get(RevisionHeader)) != 0 {
+		return Record{}, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Record{}, statusError(resp)
+	}
+
+	revision, err := revisionOf(resp)
+	if err != nil {
+		return Record{}, err
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to read record %w", err)
+	}
+
+	return Record{Revision: revision, Data: data}, nil
+}
+
+// Put writes a record based on revision, failing with ErrConflict and the current revision when the record moved on
+func (c *Client) Put(key string, data []byte, revision uint64) (Record, error) {
+	resp, err := c.do(http.MethodPut, key, data, map[string]string{"If-Match": strconv.FormatUint(revision, 10)})
+	if err != nil {
+		return Record{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		current, err := revisionOf(resp)
+		return Record{Revision: current, Data: data}, err
+	case http.StatusPreconditionFailed:
+		current, err := revisionOf(resp)
+		if err != nil {
+			return Record{}, err
+		}
+		return Record{Revision: current}, ErrConflict
+	default:
+		return Record{}, statusError(resp)
+	}
+}
+
+func (c *Client) do(method, key string, body []byte, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+recordsPath+key, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request %w", err)
+	}
+
+	if len(c.token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the sync server %w", err)
+	}
+
+	return resp, nil
+}
+
+func revisionOf(resp *http.Response) (uint64, error) {
+	revision, err := strconv.ParseUint(resp.Header.Get(RevisionHeader), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("sync server sent an invalid revision %w", err)
+	}
+
+	return revision, nil
+}
+
+func statusError(resp *http.Response) error {
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("sync server answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
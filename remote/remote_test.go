@@ -0,0 +1,302 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"soul"
+	"soul/crypt"
+	"soul/disk"
+	"soul/remote"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	folder   = "folder"
+	password = "remote key"
+	token    = "server token"
+	key      = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+// openRepository opens the folder in a new db file, as another machine would
+func openRepository(t *testing.T, store remote.Store) *remote.Repository {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "soul-remote")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	db, err := bolt.Open(filepath.Join(dir, "soul.db"), 0600, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	repo, err := disk.NewNoteRepositoryWithDb(db, folder, password, crypt.NewSoulEncrypter, crypt.NewSoulDecrypter)
+	assert.Nil(t, err)
+
+	return remote.NewRepository(repo, store)
+}
+
+func texts(t *testing.T, repo soul.NoteRepository) []string {
+	t.Helper()
+
+	notes, err := repo.GetAll()
+	assert.Nil(t, err)
+
+	var texts []string
+	for _, note := range notes {
+		text, _ := note.Text.Get()
+		texts = append(texts, text)
+	}
+	sort.Strings(texts)
+
+	return texts
+}
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soul-remote")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := bolt.Open(filepath.Join(dir, "records.db"), 0600, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	boltStore, err := remote.NewBoltStore(db)
+	assert.Nil(t, err)
+
+	server := httptest.NewServer(remote.NewServer(remote.NewMemoryStore(), token))
+	defer server.Close()
+
+	for name, store := range map[string]remote.Store{
+		"memory": remote.NewMemoryStore(),
+		"bolt":   boltStore,
+		"client": remote.NewClient(server.URL, token),
+	} {
+		record, err := store.Get(key)
+		assert.Nil(t, err, name)
+		assert.Equal(t, remote.Record{}, record, name)
+
+		record, err = store.Put(key, []byte("first"), 0)
+		assert.Nil(t, err, name)
+		assert.Equal(t, uint64(1), record.Revision, name)
+
+		// a write based on a revision that moved on is refused
+		record, err = store.Put(key, []byte("stale"), 0)
+		assert.True(t, errors.Is(err, remote.ErrConflict), name)
+		assert.Equal(t, uint64(1), record.Revision, name)
+
+		_, err = store.Put(key, []byte("second"), 1)
+		assert.Nil(t, err, name)
+		record, err = store.Get(key)
+		assert.Nil(t, err, name)
+		assert.Equal(t, remote.Record{Revision: 2, Data: []byte("second")}, record, name)
+	}
+
+	_, err = remote.NewClient(server.URL, "wrong token").Get(key)
+	assert.NotNil(t, err)
+	_, err = remote.NewClient(server.URL, token).Get("../secrets")
+	assert.NotNil(t, err)
+}
+
+func TestSyncThroughServer(t *testing.T) {
+	store := remote.NewMemoryStore()
+	server := httptest.NewServer(remote.NewServer(store, token))
+	defer server.Close()
+
+	laptop := openRepository(t, remote.NewClient(server.URL, token))
+	desktop := openRepository(t, remote.NewClient(server.URL, token))
+
+	note := soul.Note{Text: soul.NewBindingFromString("shared secret note")}
+	assert.Nil(t, laptop.Create(&note))
+	assert.Nil(t, laptop.Err())
+	assert.Equal(t, []string{"shared secret note"}, texts(t, desktop))
+
+	// both edit without seeing each other, the second push merges the first in
+	assert.Nil(t, desktop.Create(&soul.Note{Text: soul.NewBindingFromString("desktop note")}))
+	assert.Nil(t, note.Text.Set("edited on the laptop"))
+	assert.Nil(t, laptop.Update(&note))
+
+	assert.Nil(t, desktop.Sync())
+	assert.Equal(t, []string{"desktop note", "edited on the laptop"}, texts(t, desktop))
+	assert.Equal(t, []string{"desktop note", "edited on the laptop"}, texts(t, laptop))
+
+	// the server only ever held the folder hash and ciphertext
+	key, _, err := laptop.Record()
+	assert.Nil(t, err)
+	record, err := store.Get(key)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, record.Data)
+	for _, plain := range []string{"laptop", "desktop", folder, password} {
+		assert.False(t, bytes.Contains(record.Data, []byte(plain)))
+	}
+
+	// edits keep working locally while the server is away and are pushed once it is back
+	server.Close()
+	assert.Nil(t, desktop.Create(&soul.Note{Text: soul.NewBindingFromString("offline note")}))
+	assert.NotNil(t, desktop.Err())
+	assert.Len(t, texts(t, desktop), 3)
+}
+
+// webDAVServer serves a WebDAV folder in memory, requests fail while offline is set
+func webDAVServer(t *testing.T, offline *int32) (*httptest.Server, webdav.FileSystem) {
+	t.Helper()
+
+	fs := webdav.NewMemFS()
+	handler := &webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "soul" || pass != token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if offline != nil && atomic.LoadInt32(offline) != 0 {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, fs
+}
+
+func TestWebDAVStore(t *testing.T) {
+	server, fs := webDAVServer(t, nil)
+	assert.Nil(t, fs.Mkdir(context.Background(), "/notes", 0700))
+	store := remote.NewWebDAVStore(server.URL+"/notes/", "soul", token)
+	other := remote.NewWebDAVStore(server.URL+"/notes", "soul", token)
+
+	record, err := store.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, remote.Record{}, record)
+
+	first, err := store.Put(key, []byte("first"), 0)
+	assert.Nil(t, err)
+	assert.NotZero(t, first.Revision)
+
+	// another client reads the same revision from the ETag
+	record, err = other.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, first, record)
+
+	second, err := other.Put(key, []byte("second"), first.Revision)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.Revision, second.Revision)
+
+	// a write based on a revision that moved on is refused
+	record, err = store.Put(key, []byte("stale"), first.Revision)
+	assert.True(t, errors.Is(err, remote.ErrConflict))
+	assert.Equal(t, second.Revision, record.Revision)
+	_, err = store.Put(key, []byte("stale"), 0)
+	assert.True(t, errors.Is(err, remote.ErrConflict))
+
+	record, err = store.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, second, record)
+
+	// a client in the middle of a write holds the lock, a write racing it is refused
+	req, err := http.NewRequest("LOCK", server.URL+"/notes/"+key+".soul", strings.NewReader(
+		`<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`))
+	assert.Nil(t, err)
+	req.SetBasicAuth("soul", token)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = store.Put(key, []byte("racing"), second.Revision)
+	assert.True(t, errors.Is(err, remote.ErrConflict))
+
+	_, err = remote.NewWebDAVStore(server.URL+"/notes", "soul", "wrong password").Get(key)
+	assert.NotNil(t, err)
+	_, err = store.Get("../secrets")
+	assert.NotNil(t, err)
+}
+
+func TestSyncThroughWebDAV(t *testing.T) {
+	var offline int32
+	server, fs := webDAVServer(t, &offline)
+
+	laptop := openRepository(t, remote.NewWebDAVStore(server.URL, "soul", token))
+	desktop := openRepository(t, remote.NewWebDAVStore(server.URL, "soul", token))
+
+	note := soul.Note{Text: soul.NewBindingFromString("shared secret note")}
+	assert.Nil(t, laptop.Create(&note))
+	assert.Nil(t, laptop.Err())
+	assert.Equal(t, []string{"shared secret note"}, texts(t, desktop))
+
+	// both edit without seeing each other, the second push merges the first in
+	assert.Nil(t, desktop.Create(&soul.Note{Text: soul.NewBindingFromString("desktop note")}))
+	assert.Nil(t, note.Text.Set("edited on the laptop"))
+	assert.Nil(t, laptop.Update(&note))
+	assert.Equal(t, []string{"desktop note", "edited on the laptop"}, texts(t, desktop))
+	assert.Equal(t, []string{"desktop note", "edited on the laptop"}, texts(t, laptop))
+
+	// the server only holds a file named after the folder hash, with ciphertext in it
+	recordKey, _, err := laptop.Record()
+	assert.Nil(t, err)
+	file, err := fs.OpenFile(context.Background(), "/"+recordKey+".soul", os.O_RDONLY, 0)
+	assert.Nil(t, err)
+	data, err := ioutil.ReadAll(file)
+	assert.Nil(t, err)
+	file.Close()
+	assert.NotEmpty(t, data)
+	for _, plain := range []string{"laptop", "desktop", folder, password} {
+		assert.False(t, bytes.Contains(data, []byte(plain)))
+	}
+
+	// writes made while the server is away are queued and pushed once it is back
+	atomic.StoreInt32(&offline, 1)
+	assert.Nil(t, desktop.Create(&soul.Note{Text: soul.NewBindingFromString("offline note")}))
+	assert.NotNil(t, desktop.Err())
+	assert.True(t, desktop.Pending())
+	assert.Len(t, texts(t, desktop), 3)
+
+	atomic.StoreInt32(&offline, 0)
+	assert.Len(t, texts(t, desktop), 3)
+	assert.Nil(t, desktop.Err())
+	assert.False(t, desktop.Pending())
+	assert.Equal(t, []string{"desktop note", "edited on the laptop", "offline note"}, texts(t, laptop))
+}
+
+func TestUpdateOffline(t *testing.T) {
+	var offline int32
+	server, _ := webDAVServer(t, &offline)
+
+	laptop := openRepository(t, remote.NewWebDAVStore(server.URL, "soul", token))
+	desktop := openRepository(t, remote.NewWebDAVStore(server.URL, "soul", token))
+
+	note := soul.Note{Text: soul.NewBindingFromString("note")}
+	assert.Nil(t, laptop.Create(&note))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go laptop.KeepFlushing(ctx, 10*time.Millisecond)
+
+	// an edit made offline is saved without an error, the failed push only shows in Err and Pending
+	atomic.StoreInt32(&offline, 1)
+	assert.Nil(t, note.Text.Set("edited offline"))
+	assert.Nil(t, laptop.Update(&note))
+	assert.NotNil(t, laptop.Err())
+	assert.True(t, laptop.Pending())
+
+	// it is pushed in the background once the server is back, without another write
+	atomic.StoreInt32(&offline, 0)
+	assert.Eventually(t, func() bool {
+		return !laptop.Pending()
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, laptop.Err())
+	assert.Equal(t, []string{"edited offline"}, texts(t, desktop))
+}
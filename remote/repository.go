@@ -0,0 +1,219 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"soul"
+	"soul/disk"
+	"sync"
+	"time"
+)
+
+// maxPushAttempts bounds how often a push pulls in a newer record and tries again before giving up
+const maxPushAttempts = 5
+
+// Repository is a folder that is kept in step with a copy on a sync server. Writes go to the local folder first and
+// are then pushed, a push racing another client's pulls its record in, merges it and tries again. Writes made while
+// the store cannot be reached are queued and pushed the next time it can, see KeepFlushing. Only the encrypted folder
+// value ever leaves the machine.
+type Repository struct {
+	*disk.NoteRepository
+	store Store
+
+	mu sync.Mutex
+	// revision is the revision of the record the local folder last matched
+	revision uint64
+	// err is the error of the last sync, a folder that cannot be synced keeps working locally
+	err error
+	// pending tells that the local folder holds writes that were not pushed yet
+	pending bool
+}
+
+// NewRepository keeps repo in step with its record in store, a Client for a remote server or any other Store
+func NewRepository(repo *disk.NoteRepository, store Store) *Repository {
+	// writes queued before the folder was last closed are not known, so the folder is pushed once to be sure
+	return &Repository{NoteRepository: repo, store: store, pending: true}
+}
+
+// GetAll pulls in the record and pushes queued writes before reading the notes, the local notes are given when the
+// server cannot be reached
+func (r *Repository) GetAll() ([]soul.Note, error) {
+	r.mu.Lock()
+	err := r.pull()
+	if err == nil && r.pending {
+		err = r.push()
+	}
+	r.err = err
+	r.mu.Unlock()
+
+	return r.NoteRepository.GetAll()
+}
+
+// Create creates the note locally and pushes it, a failed push is queued and only kept in Err as the note exists all
+// the same
+func (r *Repository) Create(note *soul.Note) error {
+	err := r.NoteRepository.Create(note)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = r.push()
+
+	return nil
+}
+
+// Update updates the note locally and pushes it, a failed push is queued and only kept in Err as the note is saved all
+// the same
+func (r *Repository) Update(note *soul.Note) error {
+	err := r.NoteRepository.Update(note)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = r.push()
+
+	return nil
+}
+
+// Flush pushes the writes queued while the store could not be reached, doing nothing when none are
+func (r *Repository) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.pending {
+		return nil
+	}
+
+	err := r.pull()
+	if err == nil {
+		err = r.push()
+	}
+	r.err = err
+
+	return err
+}
+
+// KeepFlushing tries to push queued writes every interval until ctx is done, so that they reach the store soon after
+// it can be reached again rather than on the next write
+func (r *Repository) KeepFlushing(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sync pulls in the record and pushes the local notes
+func (r *Repository) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.pull()
+	if err == nil {
+		err = r.push()
+	}
+	r.err = err
+
+	return err
+}
+
+// Err gives the error of the last sync, nil once a sync succeeds
+func (r *Repository) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// Pending tells whether there are writes queued for when the store can be reached again
+func (r *Repository) Pending() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.pending
+}
+
+// pull merges the record into the local folder when it moved on since the last sync, the caller holds r.mu
+func (r *Repository) pull() error {
+	key, _, err := r.Record()
+	if err != nil {
+		return err
+	}
+
+	record, err := r.store.Get(key)
+	if err != nil {
+		return fmt.Errorf("failed to pull %w", err)
+	}
+
+	return r.mergeRecord(record)
+}
+
+func (r *Repository) mergeRecord(record Record) error {
+	if record.Revision == r.revision {
+		return nil
+	}
+
+	if len(record.Data) != 0 {
+		_, err := r.MergeRecord(record.Data)
+		if err != nil {
+			return err
+		}
+	}
+	r.revision = record.Revision
+
+	return nil
+}
+
+// push writes the local folder to the record, keeping it queued when that fails. The caller holds r.mu.
+func (r *Repository) push() error {
+	err := r.pushRecord()
+	r.pending = err != nil
+
+	return err
+}
+
+// pushRecord writes the local folder to the record, merging in records pushed by others meanwhile
+func (r *Repository) pushRecord() error {
+	for attempt := 0; attempt < maxPushAttempts; attempt++ {
+		key, value, err := r.Record()
+		if err != nil || len(value) == 0 {
+			return err
+		}
+
+		record, err := r.store.Put(key, value, r.revision)
+		if errors.Is(err, ErrConflict) {
+			// a conflict from a Client only carries the revision, the record itself has to be read
+			if len(record.Data) == 0 {
+				record, err = r.store.Get(key)
+				if err != nil {
+					return fmt.Errorf("failed to pull %w", err)
+				}
+			}
+
+			err = r.mergeRecord(record)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to push %w", err)
+		}
+
+		r.revision = record.Revision
+		return nil
+	}
+
+	return fmt.Errorf("failed to push, the record kept changing")
+}
@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// recordsPath is the path records are served under, followed by their key
+const recordsPath = "/v1/records/"
+
+// RevisionHeader carries the revision of a record in responses
+const RevisionHeader = "Soul-Revision"
+
+// MaxRecordSize bounds the size of a record the server accepts
+const MaxRecordSize = 64 << 20
+
+// recordKey matches the folder hashes records are kept under, those are hex encoded sha256 sums
+var recordKey = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Server serves the records of a store over HTTP. It only ever sees folder hashes and encrypted values, the keys
+// stay with the clients.
+type Server struct {
+	store Store
+	token string
+}
+
+// NewServer creates a server for the store, when token is set requests must carry it as a bearer token
+func NewServer(store Store, token string) *Server {
+	return &Server{store: store, token: token}
+}
+
+// ServeHTTP serves GET to read a record and PUT to write one. A PUT carries the revision it is based on in If-Match,
+// 0 for a record that was never written, and fails with 412 and the current revision when the record moved on.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, recordsPath)
+	if !strings.HasPrefix(r.URL.Path, recordsPath) || !recordKey.MatchString(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.get(w, key)
+	case http.MethodPut:
+		s.put(w, r, key)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if len(s.token) == 0 {
+		return true
+	}
+
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) == 1
+}
+
+func (s *Server) get(w http.ResponseWriter, key string) {
+	record, err := s.store.Get(key)
+	if err != nil {
+		http.Error(w, "failed to read record", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(RevisionHeader, strconv.FormatUint(record.Revision, 10))
+	if record.Revision == 0 {
+		http.Error(w, "no such record", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(record.Data)
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, key string) {
+	revision, err := strconv.ParseUint(r.Header.Get("If-Match"), 10, 64)
+	if err != nil {
+		http.Error(w, "If-Match must hold the revision the write is based on", http.StatusPreconditionRequired)
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxRecordSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read record, at most %d bytes are accepted", MaxRecordSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	record, err := s.store.Put(key, data, revision)
+	w.Header().Set(RevisionHeader, strconv.FormatUint(record.Revision, 10))
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to store record", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
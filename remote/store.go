@@ -0,0 +1,135 @@
+package remote
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/boltdb/bolt"
+)
+
+// ErrConflict is returned when a record changed since the revision a write was based on
+var ErrConflict = errors.New("the record changed since it was read")
+
+// Record is an opaque, encrypted folder value and the revision it is at, a record that was never written is at 0
+type Record struct {
+	Revision uint64
+	Data     []byte
+}
+
+// Store keeps records by key, a write only goes through when the record is still at the revision it expects
+type Store interface {
+	Get(key string) (Record, error)
+	// Put writes data if the record is at revision, returning the record after the write. A record at another
+	// revision is returned along with ErrConflict.
+	Put(key string, data []byte, revision uint64) (Record, error)
+}
+
+// MemoryStore keeps records in memory, for tests and throwaway servers
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore creates an empty store in memory
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (ms *MemoryStore) Get(key string) (Record, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.records[key], nil
+}
+
+func (ms *MemoryStore) Put(key string, data []byte, revision uint64) (Record, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	current := ms.records[key]
+	if current.Revision != revision {
+		return current, ErrConflict
+	}
+
+	current = Record{Revision: revision + 1, Data: append([]byte(nil), data...)}
+	ms.records[key] = current
+
+	return current, nil
+}
+
+// recordsBucketName is the bucket a BoltStore keeps its records in
+const recordsBucketName = "records"
+
+// BoltStore keeps records in a bolt db, each value is the revision followed by the data
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore creates a store in db, records written before are kept
+func NewBoltStore(db *bolt.DB) (*BoltStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(recordsBucketName))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bucket: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (bs *BoltStore) Get(key string) (Record, error) {
+	var record Record
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, err = decodeRecord(tx.Bucket([]byte(recordsBucketName)).Get([]byte(key)))
+		return err
+	})
+
+	return record, err
+}
+
+func (bs *BoltStore) Put(key string, data []byte, revision uint64) (Record, error) {
+	var record Record
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(recordsBucketName))
+		current, err := decodeRecord(b.Get([]byte(key)))
+		if err != nil {
+			return err
+		}
+
+		if current.Revision != revision {
+			record = current
+			return ErrConflict
+		}
+
+		record = Record{Revision: revision + 1, Data: append([]byte(nil), data...)}
+		encoded := make([]byte, 8, 8+len(data))
+		binary.BigEndian.PutUint64(encoded, record.Revision)
+		err = b.Put([]byte(key), append(encoded, data...))
+		if err != nil {
+			return fmt.Errorf("failed to store record %w", err)
+		}
+
+		return nil
+	})
+
+	return record, err
+}
+
+func decodeRecord(value []byte) (Record, error) {
+	if len(value) == 0 {
+		return Record{}, nil
+	}
+
+	if len(value) < 8 {
+		return Record{}, fmt.Errorf("corrupted record, value is too short")
+	}
+
+	return Record{
+		Revision: binary.BigEndian.Uint64(value[:8]),
+		Data:     append([]byte(nil), value[8:]...),
+	}, nil
+}
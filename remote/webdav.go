@@ -0,0 +1,234 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// webDAVExtension is added to record keys to name the file a record is kept in
+const webDAVExtension = ".soul"
+
+// lockInfo asks for an exclusive write lock, held only for the length of a write
+const lockInfo = `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>soul</D:owner></D:lockinfo>`
+
+// WebDAVStore keeps each record as a file in a folder of a WebDAV server. Revisions are derived from the ETags the
+// server gives the files. A write locks the file, checks that its ETag is still the one the write is based on and
+// only then replaces it, so that two clients writing at once never overwrite each other. An empty or missing file is
+// a record that was never written.
+type WebDAVStore struct {
+	baseURL  string
+	user     string
+	password string
+	http     *http.Client
+}
+
+// NewWebDAVStore creates a store in the folder at baseURL, which has to exist. User and password are sent with basic
+// auth when set.
+func NewWebDAVStore(baseURL, user, password string) *WebDAVStore {
+	return &WebDAVStore{
+		baseURL:  strings.TrimRight(baseURL, "/") + "/",
+		user:     user,
+		password: password,
+		http:     &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// Get reads the file of a record
+func (ws *WebDAVStore) Get(key string) (Record, error) {
+	resp, err := ws.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return Record{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Record{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Record{}, webDAVError(resp)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to read record %w", err)
+	}
+	if len(data) == 0 {
+		// a lock taken on a missing file leaves an empty one behind
+		return Record{}, nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if len(etag) == 0 {
+		return Record{}, fmt.Errorf("WebDAV server sent no ETag, conflicting writes could not be told apart")
+	}
+
+	return Record{Revision: etagRevision(etag), Data: data}, nil
+}
+
+// Put replaces the file of a record when it is still at revision. Servers that do not lock fall back to If-Match,
+// which most honor.
+func (ws *WebDAVStore) Put(key string, data []byte, revision uint64) (Record, error) {
+	token, err := ws.lock(key)
+	if err != nil {
+		return Record{}, err
+	}
+	if len(token) != 0 {
+		defer ws.unlock(key, token)
+	}
+
+	current, err := ws.head(key)
+	if err != nil {
+		return Record{}, err
+	}
+	if etagRevision(current) != revision {
+		return Record{Revision: etagRevision(current)}, ErrConflict
+	}
+
+	headers := map[string]string{"Content-Type": "application/octet-stream"}
+	switch {
+	case len(token) != 0:
+		headers["If"] = "(<" + token + ">)"
+	case len(current) != 0:
+		headers["If-Match"] = current
+	default:
+		headers["If-None-Match"] = "*"
+	}
+
+	resp, err := ws.do(http.MethodPut, key, data, headers)
+	if err != nil {
+		return Record{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	case http.StatusPreconditionFailed, http.StatusLocked:
+		return Record{}, ErrConflict
+	default:
+		return Record{}, webDAVError(resp)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if len(etag) == 0 {
+		etag, err = ws.head(key)
+		if err != nil {
+			return Record{}, err
+		}
+	}
+
+	return Record{Revision: etagRevision(etag), Data: data}, nil
+}
+
+// lock takes a write lock on the file of a record, giving no token when the server does not lock. A file locked by
+// another client is a conflict, as that client is about to write it.
+func (ws *WebDAVStore) lock(key string) (string, error) {
+	resp, err := ws.do("LOCK", key, []byte(lockInfo), map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        "0",
+		"Timeout":      "Second-30",
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		token := strings.TrimSuffix(strings.TrimPrefix(resp.Header.Get("Lock-Token"), "<"), ">")
+		if len(token) == 0 {
+			return "", fmt.Errorf("WebDAV server sent no lock token")
+		}
+		return token, nil
+	case http.StatusLocked:
+		return "", ErrConflict
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return "", nil
+	default:
+		return "", webDAVError(resp)
+	}
+}
+
+func (ws *WebDAVStore) unlock(key, token string) {
+	resp, err := ws.do("UNLOCK", key, nil, map[string]string{"Lock-Token": "<" + token + ">"})
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// head gives the ETag of the file of a record, none when it is missing or empty
+func (ws *WebDAVStore) head(key string) (string, error) {
+	resp, err := ws.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", nil
+	case resp.StatusCode != http.StatusOK:
+		return "", webDAVError(resp)
+	case resp.ContentLength == 0:
+		// a lock taken on a missing file leaves an empty one behind
+		return "", nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if len(etag) == 0 {
+		return "", fmt.Errorf("WebDAV server sent no ETag, conflicting writes could not be told apart")
+	}
+
+	return etag, nil
+}
+
+func (ws *WebDAVStore) do(method, key string, body []byte, headers map[string]string) (*http.Response, error) {
+	if !recordKey.MatchString(key) {
+		return nil, fmt.Errorf("invalid record key %q", key)
+	}
+
+	req, err := http.NewRequest(method, ws.baseURL+key+webDAVExtension, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request %w", err)
+	}
+
+	if len(ws.user) != 0 {
+		req.SetBasicAuth(ws.user, ws.password)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := ws.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the WebDAV server %w", err)
+	}
+
+	return resp, nil
+}
+
+// etagRevision turns an ETag into a revision, a missing one is revision 0 as a record that was never written is
+func etagRevision(etag string) uint64 {
+	if len(etag) == 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(etag))
+	if revision := h.Sum64(); revision != 0 {
+		return revision
+	}
+
+	return 1
+}
+
+func webDAVError(resp *http.Response) error {
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	return fmt.Errorf("WebDAV server answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
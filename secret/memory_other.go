@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package secret
+
+// alloc falls back to the go heap where memory cannot be locked, the secret is still wiped explicitly
+func alloc(size int) ([]byte, bool) {
+	return make([]byte, size), false
+}
+
+func free([]byte) {}
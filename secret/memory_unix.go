@@ -0,0 +1,28 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package secret
+
+import "syscall"
+
+// alloc maps size bytes outside of the go heap and locks them into memory, falling back to the heap when either fails,
+// for example because RLIMIT_MEMLOCK is too low
+func alloc(size int) ([]byte, bool) {
+	data, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, size), false
+	}
+
+	if err := syscall.Mlock(data); err != nil {
+		syscall.Munmap(data)
+		return make([]byte, size), false
+	}
+
+	return data, true
+}
+
+// free unlocks and unmaps memory that alloc locked
+func free(data []byte) {
+	syscall.Munlock(data)
+	syscall.Munmap(data)
+}
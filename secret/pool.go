@@ -0,0 +1,82 @@
+package secret
+
+import (
+	"os"
+	"sync"
+)
+
+// memKind tells where the memory of a buffer comes from
+type memKind int
+
+const (
+	// heapMem is ordinary go memory, used where memory cannot be locked
+	heapMem memKind = iota
+	// pooledMem is a slot of a locked page shared with other small secrets
+	pooledMem
+	// mappedMem is locked memory of its own, for secrets bigger than a page
+	mappedMem
+)
+
+// minSlot is the smallest slot a locked page is split into, keys are 32 bytes
+const minSlot = 32
+
+// pageSize is the size of the locked pages split into slots
+var pageSize = os.Getpagesize()
+
+// slots keeps the free slots of locked pages by size. Short lived secrets, such as the keys of crypters made for a
+// single write, take a slot rather than locking a page each, which would soon run into RLIMIT_MEMLOCK. Pages are
+// never unlocked, they are reused for as long as the process runs.
+var slots = struct {
+	sync.Mutex
+	free map[int][][]byte
+}{free: make(map[int][][]byte)}
+
+// take gives memory for size bytes, locked where the platform allows it
+func take(size int) ([]byte, memKind) {
+	slot := minSlot
+	for slot < size {
+		slot *= 2
+	}
+
+	if slot > pageSize {
+		data, locked := alloc(size)
+		if !locked {
+			return data, heapMem
+		}
+
+		return data, mappedMem
+	}
+
+	slots.Lock()
+	defer slots.Unlock()
+
+	if len(slots.free[slot]) == 0 {
+		page, locked := alloc(pageSize)
+		if !locked {
+			return make([]byte, size), heapMem
+		}
+
+		for i := 0; i+slot <= len(page); i += slot {
+			slots.free[slot] = append(slots.free[slot], page[i:i+slot:i+slot])
+		}
+	}
+
+	free := slots.free[slot]
+	mem := free[len(free)-1]
+	slots.free[slot] = free[:len(free)-1]
+
+	return mem[:size], pooledMem
+}
+
+// give returns zeroed memory taken with take
+func give(mem []byte, kind memKind) {
+	switch kind {
+	case pooledMem:
+		slots.Lock()
+		defer slots.Unlock()
+
+		slots.free[cap(mem)] = append(slots.free[cap(mem)], mem[:cap(mem)])
+	case mappedMem:
+		free(mem[:cap(mem)])
+	}
+}
@@ -0,0 +1,157 @@
+// Package secret keeps passwords and keys in buffers that are locked into memory where the platform allows it, so that
+// they are not swapped to disk, and that are wiped explicitly once they are no longer needed.
+package secret
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Buffer holds a secret. The zero value and nil are empty buffers.
+type Buffer struct {
+	mu sync.Mutex
+	// data is the secret, nil once wiped
+	data []byte
+	// mem is the memory data lives in. A wipe only zeroes it, it is given back once the buffer is collected, as slices
+	// of it given out by Bytes may still be in use.
+	mem  []byte
+	kind memKind
+}
+
+// New allocates a zeroed buffer of size bytes
+func New(size int) *Buffer {
+	b := new(Buffer)
+	b.allocate(size)
+
+	return b
+}
+
+// allocate gives the buffer memory for size bytes, reusing what it has when it fits
+func (b *Buffer) allocate(size int) {
+	if size <= 0 {
+		return
+	}
+
+	switch {
+	case cap(b.mem) >= size:
+	case b.mem != nil:
+		// slices of the old memory may still be read, it is given back once collected as the buffer's would be
+		old := &Buffer{mem: b.mem, kind: b.kind}
+		runtime.SetFinalizer(old, (*Buffer).release)
+		b.mem, b.kind = take(size)
+	default:
+		b.mem, b.kind = take(size)
+		runtime.SetFinalizer(b, (*Buffer).release)
+	}
+
+	b.mem = b.mem[:size]
+	b.data = b.mem
+}
+
+// FromBytes moves src into a new buffer and zeroes src
+func FromBytes(src []byte) *Buffer {
+	b := New(len(src))
+	copy(b.data, src)
+	Zero(src)
+
+	return b
+}
+
+// FromString copies s into a new buffer. Strings cannot be wiped, so secrets should be moved into a buffer as early as
+// possible and the string dropped.
+func FromString(s string) *Buffer {
+	b := New(len(s))
+	copy(b.data, s)
+
+	return b
+}
+
+// Bytes gives the secret itself, not a copy. It must not be kept beyond the life of the buffer, after a wipe it reads
+// as zeroes.
+func (b *Buffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.data
+}
+
+// Len gives the size of the secret
+func (b *Buffer) Len() int {
+	return len(b.Bytes())
+}
+
+// Locked tells whether the secret is locked into memory
+func (b *Buffer) Locked() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.data != nil && b.kind != heapMem
+}
+
+// Copy gives a new buffer holding the same secret
+func (b *Buffer) Copy() *Buffer {
+	data := b.Bytes()
+	c := New(len(data))
+	copy(c.data, data)
+
+	return c
+}
+
+// Wipe zeroes the secret, the buffer is empty afterwards. Its memory stays mapped until the buffer is collected, so
+// that anyone still reading the secret reads zeroes rather than crashing.
+func (b *Buffer) Wipe() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	Zero(b.mem)
+	b.data = nil
+}
+
+// release gives the memory of a collected buffer back
+func (b *Buffer) release() {
+	Zero(b.mem[:cap(b.mem)])
+	give(b.mem, b.kind)
+	b.mem, b.data = nil, nil
+}
+
+// String keeps the secret out of logs and error messages
+func (b *Buffer) String() string {
+	return "[secret]"
+}
+
+// GobEncode lets a buffer be stored encrypted, the encoded copy should be wiped by the caller
+func (b *Buffer) GobEncode() ([]byte, error) {
+	return append([]byte(nil), b.Bytes()...), nil
+}
+
+// GobDecode moves the decoded secret into locked memory
+func (b *Buffer) GobDecode(data []byte) error {
+	b.Wipe()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.allocate(len(data))
+	copy(b.data, data)
+
+	return nil
+}
+
+// Zero overwrites data with zeroes, for plaintext that held a secret outside of a buffer
+func Zero(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
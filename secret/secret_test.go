@@ -0,0 +1,67 @@
+package secret_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"soul/secret"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWipe(t *testing.T) {
+	t.Parallel()
+
+	src := []byte("password")
+	b := secret.FromBytes(src)
+	assert.Equal(t, make([]byte, len(src)), src)
+	assert.Equal(t, []byte("password"), b.Bytes())
+
+	// the secret stays readable as zeroes for anyone still holding it, locked or not
+	view := b.Bytes()
+	b.Wipe()
+	assert.Equal(t, 0, b.Len())
+	assert.False(t, b.Locked())
+	assert.Equal(t, make([]byte, len(view)), view)
+
+	// wiping twice and wiping nil are fine
+	b.Wipe()
+	var empty *secret.Buffer
+	empty.Wipe()
+	assert.Equal(t, 0, empty.Len())
+}
+
+func TestGobAndFormatting(t *testing.T) {
+	t.Parallel()
+
+	type holder struct {
+		Password *secret.Buffer
+	}
+
+	var encoded bytes.Buffer
+	assert.Nil(t, gob.NewEncoder(&encoded).Encode(holder{Password: secret.FromString("password")}))
+
+	decoded := new(holder)
+	assert.Nil(t, gob.NewDecoder(&encoded).Decode(decoded))
+	assert.Equal(t, []byte("password"), decoded.Password.Bytes())
+	assert.NotContains(t, fmt.Sprintf("%v %s", decoded.Password, decoded), "password")
+}
+
+func TestManySmallBuffers(t *testing.T) {
+	t.Parallel()
+
+	// small secrets share locked pages, so that many of them do not run into the limit on locked memory
+	locked := secret.New(32).Locked()
+	var buffers []*secret.Buffer
+	for i := 0; i < 100000; i++ {
+		b := secret.FromString(fmt.Sprintf("key %d", i))
+		assert.Equal(t, locked, b.Locked())
+		buffers = append(buffers, b)
+	}
+
+	for i, b := range buffers {
+		assert.Equal(t, []byte(fmt.Sprintf("key %d", i)), b.Bytes())
+		b.Wipe()
+	}
+}
@@ -0,0 +1,92 @@
+package soul
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SessionMaxAgeKeyName      = "SESSION_MAX_AGE_MINUTES"
+	SessionMaxCheckInsKeyName = "SESSION_MAX_CHECK_INS"
+	// CheckInsKeyName counts the check-ins made with the stored credentials
+	CheckInsKeyName = "SESSION_CHECK_INS"
+)
+
+// SessionPolicy limits how long "Keep It Open" keeps a folder open, zero values mean no limit
+type SessionPolicy struct {
+	MaxAge      time.Duration
+	MaxCheckIns int
+}
+
+// DefaultSessionPolicy keeps a folder open for 30 days
+var DefaultSessionPolicy = SessionPolicy{MaxAge: 30 * 24 * time.Hour}
+
+// ErrSessionExpired is returned by CheckIn once the stored credentials are past their limits
+var ErrSessionExpired = errors.New("session expired, log in with the folder password")
+
+// GetSessionPolicy gives the policy new stored credentials get
+func GetSessionPolicy(store ConfigStore) SessionPolicy {
+	policy := DefaultSessionPolicy
+	if value := strings.TrimSpace(store.GetString(SessionMaxAgeKeyName)); value != "" {
+		if minutes, err := strconv.Atoi(value); err == nil && minutes >= 0 {
+			policy.MaxAge = time.Duration(minutes) * time.Minute
+		}
+	}
+
+	if value := strings.TrimSpace(store.GetString(SessionMaxCheckInsKeyName)); value != "" {
+		if checkIns, err := strconv.Atoi(value); err == nil && checkIns >= 0 {
+			policy.MaxCheckIns = checkIns
+		}
+	}
+
+	return policy
+}
+
+// SetSessionPolicy stores the policy new stored credentials get, credentials already stored keep theirs
+func SetSessionPolicy(store ConfigStore, policy SessionPolicy) {
+	store.SetString(SessionMaxAgeKeyName, strconv.Itoa(int(policy.MaxAge/time.Minute)))
+	store.SetString(SessionMaxCheckInsKeyName, strconv.Itoa(policy.MaxCheckIns))
+}
+
+// Apply stamps credentials about to be stored with the time and the limits of the policy
+func (p SessionPolicy) Apply(credentials *Credentials) {
+	credentials.IssuedAt = time.Now()
+	credentials.MaxAge = p.MaxAge
+	credentials.MaxCheckIns = p.MaxCheckIns
+}
+
+// CheckIn counts a check-in with credentials opened from the store. Once they are past their max age or max number
+// of check-ins, the stored credentials and the PIN are wiped and ErrSessionExpired is returned. Credentials stored
+// before they carried an issue time are expired as well.
+func CheckIn(store ConfigStore, credentials *Credentials) error {
+	if credentials.IssuedAt.IsZero() {
+		DeleteCredentials(store)
+		return ErrSessionExpired
+	}
+
+	if credentials.MaxAge > 0 && time.Since(credentials.IssuedAt) > credentials.MaxAge {
+		DeleteCredentials(store)
+		return ErrSessionExpired
+	}
+
+	checkIns := getInt(store, CheckInsKeyName) + 1
+	if credentials.MaxCheckIns > 0 && checkIns > credentials.MaxCheckIns {
+		DeleteCredentials(store)
+		return ErrSessionExpired
+	}
+
+	store.SetString(CheckInsKeyName, strconv.Itoa(checkIns))
+
+	return nil
+}
+
+// CheckInsLeft gives the number of check-ins the credentials allow before a full login, -1 when they allow any number
+func CheckInsLeft(store ConfigStore, credentials *Credentials) int {
+	if credentials.MaxCheckIns <= 0 {
+		return -1
+	}
+
+	return credentials.MaxCheckIns - getInt(store, CheckInsKeyName)
+}
@@ -0,0 +1,233 @@
+package soul
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SettingsKeyName holds the json encoded Settings
+const SettingsKeyName = "SETTINGS"
+
+// SettingsVersion is the schema version Settings are written with, settings of a newer version are not loaded
+const SettingsVersion = 1
+
+// Theme is the colour scheme of the ui
+type Theme string
+
+const (
+	ThemeDark   Theme = "dark"
+	ThemeLight  Theme = "light"
+	ThemeSystem Theme = "system"
+)
+
+// WrapMode is how the editor wraps lines longer than it is wide
+type WrapMode string
+
+const (
+	WrapOff   WrapMode = "off"
+	WrapWord  WrapMode = "word"
+	WrapBreak WrapMode = "break"
+)
+
+// SortOrder is the order notes are listed in
+type SortOrder string
+
+const (
+	// SortCreated lists notes in the order they were created
+	SortCreated SortOrder = "created"
+	// SortTitle lists notes alphabetically by their first line
+	SortTitle SortOrder = "title"
+)
+
+// Settings are the user's preferences, they are stored per profile
+type Settings struct {
+	Version int `json:"version"`
+	// SyncInterval is how often every note is checked for unsaved edits, besides saving each note shortly after it is
+	// edited, 0 turns the check off
+	SyncInterval time.Duration `json:"sync_interval"`
+	Theme        Theme         `json:"theme"`
+	FontSize     float32       `json:"font_size"`
+	Wrap         WrapMode      `json:"wrap"`
+	// AutoLock is the idle time after which an open folder locks, 0 turns auto lock off
+	AutoLock     time.Duration `json:"auto_lock"`
+	SortOrder    SortOrder     `json:"sort_order"`
+	WindowWidth  float32       `json:"window_width"`
+	WindowHeight float32       `json:"window_height"`
+}
+
+// limits of the values Validate accepts
+const (
+	MinSyncInterval = time.Second
+	MaxSyncInterval = 10 * time.Minute
+	MinFontSize     = 8
+	MaxFontSize     = 48
+	MaxAutoLock     = 24 * time.Hour
+	MinWindowSize   = 200
+)
+
+// DefaultSettings are the settings used until the user changes them
+func DefaultSettings() Settings {
+	return Settings{
+		Version:      SettingsVersion,
+		SyncInterval: 0,
+		Theme:        ThemeDark,
+		FontSize:     14,
+		Wrap:         WrapWord,
+		AutoLock:     DefaultAutoLock,
+		SortOrder:    SortCreated,
+		WindowWidth:  1000,
+		WindowHeight: 600,
+	}
+}
+
+// Validate checks every setting is one the app supports
+func (s Settings) Validate() error {
+	var problems []string
+	if s.SyncInterval != 0 && (s.SyncInterval < MinSyncInterval || s.SyncInterval > MaxSyncInterval) {
+		problems = append(problems, fmt.Sprintf("sync interval must be off or between %v and %v", MinSyncInterval, MaxSyncInterval))
+	}
+
+	switch s.Theme {
+	case ThemeDark, ThemeLight, ThemeSystem:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown theme %q", s.Theme))
+	}
+
+	if s.FontSize < MinFontSize || s.FontSize > MaxFontSize {
+		problems = append(problems, fmt.Sprintf("font size must be between %d and %d", MinFontSize, MaxFontSize))
+	}
+
+	switch s.Wrap {
+	case WrapOff, WrapWord, WrapBreak:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown wrap mode %q", s.Wrap))
+	}
+
+	if s.AutoLock < 0 || s.AutoLock > MaxAutoLock {
+		problems = append(problems, fmt.Sprintf("auto lock must be between 0 and %v", MaxAutoLock))
+	}
+
+	switch s.SortOrder {
+	case SortCreated, SortTitle:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown sort order %q", s.SortOrder))
+	}
+
+	if s.WindowWidth < MinWindowSize || s.WindowHeight < MinWindowSize {
+		problems = append(problems, fmt.Sprintf("window must be at least %dx%d", MinWindowSize, MinWindowSize))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid settings: %s", strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// withDefaults replaces every invalid setting with its default, so that one bad value does not lose the others
+func (s Settings) withDefaults() Settings {
+	defaults := DefaultSettings()
+	fixed := s
+	fixed.Version = SettingsVersion
+
+	// each field is checked on its own, against the defaults of the others
+	fields := []func(from, to *Settings){
+		func(from, to *Settings) { to.SyncInterval = from.SyncInterval },
+		func(from, to *Settings) { to.Theme = from.Theme },
+		func(from, to *Settings) { to.FontSize = from.FontSize },
+		func(from, to *Settings) { to.Wrap = from.Wrap },
+		func(from, to *Settings) { to.AutoLock = from.AutoLock },
+		func(from, to *Settings) { to.SortOrder = from.SortOrder },
+		func(from, to *Settings) { to.WindowWidth, to.WindowHeight = from.WindowWidth, from.WindowHeight },
+	}
+	for _, copyField := range fields {
+		candidate := defaults
+		copyField(&s, &candidate)
+		if candidate.Validate() != nil {
+			copyField(&defaults, &fixed)
+		}
+	}
+
+	return fixed
+}
+
+// LoadSettings reads the stored settings, migrating older versions and applying the active policy. Invalid values fall
+// back to their defaults, the returned error says which, the returned settings are always usable.
+func LoadSettings(store ConfigStore) (Settings, error) {
+	settings, err := loadSettings(store)
+	// a policy that cannot be read blocks opening folders, the settings stay usable meanwhile
+	if policy, policyErr := ActivePolicy(); policyErr == nil {
+		settings = policy.EnforceSettings(settings)
+	}
+
+	return settings, err
+}
+
+func loadSettings(store ConfigStore) (Settings, error) {
+	serialized := store.GetString(SettingsKeyName)
+	if strings.TrimSpace(serialized) == "" {
+		return DefaultSettings(), nil
+	}
+
+	var version struct {
+		Version int `json:"version"`
+	}
+	err := json.Unmarshal([]byte(serialized), &version)
+	if err != nil {
+		return DefaultSettings(), fmt.Errorf("failed to decode settings %w", err)
+	}
+
+	if version.Version > SettingsVersion {
+		return DefaultSettings(), fmt.Errorf("settings version %d is newer than this app supports", version.Version)
+	}
+
+	// fields missing from older versions keep their defaults
+	settings := DefaultSettings()
+	err = json.Unmarshal([]byte(serialized), &settings)
+	if err != nil {
+		return DefaultSettings(), fmt.Errorf("failed to decode settings %w", err)
+	}
+
+	settings.Version = SettingsVersion
+	err = settings.Validate()
+	if err != nil {
+		return settings.withDefaults(), err
+	}
+
+	return settings, nil
+}
+
+// SaveSettings validates and stores the settings, settings the active policy locks cannot be changed past it
+func SaveSettings(store ConfigStore, settings Settings) error {
+	policy, err := ActivePolicy()
+	if err != nil {
+		return err
+	}
+
+	return saveSettings(store, settings, policy)
+}
+
+// saveSettings stores the settings once they are valid and within policy
+func saveSettings(store ConfigStore, settings Settings, policy *Policy) error {
+	settings.Version = SettingsVersion
+	err := settings.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = policy.CheckSettings(settings)
+	if err != nil {
+		return err
+	}
+
+	serialized, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode settings %w", err)
+	}
+
+	store.SetString(SettingsKeyName, string(serialized))
+
+	return nil
+}
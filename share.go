@@ -0,0 +1,104 @@
+package soul
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+// SharedNoteType is the PEM block type of a note shared with ShareNote
+const SharedNoteType = "SOUL SHARED NOTE"
+
+// Identity is a public key pair that data can be sealed to and opened with
+type Identity interface {
+	// PublicKey gives the string others seal data to
+	PublicKey() string
+	Seal(plaintext []byte, recipients []string) ([]byte, error)
+	Open(sealed []byte) ([]byte, error)
+}
+
+// IdentityProvider is implemented by repositories that keep an identity for their folder
+type IdentityProvider interface {
+	Identity() (Identity, error)
+}
+
+// sharedNote is what gets sealed when a note is shared
+type sharedNote struct {
+	Text     string
+	SharedBy string
+	SharedAt time.Time
+}
+
+// Identity gives the identity of the folder the notes are stored in
+func (ns *NoteService) Identity() (Identity, error) {
+	provider, ok := ns.Repo.(IdentityProvider)
+	if !ok {
+		return nil, fmt.Errorf("repository does not support sharing notes")
+	}
+
+	return provider.Identity()
+}
+
+// ShareNote encrypts the note to the public keys of the recipients and armors it as text that can be sent to them
+func (ns *NoteService) ShareNote(note *Note, recipients []string) (string, error) {
+	identity, err := ns.Identity()
+	if err != nil {
+		return "", err
+	}
+
+	text, err := note.Text.Get()
+	if err != nil {
+		return "", fmt.Errorf("unable to read text from note %w", err)
+	}
+
+	var encoded bytes.Buffer
+	err = gob.NewEncoder(&encoded).Encode(sharedNote{Text: text, SharedBy: identity.PublicKey(), SharedAt: time.Now()})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode note %w", err)
+	}
+
+	sealed, err := identity.Seal(encoded.Bytes(), recipients)
+	if err != nil {
+		return "", fmt.Errorf("failed to seal note %w", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: SharedNoteType, Bytes: sealed})), nil
+}
+
+// ImportNote opens a note shared to this folder's identity and stores it as a new note
+func (ns *NoteService) ImportNote(armored string) (*Note, error) {
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != SharedNoteType {
+		return nil, fmt.Errorf("not a shared note")
+	}
+
+	identity, err := ns.Identity()
+	if err != nil {
+		return nil, err
+	}
+
+	opened, err := identity.Open(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shared note %w", err)
+	}
+
+	shared := new(sharedNote)
+	err = gob.NewDecoder(bytes.NewReader(opened)).Decode(shared)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode shared note %w", err)
+	}
+
+	note := Note{Text: NewBindingFromString(shared.Text)}
+	err = ns.Repo.Create(&note)
+	if err != nil {
+		return nil, err
+	}
+
+	ns.mu.Lock()
+	note = ns.appendNote(note)
+	ns.mu.Unlock()
+
+	return &note, nil
+}
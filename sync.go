@@ -1,10 +1,14 @@
 package soul
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sync"
 	"time"
+
+	"fyne.io/fyne/v2/data/binding"
 )
 
 // ReadNotes reades notes from the source
@@ -13,70 +17,571 @@ type ReadNotes func() ([]Note, error)
 // UpdateNote updates the note
 type UpdateNote func(note *Note) error
 
-// WriteErr writes an error
+// WriteErr writes an error. It is called on the goroutine of the SyncService, which it must not Stop as Stop waits for
+// that goroutine to end.
 type WriteErr func(error)
 
+// DefaultSyncDebounce is how long after the last edit to a note it is saved
+const DefaultSyncDebounce = time.Second
+
+// DefaultSyncRetry and DefaultSyncMaxRetry bound the backoff between attempts to save a note that failed to save
+const (
+	DefaultSyncRetry    = time.Second
+	DefaultSyncMaxRetry = 5 * time.Minute
+)
+
+// syncMaxDelayFactor caps, as a multiple of the debounce, how long continuous typing can put off saving a note
+const syncMaxDelayFactor = 10
+
+// NoteSyncState is where a note is in being saved
+type NoteSyncState int
+
+const (
+	// NoteSaved notes have no edits that are not saved
+	NoteSaved NoteSyncState = iota
+	// NoteDirty notes have edits waiting to be saved
+	NoteDirty
+	// NoteSaving notes are being written
+	NoteSaving
+	// NoteFailed notes failed to save, they are retried with backoff
+	NoteFailed
+)
+
+func (s NoteSyncState) String() string {
+	switch s {
+	case NoteDirty:
+		return "unsaved changes"
+	case NoteSaving:
+		return "saving"
+	case NoteFailed:
+		return "failed to save"
+	default:
+		return "saved"
+	}
+}
+
+// NoteSyncStatus is how saving a single note goes
+type NoteSyncStatus struct {
+	State     NoteSyncState
+	LastSaved time.Time
+	// Err and Attempts are those of the failed attempts since the note last saved
+	Err       error
+	Attempts  int
+	NextRetry time.Time
+}
+
+// SyncStatus is a snapshot of what a sync service is doing
+type SyncStatus struct {
+	Running bool
+	// Pending is the number of notes with edits that are not saved yet, failed ones included
+	Pending   int
+	Failed    int
+	LastSaved time.Time
+	// LastError is the error of the last failed save, it clears once every note saves again
+	LastError error
+	// Notes holds the notes that were edited or saved since the service was created, by id
+	Notes map[string]NoteSyncStatus
+}
+
+// watchedNote is a note whose edits are listened for
+type watchedNote struct {
+	note     Note
+	listener binding.DataListener
+	// timer saves the note once edits stop or retries a failed save, it is nil while nothing is pending
+	timer *time.Timer
+	// pendingSince is when the first edit that is not saved yet was made
+	pendingSince time.Time
+}
+
+// SyncService saves notes shortly after they are edited. Edits are picked up from the note bindings and each note is
+// saved once edits to it stop for the debounce, so a burst of typing makes a single write. Failed saves are retried
+// with exponential backoff. Polling every note on an interval is an optional fallback.
 type SyncService struct {
 	noteIndex     map[string]string
 	readNotesFunc ReadNotes
 	updateNote    UpdateNote
 	interval      time.Duration
+	debounce      time.Duration
+	retry         time.Duration
+	maxRetry      time.Duration
 	writeErr      WriteErr
-	quitChan      chan bool
-	running       bool
+	watched       map[string]*watchedNote
+	notes         map[string]*NoteSyncStatus
+	lastSaved     time.Time
+	lastErr       error
+	subscribers   map[chan SyncStatus]struct{}
+	// active mirrors running for status snapshots taken under mu
+	active bool
+	// mu keeps a flush, edits and the ticker from racing each other over the note index. It is never held while
+	// calling back into notes, the repository or writeErr, which may call the service again.
+	mu sync.Mutex
+	// saving orders writes so that an older text of a note never lands after a newer one, it is taken before mu
+	saving sync.Mutex
+
+	// state guards the lifecycle, it is always taken before mu, never while holding it
+	state   sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	// stopErr is the error of the flush made on stopping, written before done is closed
+	stopErr error
 }
 
+// Start starts saving edits until Stop is called, starting a started service does nothing
 func (ss *SyncService) Start() {
-	if ss.running {
+	ss.StartContext(context.Background())
+}
+
+// StartContext starts saving edits until Stop is called or ctx is done, either way pending edits are saved on the way
+// out. Starting a started service does nothing.
+func (ss *SyncService) StartContext(ctx context.Context) {
+	ss.state.Lock()
+	defer ss.state.Unlock()
+
+	if ss.isRunning() {
+		return
+	}
+
+	err := ss.Watch()
+	if err != nil {
+		ss.writeErr(err)
+	}
+
+	ctx, ss.cancel = context.WithCancel(ctx)
+	ss.done = make(chan struct{})
+	ss.stopErr = nil
+	ss.running = true
+	ss.setActive(true)
+	go ss.run(ctx, ss.done)
+}
+
+// Stop stops the service and saves pending edits, returning the error of that save. Stopping a stopped service does
+// nothing. It waits for the goroutine of the service, so it must not be called from its WriteErr.
+func (ss *SyncService) Stop() error {
+	ss.state.Lock()
+	defer ss.state.Unlock()
+
+	if !ss.running {
+		return nil
+	}
+
+	ss.cancel()
+	<-ss.done
+	ss.running = false
+
+	return ss.stopErr
+}
+
+// SetRetry sets the backoff between attempts to save a note that failed to save, it doubles from retry up to maxRetry
+func (ss *SyncService) SetRetry(retry, maxRetry time.Duration) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.retry, ss.maxRetry = retry, maxRetry
+}
+
+// Status gives what the service is doing
+func (ss *SyncService) Status() SyncStatus {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.status()
+}
+
+// Subscribe gives a channel that receives the status whenever it changes, starting with the current one. A subscriber
+// that falls behind only misses statuses in between, it always gets the latest one. cancel stops and closes the
+// channel.
+func (ss *SyncService) Subscribe() (statuses <-chan SyncStatus, cancel func()) {
+	ch := make(chan SyncStatus, 1)
+
+	ss.mu.Lock()
+	ss.subscribers[ch] = struct{}{}
+	ch <- ss.status()
+	ss.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			ss.mu.Lock()
+			defer ss.mu.Unlock()
+
+			delete(ss.subscribers, ch)
+			close(ch)
+		})
+	}
+}
+
+// status takes a snapshot of the status, the caller holds ss.mu
+func (ss *SyncService) status() SyncStatus {
+	status := SyncStatus{
+		Running:   ss.active,
+		LastSaved: ss.lastSaved,
+		LastError: ss.lastErr,
+		Notes:     make(map[string]NoteSyncStatus, len(ss.notes)),
+	}
+
+	for id, note := range ss.notes {
+		status.Notes[id] = *note
+		if note.State != NoteSaved {
+			status.Pending++
+		}
+		if note.State == NoteFailed {
+			status.Failed++
+		}
+	}
+
+	return status
+}
+
+// publish sends the status to every subscriber, replacing any status they did not receive yet. The caller holds ss.mu.
+func (ss *SyncService) publish() {
+	if len(ss.subscribers) == 0 {
 		return
 	}
 
-	ticker := time.NewTicker(ss.interval)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				err := ss.executeOnce()
-				if err != nil {
-					ss.writeErr(err)
-				}
-			case <-ss.quitChan:
-				ticker.Stop()
-				ss.running = false
-				return
+	status := ss.status()
+	for ch := range ss.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- status
+	}
+}
+
+func (ss *SyncService) setActive(active bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.active = active
+	ss.publish()
+}
+
+// noteStatus gives the sync status of a note, creating it, the caller holds ss.mu
+func (ss *SyncService) noteStatus(id string) *NoteSyncStatus {
+	status, ok := ss.notes[id]
+	if !ok {
+		status = new(NoteSyncStatus)
+		ss.notes[id] = status
+	}
+
+	return status
+}
+
+// failed counts the notes that failed to save, the caller holds ss.mu
+func (ss *SyncService) failed() int {
+	failed := 0
+	for _, note := range ss.notes {
+		if note.State == NoteFailed {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// isRunning tells whether the service is started and its context is not done, the caller holds ss.state
+func (ss *SyncService) isRunning() bool {
+	if !ss.running {
+		return false
+	}
+
+	select {
+	case <-ss.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// run polls when an interval is set and, once ctx is done, stops listening and saves pending edits
+func (ss *SyncService) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	var tick <-chan time.Time
+	if ss.interval > 0 {
+		ticker := time.NewTicker(ss.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			err := ss.Watch()
+			if err == nil {
+				err = ss.executeOnce()
 			}
+			if err != nil {
+				ss.writeErr(err)
+			}
+		case <-ctx.Done():
+			ss.mu.Lock()
+			ss.unwatchAll()
+			ss.mu.Unlock()
+
+			ss.stopErr = ss.executeOnce()
+			ss.setActive(false)
+			return
 		}
-	}()
+	}
+}
 
-	ss.running = true
+// Watch starts listening for edits to notes added since the service started
+func (ss *SyncService) Watch() error {
+	notes, err := ss.readNotesFunc()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve notes %w", err)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, note := range notes {
+		existing, ok := ss.watched[note.ID]
+		if ok && existing.note.Text == note.Text && existing.note.Doc == note.Doc {
+			continue
+		}
+
+		if ok {
+			ss.unwatch(existing)
+		}
+
+		id := note.ID
+		watched := &watchedNote{note: note}
+		watched.listener = binding.NewDataListener(func() {
+			ss.noteChanged(id)
+		})
+		ss.watched[id] = watched
+		note.Text.AddListener(watched.listener)
+	}
+
+	return nil
+}
+
+// Flush writes every note changed since the last sync right away, a note that fails does not stop the others
+func (ss *SyncService) Flush() error {
+	ss.mu.Lock()
+	for _, watched := range ss.watched {
+		ss.cancelPending(watched)
+	}
+	ss.mu.Unlock()
+
+	return ss.executeOnce()
+}
+
+// noteChanged schedules saving the note once edits to it stop
+func (ss *SyncService) noteChanged(id string) {
+	ss.mu.Lock()
+	watched, ok := ss.watched[id]
+	var note Note
+	idle := ok && watched.timer == nil
+	if idle {
+		note = watched.note
+	}
+	ss.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// the text is read without mu held, its binding may call back into the service
+	var signature string
+	var err error
+	if idle {
+		signature, err = calculateSignature(&note)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	watched, ok = ss.watched[id]
+	if !ok {
+		return
+	}
+
+	if watched.timer == nil {
+		// listeners also fire when they are added, those are not edits
+		if idle && err == nil && signature == ss.noteIndex[id] {
+			return
+		}
+
+		watched.pendingSince = time.Now()
+		watched.timer = time.AfterFunc(ss.debounce, func() {
+			ss.savePending(id)
+		})
+	} else if time.Since(watched.pendingSince) < ss.debounce*syncMaxDelayFactor {
+		watched.timer.Reset(ss.debounce)
+	}
+
+	status := ss.noteStatus(id)
+	if status.State != NoteFailed {
+		status.State = NoteDirty
+	}
+	ss.publish()
+}
+
+func (ss *SyncService) savePending(id string) {
+	ss.mu.Lock()
+	watched, ok := ss.watched[id]
+	if ok {
+		watched.timer = nil
+	}
+	ss.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	err := ss.saveNote(&watched.note)
+	if err != nil {
+		ss.writeErr(err)
+	}
+}
+
+// scheduleRetry retries saving a note that failed to save with backoff, an edit in between retries sooner. The caller
+// holds ss.mu.
+func (ss *SyncService) scheduleRetry(id string) {
+	watched, ok := ss.watched[id]
+	if !ok {
+		return
+	}
+
+	ss.cancelPending(watched)
+	status := ss.noteStatus(id)
+	wait := ss.backoff(status.Attempts)
+	status.NextRetry = time.Now().Add(wait)
+	watched.pendingSince = time.Now()
+	watched.timer = time.AfterFunc(wait, func() {
+		ss.savePending(id)
+	})
+}
+
+// backoff gives the wait before the next attempt after the given number of failed ones
+func (ss *SyncService) backoff(attempts int) time.Duration {
+	wait := ss.retry
+	for i := 1; i < attempts && wait < ss.maxRetry; i++ {
+		wait *= 2
+	}
+
+	if wait > ss.maxRetry {
+		return ss.maxRetry
+	}
+
+	return wait
+}
+
+// cancelPending stops the save scheduled for a note, the caller holds ss.mu
+func (ss *SyncService) cancelPending(watched *watchedNote) {
+	if watched.timer != nil {
+		watched.timer.Stop()
+		watched.timer = nil
+	}
+}
+
+// unwatch stops listening for edits to a note, the caller holds ss.mu
+func (ss *SyncService) unwatch(watched *watchedNote) {
+	ss.cancelPending(watched)
+	watched.note.Text.RemoveListener(watched.listener)
+	delete(ss.watched, watched.note.ID)
 }
 
-func (ss *SyncService) Stop() {
-	ss.quitChan <- true
+func (ss *SyncService) unwatchAll() {
+	for _, watched := range ss.watched {
+		ss.unwatch(watched)
+	}
 }
 
+// executeOnce saves every changed note, a note that fails does not stop the others from being saved
 func (ss *SyncService) executeOnce() error {
 	notes, err := ss.readNotesFunc()
 	if err != nil {
 		return fmt.Errorf("unable to retrieve notes %w", err)
 	}
 
+	var firstErr error
+	failed := 0
 	for _, note := range notes {
-		currentSignature, err := calculateSignature(&note)
+		err = ss.saveNote(&note)
 		if err != nil {
-			return err
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
 		}
+	}
 
-		if ss.noteIndex[note.ID] != currentSignature {
-			err = ss.updateNote(&note)
-			if err != nil {
-				return fmt.Errorf("failed to update note %s %w", note.ID, err)
-			}
+	if failed > 1 {
+		return fmt.Errorf("%d notes failed to save, the first %w", failed, firstErr)
+	}
+	if firstErr != nil {
+		return firstErr
+	}
 
-			ss.noteIndex[note.ID] = currentSignature
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.lastErr = nil
+	ss.publish()
+
+	return nil
+}
+
+// saveNote writes the note if it changed since it was last written. ss.mu is only taken to read the index and to
+// record the outcome, the write itself runs without it.
+func (ss *SyncService) saveNote(note *Note) error {
+	ss.saving.Lock()
+	defer ss.saving.Unlock()
+
+	currentSignature, err := calculateSignature(note)
+	if err != nil {
+		return err
+	}
+
+	ss.mu.Lock()
+	if ss.noteIndex[note.ID] == currentSignature {
+		if status, ok := ss.notes[note.ID]; ok && status.State != NoteSaved {
+			*status = NoteSyncStatus{State: NoteSaved, LastSaved: status.LastSaved}
+			ss.publish()
 		}
+		ss.mu.Unlock()
+
+		return nil
+	}
+
+	status := ss.noteStatus(note.ID)
+	status.State = NoteSaving
+	ss.publish()
+	ss.mu.Unlock()
+
+	err = ss.updateNote(note)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if err != nil {
+		ss.lastErr = fmt.Errorf("failed to update note %s %w", note.ID, err)
+		status.State = NoteFailed
+		status.Err = ss.lastErr
+		status.Attempts++
+		ss.scheduleRetry(note.ID)
+		ss.publish()
+
+		return ss.lastErr
 	}
 
+	ss.noteIndex[note.ID] = currentSignature
+	ss.lastSaved = time.Now()
+	*status = NoteSyncStatus{State: NoteSaved, LastSaved: ss.lastSaved}
+	if watched, ok := ss.watched[note.ID]; ok && watched.timer != nil {
+		// edited while it was being written, the newer text is still to be saved
+		status.State = NoteDirty
+	}
+	if ss.failed() == 0 {
+		ss.lastErr = nil
+	}
+	ss.publish()
+
 	return nil
 }
 
@@ -95,9 +600,16 @@ func calculateSignature(note *Note) (string, error) {
 	return hex.EncodeToString(hashFunc.Sum(nil)), nil
 }
 
-// NewSyncService creates a new sync service that can be started and stopped
+// NewSyncService creates a new sync service that can be started and stopped. Edits are saved DefaultSyncDebounce
+// after they stop, every note is also checked each interval, 0 turns that polling off.
 func NewSyncService(readNotesFunc ReadNotes, updateNote UpdateNote, writeErr WriteErr,
 	interval time.Duration) *SyncService {
+	return NewSyncServiceWithDebounce(readNotesFunc, updateNote, writeErr, DefaultSyncDebounce, interval)
+}
+
+// NewSyncServiceWithDebounce creates a new sync service that saves edits debounce after they stop
+func NewSyncServiceWithDebounce(readNotesFunc ReadNotes, updateNote UpdateNote, writeErr WriteErr,
+	debounce, interval time.Duration) *SyncService {
 	index := make(map[string]string)
 	initialNotes, _ := readNotesFunc()
 	for _, note := range initialNotes {
@@ -107,10 +619,15 @@ func NewSyncService(readNotesFunc ReadNotes, updateNote UpdateNote, writeErr Wri
 
 	return &SyncService{
 		noteIndex:     index,
-		quitChan:      make(chan bool),
 		interval:      interval,
+		debounce:      debounce,
+		retry:         DefaultSyncRetry,
+		maxRetry:      DefaultSyncMaxRetry,
 		readNotesFunc: readNotesFunc,
 		updateNote:    updateNote,
 		writeErr:      writeErr,
+		watched:       make(map[string]*watchedNote),
+		notes:         make(map[string]*NoteSyncStatus),
+		subscribers:   make(map[chan SyncStatus]struct{}),
 	}
 }
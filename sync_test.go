@@ -0,0 +1,491 @@
+package soul_test
+
+import (
+	"context"
+	"errors"
+	"soul"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/data/binding"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder counts the writes a sync service makes per note
+type recorder struct {
+	mu     sync.Mutex
+	writes map[string]int
+	last   map[string]string
+}
+
+func newRecorder() *recorder {
+	return &recorder{writes: make(map[string]int), last: make(map[string]string)}
+}
+
+func (r *recorder) update(note *soul.Note) error {
+	text, err := note.Text.Get()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes[note.ID]++
+	r.last[note.ID] = text
+
+	return nil
+}
+
+func (r *recorder) count(id string) (int, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.writes[id], r.last[id]
+}
+
+func TestSyncDebounce(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{
+		{ID: "1", Text: soul.NewBindingFromString("first")},
+		{ID: "2", Text: soul.NewBindingFromString("second")},
+	}
+	writes := newRecorder()
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, writes.update, func(err error) {
+		assert.Nil(t, err)
+	}, 50*time.Millisecond, 0)
+	ss.Start()
+	defer ss.Stop()
+
+	// a burst of edits is saved once, after it stops
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, notes[0].Text.Set("first edited "+string(rune('a'+i))))
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Eventually(t, func() bool {
+		count, _ := writes.count("1")
+		return count == 1
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	count, text := writes.count("1")
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "first edited e", text)
+	count, _ = writes.count("2")
+	assert.Equal(t, 0, count)
+}
+
+func TestSyncFlushesLastEdit(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{{ID: "1", Text: soul.NewBindingFromString("first")}}
+	writes := newRecorder()
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, writes.update, func(err error) {
+		assert.Nil(t, err)
+	}, time.Hour, 0)
+	ss.Start()
+
+	// notes added after start are watched once asked to
+	notes = append(notes, soul.Note{ID: "2", Text: soul.NewBindingFromString("")})
+	assert.Nil(t, ss.Watch())
+
+	assert.Nil(t, notes[0].Text.Set("edited"))
+	assert.Nil(t, notes[1].Text.Set("new note"))
+	assert.Nil(t, ss.Flush())
+	ss.Stop()
+
+	count, text := writes.count("1")
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "edited", text)
+	_, text = writes.count("2")
+	assert.Equal(t, "new note", text)
+
+	// stopped services no longer listen
+	assert.Nil(t, notes[0].Text.Set("after stop"))
+	time.Sleep(50 * time.Millisecond)
+	count, _ = writes.count("1")
+	assert.Equal(t, 1, count)
+}
+
+func TestSyncPollingFallback(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{{ID: "1", Text: soul.NewBindingFromString("first")}}
+	var mu sync.Mutex
+	writes := newRecorder()
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]soul.Note(nil), notes...), nil
+	}, writes.update, func(err error) {
+		assert.Nil(t, err)
+	}, time.Hour, 20*time.Millisecond)
+	ss.Start()
+	defer ss.Stop()
+
+	// a note added without Watch is picked up by the polling
+	mu.Lock()
+	notes = append(notes, soul.Note{ID: "2", Text: soul.NewBindingFromString("typed before watched")})
+	mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		_, text := writes.count("2")
+		return text == "typed before watched"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSyncLifecycle(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{{ID: "1", Text: soul.NewBindingFromString("first")}}
+	writes := newRecorder()
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, writes.update, func(err error) {
+		assert.Nil(t, err)
+	}, time.Hour, 10*time.Millisecond)
+
+	// stopping a service that never started returns right away
+	assert.Nil(t, ss.Stop())
+	assert.False(t, ss.Status().Running)
+
+	ss.Start()
+	ss.Start()
+	assert.True(t, ss.Status().Running)
+
+	assert.Nil(t, notes[0].Text.Set("edited"))
+	assert.Eventually(t, func() bool {
+		return ss.Status().Pending == 1
+	}, time.Second, time.Millisecond)
+
+	// stopping saves the pending edit
+	assert.Nil(t, ss.Stop())
+	assert.Nil(t, ss.Stop())
+	status := ss.Status()
+	assert.False(t, status.Running)
+	assert.Equal(t, 0, status.Pending)
+	assert.False(t, status.LastSaved.IsZero())
+	_, text := writes.count("1")
+	assert.Equal(t, "edited", text)
+
+	// a stopped service starts again
+	ss.Start()
+	assert.True(t, ss.Status().Running)
+	assert.Nil(t, ss.Stop())
+}
+
+func TestSyncContext(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{{ID: "1", Text: soul.NewBindingFromString("first")}}
+	writes := newRecorder()
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, writes.update, func(err error) {
+		assert.Nil(t, err)
+	}, time.Hour, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ss.StartContext(ctx)
+	assert.Nil(t, notes[0].Text.Set("edited"))
+	assert.Eventually(t, func() bool {
+		return ss.Status().Pending == 1
+	}, time.Second, time.Millisecond)
+
+	// a done context stops the service, saving on the way out
+	cancel()
+	assert.Eventually(t, func() bool {
+		_, text := writes.count("1")
+		return !ss.Status().Running && text == "edited"
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, ss.Stop())
+}
+
+func TestSyncErrors(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{{ID: "1", Text: soul.NewBindingFromString("first")}}
+	failing := errors.New("disk full")
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, func(note *soul.Note) error {
+		return failing
+	}, func(error) {}, time.Hour, 0)
+	ss.Start()
+
+	assert.Nil(t, notes[0].Text.Set("edited"))
+	err := ss.Flush()
+	assert.True(t, errors.Is(err, failing))
+	assert.True(t, errors.Is(ss.Status().LastError, failing))
+	assert.True(t, errors.Is(ss.Stop(), failing))
+}
+
+func TestSyncSavesPastFailures(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{
+		{ID: "1", Text: soul.NewBindingFromString("first")},
+		{ID: "2", Text: soul.NewBindingFromString("second")},
+		{ID: "3", Text: soul.NewBindingFromString("third")},
+	}
+	failing := errors.New("disk full")
+	writes := newRecorder()
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, func(note *soul.Note) error {
+		if note.ID != "2" {
+			return writes.update(note)
+		}
+		return failing
+	}, func(error) {}, time.Hour, 0)
+
+	for i := range notes {
+		assert.Nil(t, notes[i].Text.Set("edited"))
+	}
+	assert.True(t, errors.Is(ss.Flush(), failing))
+
+	// the notes after the failing one are still saved
+	for _, id := range []string{"1", "3"} {
+		count, text := writes.count(id)
+		assert.Equal(t, 1, count)
+		assert.Equal(t, "edited", text)
+	}
+
+	status := ss.Status()
+	assert.Equal(t, 1, status.Pending)
+	assert.Equal(t, 1, status.Failed)
+	assert.Equal(t, soul.NoteFailed, status.Notes["2"].State)
+	assert.Equal(t, 1, status.Notes["2"].Attempts)
+	assert.Equal(t, soul.NoteSaved, status.Notes["3"].State)
+	assert.False(t, status.Notes["3"].LastSaved.IsZero())
+}
+
+func TestSyncRetriesWithBackoff(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{{ID: "1", Text: soul.NewBindingFromString("first")}}
+	failing := errors.New("disk full")
+	var mu sync.Mutex
+	var attempts []time.Time
+	writes := newRecorder()
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, func(note *soul.Note) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) < 4 {
+			return failing
+		}
+		return writes.update(note)
+	}, func(error) {}, 10*time.Millisecond, 0)
+	ss.SetRetry(20*time.Millisecond, 50*time.Millisecond)
+	ss.Start()
+	defer ss.Stop()
+
+	assert.Nil(t, notes[0].Text.Set("edited"))
+	assert.Eventually(t, func() bool {
+		count, _ := writes.count("1")
+		return count == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// the waits between attempts double, up to the maximum
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, attempts, 4)
+	assert.GreaterOrEqual(t, int64(attempts[1].Sub(attempts[0])), int64(20*time.Millisecond))
+	assert.GreaterOrEqual(t, int64(attempts[2].Sub(attempts[1])), int64(40*time.Millisecond))
+	assert.GreaterOrEqual(t, int64(attempts[3].Sub(attempts[2])), int64(50*time.Millisecond))
+
+	status := ss.Status()
+	assert.Equal(t, 0, status.Pending)
+	assert.Nil(t, status.LastError)
+	assert.Equal(t, soul.NoteSyncStatus{State: soul.NoteSaved, LastSaved: status.LastSaved}, status.Notes["1"])
+}
+
+func TestSyncStatusStream(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{{ID: "1", Text: soul.NewBindingFromString("first")}}
+	failing := errors.New("disk full")
+	fail := true
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, func(note *soul.Note) error {
+		if fail {
+			return failing
+		}
+		return nil
+	}, func(error) {}, time.Hour, 0)
+	ss.SetRetry(time.Hour, time.Hour)
+
+	statuses, cancel := ss.Subscribe()
+	assert.Equal(t, soul.SyncStatus{Notes: map[string]soul.NoteSyncStatus{}}, <-statuses)
+
+	ss.Start()
+	assert.True(t, (<-statuses).Running)
+
+	// only the latest status is kept for a subscriber that falls behind
+	assert.Nil(t, notes[0].Text.Set("edited"))
+	status := <-statuses
+	assert.Equal(t, soul.NoteDirty, status.Notes["1"].State)
+	assert.Equal(t, 1, status.Pending)
+
+	assert.NotNil(t, ss.Flush())
+	status = <-statuses
+	assert.Equal(t, soul.NoteFailed, status.Notes["1"].State)
+	assert.True(t, errors.Is(status.LastError, failing))
+	assert.False(t, status.Notes["1"].NextRetry.IsZero())
+
+	fail = false
+	assert.Nil(t, ss.Flush())
+	status = <-statuses
+	assert.Equal(t, soul.NoteSaved, status.Notes["1"].State)
+	assert.Nil(t, status.LastError)
+
+	cancel()
+	cancel()
+	_, open := <-statuses
+	assert.False(t, open)
+	assert.Nil(t, ss.Stop())
+}
+
+// TestSyncConcurrentUse is meant for the race detector, edits, flushes, status reads and restarts all overlap
+func TestSyncConcurrentUse(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{
+		{ID: "1", Text: soul.NewBindingFromString("first")},
+		{ID: "2", Text: soul.NewBindingFromString("second")},
+	}
+	writes := newRecorder()
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, writes.update, func(err error) {
+		assert.Nil(t, err)
+	}, time.Millisecond, time.Millisecond)
+
+	var wg sync.WaitGroup
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				fn(i)
+			}
+		}()
+	}
+
+	run(func(i int) { ss.Start() })
+	run(func(i int) { assert.Nil(t, ss.Stop()) })
+	run(func(i int) { assert.Nil(t, ss.Flush()) })
+	run(func(i int) { ss.Status() })
+	run(func(i int) {
+		statuses, cancel := ss.Subscribe()
+		<-statuses
+		cancel()
+	})
+	run(func(i int) { assert.Nil(t, notes[i%2].Text.Set(strings.Repeat("x", i))) })
+	wg.Wait()
+
+	assert.Nil(t, ss.Stop())
+	assert.Nil(t, ss.Flush())
+	_, text := writes.count("1")
+	assert.Equal(t, strings.Repeat("x", 48), text)
+	_, text = writes.count("2")
+	assert.Equal(t, strings.Repeat("x", 49), text)
+}
+
+func TestSyncCallbacksCallBack(t *testing.T) {
+	t.Parallel()
+
+	notes := []soul.Note{{ID: "1", Text: soul.NewBindingFromString("first")}}
+	var ss *soul.SyncService
+	fail := true
+	handled := make(chan error, 10)
+	ss = soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, func(note *soul.Note) error {
+		// the repository and the error handler may ask the service what it is doing while it saves
+		assert.Equal(t, 1, ss.Status().Pending)
+		if fail {
+			fail = false
+			return errors.New("offline")
+		}
+		return nil
+	}, func(err error) {
+		statuses, cancel := ss.Subscribe()
+		<-statuses
+		cancel()
+		handled <- err
+	}, time.Millisecond, 0)
+	ss.SetRetry(time.Millisecond, time.Millisecond)
+	ss.Start()
+
+	assert.Nil(t, notes[0].Text.Set("edited"))
+	select {
+	case err := <-handled:
+		assert.NotNil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("saving deadlocked calling back into the service")
+	}
+
+	assert.Eventually(t, func() bool {
+		return ss.Status().Pending == 0
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, ss.Stop())
+}
+
+// statusReadingString asks the service for its status whenever the text is read, as a binding shown next to the sync
+// status might
+type statusReadingString struct {
+	binding.String
+	ss *soul.SyncService
+	mu sync.Mutex
+}
+
+func (srs *statusReadingString) Get() (string, error) {
+	srs.mu.Lock()
+	ss := srs.ss
+	srs.mu.Unlock()
+	if ss != nil {
+		ss.Status()
+	}
+
+	return srs.String.Get()
+}
+
+func TestSyncReadsTextUnlocked(t *testing.T) {
+	t.Parallel()
+
+	text := &statusReadingString{String: soul.NewBindingFromString("first")}
+	notes := []soul.Note{{ID: "1", Text: text}}
+	saved := make(chan string, 10)
+	ss := soul.NewSyncServiceWithDebounce(func() ([]soul.Note, error) {
+		return notes, nil
+	}, func(note *soul.Note) error {
+		txt, err := note.Text.Get()
+		saved <- txt
+		return err
+	}, func(error) {}, time.Millisecond, 0)
+	text.mu.Lock()
+	text.ss = ss
+	text.mu.Unlock()
+	ss.Start()
+
+	assert.Nil(t, text.Set("edited"))
+	select {
+	case txt := <-saved:
+		assert.Equal(t, "edited", txt)
+	case <-time.After(time.Second):
+		t.Fatal("reading the text deadlocked with the service")
+	}
+	assert.Nil(t, ss.Stop())
+}
@@ -1,10 +1,16 @@
 package testhelpers
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
 	"fmt"
 	"soul"
 	"soul/crypt"
+	"soul/secret"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -14,13 +20,13 @@ func ExecuteConfigStoreTests(t *testing.T, configStore soul.ConfigStore) {
 
 	testCreds := &soul.Credentials{
 		Identifier: "dummy@jsjsjsj2222jj2",
-		Password:   "dummyKey@567",
+		Password:   secret.FromString("dummyKey@567"),
 	}
 
 	// write data in a private scope
 	{
 		soul.DeleteCredentials(configStore)
-		cryptor, err := crypt.NewCryptor(testCreds.Password)
+		cryptor, err := crypt.NewCryptorFromSecret(testCreds.Password)
 		assert.Nil(t, err)
 
 		cred, err := soul.GetCredentials(configStore, cryptor)
@@ -32,10 +38,255 @@ func ExecuteConfigStoreTests(t *testing.T, configStore soul.ConfigStore) {
 	}
 
 	for i := 0; i < 10; i++ {
-		newCryptor, err := crypt.NewCryptor(testCreds.Password)
+		newCryptor, err := crypt.NewCryptorFromSecret(testCreds.Password)
 		assert.Nil(t, err)
 		fetchedCreds, err := soul.GetCredentials(configStore, newCryptor)
 		assert.Nil(t, err)
-		assert.Equal(t, testCreds, fetchedCreds)
+		assert.Equal(t, testCreds.Identifier, fetchedCreds.Identifier)
+		assert.Equal(t, testCreds.Password.Bytes(), fetchedCreds.Password.Bytes())
+		fetchedCreds.Wipe()
+		newCryptor.Wipe()
 	}
+
+	// credentials stored before passwords were kept in secret buffers still load
+	{
+		var encoded bytes.Buffer
+		assert.Nil(t, gob.NewEncoder(&encoded).Encode(struct {
+			Identifier string
+			Password   string
+		}{testCreds.Identifier, "legacyKey@567"}))
+
+		cryptor, err := crypt.NewCryptor("legacyKey@567")
+		assert.Nil(t, err)
+		encrypted, err := cryptor.Encrypt(encoded.Bytes())
+		assert.Nil(t, err)
+		configStore.SetString(soul.LocalCreditialsKeyName, base64.StdEncoding.EncodeToString(encrypted))
+
+		fetchedCreds, err := soul.GetCredentials(configStore, cryptor)
+		assert.Nil(t, err)
+		assert.Equal(t, testCreds.Identifier, fetchedCreds.Identifier)
+		assert.Equal(t, []byte("legacyKey@567"), fetchedCreds.Password.Bytes())
+	}
+}
+
+func ExecutePINTests(t *testing.T, configStore soul.ConfigStore) {
+	t.Helper()
+
+	testCreds := &soul.Credentials{
+		Identifier: "dummy@pin",
+		Password:   secret.FromString("dummyKey@567"),
+	}
+	pin := secret.FromString("4321")
+	wrongPIN := secret.FromString("1234")
+
+	soul.DeleteCredentials(configStore)
+	assert.False(t, soul.HasPIN(configStore))
+	assert.NotNil(t, soul.SetPIN(configStore, secret.FromString("12"), testCreds, crypt.NewPINCryptor))
+	assert.Nil(t, soul.SetPIN(configStore, pin, testCreds, crypt.NewPINCryptor))
+	assert.True(t, soul.HasPIN(configStore))
+
+	noDelay := soul.PINPolicy{MaxAttempts: 3}
+	fetchedCreds, err := soul.UnlockWithPIN(configStore, pin, crypt.NewPINCryptor, noDelay)
+	assert.Nil(t, err)
+	assert.Equal(t, testCreds.Identifier, fetchedCreds.Identifier)
+	assert.Equal(t, testCreds.Password.Bytes(), fetchedCreds.Password.Bytes())
+
+	// failed attempts lock the PIN for a while, even for the right PIN
+	_, err = soul.UnlockWithPIN(configStore, wrongPIN, crypt.NewPINCryptor, soul.PINPolicy{MaxAttempts: 3, Delay: time.Hour})
+	assert.Equal(t, soul.ErrWrongPIN, err)
+	_, err = soul.UnlockWithPIN(configStore, pin, crypt.NewPINCryptor, noDelay)
+	var throttled *soul.PINThrottledError
+	assert.True(t, errors.As(err, &throttled))
+	assert.Equal(t, 2, soul.PINAttemptsLeft(configStore, noDelay))
+
+	// a success resets the count, the limit then wipes the stored credentials
+	configStore.Delete(soul.PINLockedUntilKeyName)
+	_, err = soul.UnlockWithPIN(configStore, pin, crypt.NewPINCryptor, noDelay)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, soul.PINAttemptsLeft(configStore, noDelay))
+
+	for i := 0; i < 2; i++ {
+		_, err = soul.UnlockWithPIN(configStore, wrongPIN, crypt.NewPINCryptor, noDelay)
+		assert.Equal(t, soul.ErrWrongPIN, err)
+	}
+
+	_, err = soul.UnlockWithPIN(configStore, wrongPIN, crypt.NewPINCryptor, noDelay)
+	assert.Equal(t, soul.ErrPINWiped, err)
+	assert.False(t, soul.HasPIN(configStore))
+	assert.False(t, soul.IsSignedIn(configStore))
+}
+
+func ExecuteSessionTests(t *testing.T, configStore soul.ConfigStore) {
+	t.Helper()
+
+	configStore.Delete(soul.SessionMaxAgeKeyName)
+	configStore.Delete(soul.SessionMaxCheckInsKeyName)
+	assert.Equal(t, soul.DefaultSessionPolicy, soul.GetSessionPolicy(configStore))
+
+	policy := soul.SessionPolicy{MaxAge: time.Hour, MaxCheckIns: 2}
+	soul.SetSessionPolicy(configStore, policy)
+	assert.Equal(t, policy, soul.GetSessionPolicy(configStore))
+
+	cryptor, err := crypt.NewCryptor("dummyKey@567")
+	assert.Nil(t, err)
+	testCreds := &soul.Credentials{
+		Identifier: "dummy@session",
+		Password:   secret.FromString("dummyKey@567"),
+	}
+	policy.Apply(testCreds)
+	assert.Nil(t, soul.SetCredentials(configStore, cryptor, testCreds))
+
+	// the limits travel with the stored credentials
+	for i := 0; i < policy.MaxCheckIns; i++ {
+		fetchedCreds, err := soul.GetCredentials(configStore, cryptor)
+		assert.Nil(t, err)
+		assert.Equal(t, policy.MaxCheckIns-i, soul.CheckInsLeft(configStore, fetchedCreds))
+		assert.Nil(t, soul.CheckIn(configStore, fetchedCreds))
+	}
+
+	fetchedCreds, err := soul.GetCredentials(configStore, cryptor)
+	assert.Nil(t, err)
+	assert.Equal(t, soul.ErrSessionExpired, soul.CheckIn(configStore, fetchedCreds))
+	assert.False(t, soul.IsSignedIn(configStore))
+
+	// too old credentials expire, as do credentials stored before they had an issue time
+	testCreds.IssuedAt = time.Now().Add(-2 * time.Hour)
+	assert.Nil(t, soul.SetCredentials(configStore, cryptor, testCreds))
+	assert.Equal(t, soul.ErrSessionExpired, soul.CheckIn(configStore, testCreds))
+	assert.False(t, soul.IsSignedIn(configStore))
+
+	testCreds.IssuedAt = time.Time{}
+	assert.Nil(t, soul.SetCredentials(configStore, cryptor, testCreds))
+	assert.Equal(t, soul.ErrSessionExpired, soul.CheckIn(configStore, testCreds))
+
+	// no limits keep the credentials for good
+	soul.SessionPolicy{}.Apply(testCreds)
+	assert.Nil(t, soul.SetCredentials(configStore, cryptor, testCreds))
+	assert.Nil(t, soul.CheckIn(configStore, testCreds))
+	assert.Equal(t, -1, soul.CheckInsLeft(configStore, testCreds))
+	soul.DeleteCredentials(configStore)
+}
+
+func ExecuteProfileTests(t *testing.T, configStore soul.ConfigStore) {
+	t.Helper()
+
+	// start from a store without profiles left by an earlier run
+	for _, name := range soul.ListProfiles(configStore)[1:] {
+		assert.Nil(t, soul.RemoveProfile(configStore, name))
+	}
+
+	assert.Equal(t, []string{soul.DefaultProfile}, soul.ListProfiles(configStore))
+	assert.Equal(t, soul.DefaultProfile, soul.ActiveProfile(configStore))
+	assert.NotNil(t, soul.RemoveProfile(configStore, soul.DefaultProfile))
+
+	assert.NotNil(t, soul.AddProfile(configStore, "  ", ""))
+	assert.NotNil(t, soul.AddProfile(configStore, "default", ""))
+	assert.Nil(t, soul.AddProfile(configStore, "Work", "/tmp/work.db"))
+	assert.NotNil(t, soul.AddProfile(configStore, "work", ""))
+	assert.Nil(t, soul.AddProfile(configStore, " Home ", ""))
+	assert.Equal(t, []string{soul.DefaultProfile, "Work", "Home"}, soul.ListProfiles(configStore))
+
+	// the default profile keeps using the keys stored before profiles
+	soul.StoreDbPath(configStore, "/tmp/default.db")
+	assert.Equal(t, "/tmp/default.db", soul.GetDBPath(soul.ProfileStore(configStore, soul.DefaultProfile)))
+	assert.Equal(t, "/tmp/work.db", soul.GetDBPath(soul.ProfileStore(configStore, "Work")))
+	assert.Equal(t, "", soul.GetDBPath(soul.ProfileStore(configStore, "Home")))
+
+	// each profile keeps its own credentials
+	ExecuteConfigStoreTests(t, soul.ProfileStore(configStore, "Work"))
+	assert.True(t, soul.IsSignedIn(soul.ProfileStore(configStore, "Work")))
+	assert.False(t, soul.IsSignedIn(soul.ProfileStore(configStore, "Home")))
+
+	assert.NotNil(t, soul.SelectProfile(configStore, "Missing"))
+	assert.Nil(t, soul.SelectProfile(configStore, "Work"))
+	assert.Equal(t, "Work", soul.ActiveProfile(configStore))
+	assert.Equal(t, "/tmp/work.db", soul.GetDBPath(soul.ActiveProfileStore(configStore)))
+
+	// removing the selected profile deletes its settings and selects the default one
+	assert.Nil(t, soul.RemoveProfile(configStore, "Work"))
+	assert.NotNil(t, soul.RemoveProfile(configStore, "Work"))
+	assert.Equal(t, soul.DefaultProfile, soul.ActiveProfile(configStore))
+	assert.False(t, soul.IsSignedIn(soul.ProfileStore(configStore, "Work")))
+	assert.Equal(t, "", soul.GetDBPath(soul.ProfileStore(configStore, "Work")))
+	assert.Equal(t, "/tmp/default.db", soul.GetDBPath(configStore))
+	assert.Equal(t, []string{soul.DefaultProfile, "Home"}, soul.ListProfiles(configStore))
+
+	assert.Nil(t, soul.RemoveProfile(configStore, "Home"))
+}
+
+func ExecuteSettingsTests(t *testing.T, configStore soul.ConfigStore) {
+	t.Helper()
+
+	configStore.Delete(soul.SettingsKeyName)
+	settings, err := soul.LoadSettings(configStore)
+	assert.Nil(t, err)
+	assert.Equal(t, soul.DefaultSettings(), settings)
+	assert.Equal(t, soul.SettingsVersion, settings.Version)
+
+	settings.Theme = soul.ThemeLight
+	settings.FontSize = 18
+	settings.SortOrder = soul.SortTitle
+	assert.Nil(t, soul.SaveSettings(configStore, settings))
+	loaded, err := soul.LoadSettings(configStore)
+	assert.Nil(t, err)
+	assert.Equal(t, settings, loaded)
+
+	assert.Nil(t, soul.SetAutoLock(configStore, 90*time.Second))
+	assert.Equal(t, time.Minute, soul.GetAutoLock(configStore))
+	assert.Nil(t, soul.SetAutoLock(configStore, 0))
+	assert.Equal(t, time.Duration(0), soul.GetAutoLock(configStore))
+
+	invalid := settings
+	invalid.FontSize = 2
+	invalid.Theme = "neon"
+	assert.NotNil(t, soul.SaveSettings(configStore, invalid))
+
+	// invalid stored values fall back to their defaults without losing the valid ones
+	configStore.SetString(soul.SettingsKeyName, `{"version":1,"theme":"neon","font_size":18,"sync_interval":1}`)
+	loaded, err = soul.LoadSettings(configStore)
+	assert.NotNil(t, err)
+	assert.Equal(t, soul.DefaultSettings().Theme, loaded.Theme)
+	assert.Equal(t, soul.DefaultSettings().SyncInterval, loaded.SyncInterval)
+	assert.Equal(t, float32(18), loaded.FontSize)
+	assert.Nil(t, loaded.Validate())
+
+	configStore.SetString(soul.SettingsKeyName, `{"version":99}`)
+	loaded, err = soul.LoadSettings(configStore)
+	assert.NotNil(t, err)
+	assert.Equal(t, soul.DefaultSettings(), loaded)
+
+	configStore.Delete(soul.SettingsKeyName)
+}
+
+func ExecutePolicyTests(t *testing.T, configStore soul.ConfigStore) {
+	t.Helper()
+
+	cryptor, err := crypt.NewCryptor("dummyKey@567")
+	assert.Nil(t, err)
+	testCreds := &soul.Credentials{
+		Identifier: "dummy@policy",
+		Password:   secret.FromString("dummyKey@567"),
+	}
+	assert.Nil(t, soul.SetCredentials(configStore, cryptor, testCreds))
+
+	settings := soul.DefaultSettings()
+	settings.AutoLock = 0
+	assert.Nil(t, soul.SaveSettings(configStore, settings))
+
+	policy := &soul.Policy{DisallowKeepOpen: true, MaxAutoLockMinutes: 10}
+	var policyErr *soul.PolicyError
+	assert.True(t, errors.As(policy.CheckKeepOpen(), &policyErr))
+	assert.True(t, errors.As(policy.CheckSettings(settings), &policyErr))
+	assert.Equal(t, 10*time.Minute, policy.EnforceSettings(settings).AutoLock)
+
+	// enforcing drops the kept credentials and caps the stored settings
+	assert.Nil(t, policy.Enforce(configStore))
+	assert.False(t, soul.IsSignedIn(configStore))
+	assert.Equal(t, 10*time.Minute, soul.GetAutoLock(configStore))
+
+	assert.Nil(t, (&soul.Policy{}).CheckKeepOpen())
+	assert.Nil(t, (&soul.Policy{MinPasswordLength: 4, MinPasswordClasses: 2}).CheckPassword([]byte("abc1")))
+	assert.NotNil(t, (&soul.Policy{MinPasswordLength: 4, MinPasswordClasses: 2}).CheckPassword([]byte("abcd")))
+
+	configStore.Delete(soul.SettingsKeyName)
 }